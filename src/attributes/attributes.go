@@ -0,0 +1,246 @@
+/*
+Gerber X2 attributes support: TF, TA, TO and TD commands
+*/
+package attributes
+
+import (
+	"errors"
+	"strings"
+)
+
+/*
+############################## attributes #################################
+*/
+
+type Kind int
+
+const (
+	KindFile     Kind = iota + 1 // %TF - file attribute
+	KindAperture                 // %TA - aperture attribute
+	KindObject                   // %TO - object attribute
+	KindDelete                   // %TD - attribute deletion command
+)
+
+func (k Kind) String() string {
+	switch k {
+	case KindFile:
+		return "file attribute"
+	case KindAperture:
+		return "aperture attribute"
+	case KindObject:
+		return "object attribute"
+	case KindDelete:
+		return "attribute delete"
+	default:
+	}
+	return "unknown attribute kind"
+}
+
+// some standard attribute names
+const (
+	FileFunction    = ".FileFunction"
+	FilePolarity    = ".FilePolarity"
+	AperFunction    = ".AperFunction"
+	Net             = ".N"
+	Pin             = ".P"
+	ComponentRefDes = ".C"
+)
+
+type Attribute struct {
+	Kind   Kind
+	Name   string
+	Values []string
+}
+
+func (a *Attribute) String() string {
+	if a == nil {
+		return "<nil>"
+	}
+	retVal := a.Name
+	if len(a.Values) > 0 {
+		retVal = retVal + "," + a.Value()
+	}
+	return retVal
+}
+
+// returns all the values of the attribute as one comma separated string
+func (a *Attribute) Value() string {
+	return strings.Join(a.Values, ",")
+}
+
+// returns true if the string is an attribute command
+func IsAttribute(s string) bool {
+	return strings.HasPrefix(s, "%TF") ||
+		strings.HasPrefix(s, "%TA") ||
+		strings.HasPrefix(s, "%TO") ||
+		strings.HasPrefix(s, "%TD")
+}
+
+// parses an attribute command string like %TF.FileFunction,Copper,L1,Top*%
+// the attribute name and values are case sensitive, so the string must not be converted to the upper case
+func Parse(s string) (*Attribute, error) {
+	if IsAttribute(s) == false {
+		return nil, errors.New("not an attribute command: " + s)
+	}
+	if strings.HasSuffix(s, "*%") == false {
+		return nil, errors.New("attribute command trailing *% not found: " + s)
+	}
+	retVal := new(Attribute)
+	switch s[1:3] {
+	case "TF":
+		retVal.Kind = KindFile
+	case "TA":
+		retVal.Kind = KindAperture
+	case "TO":
+		retVal.Kind = KindObject
+	case "TD":
+		retVal.Kind = KindDelete
+	}
+	body := strings.TrimSpace(s[3 : len(s)-2])
+	fields := strings.Split(body, ",")
+	retVal.Name = strings.TrimSpace(fields[0])
+	if len(retVal.Name) == 0 {
+		if retVal.Kind == KindDelete {
+			// %TD*% deletes all the attributes
+			return retVal, nil
+		}
+		return nil, errors.New("attribute name is missing: " + s)
+	}
+	if isValidName(retVal.Name) == false {
+		return nil, errors.New("bad attribute name: " + s)
+	}
+	if retVal.Kind == KindDelete {
+		if len(fields) > 1 {
+			return nil, errors.New("attribute delete command must not have values: " + s)
+		}
+		return retVal, nil
+	}
+	for _, v := range fields[1:] {
+		retVal.Values = append(retVal.Values, v)
+	}
+	return retVal, nil
+}
+
+// the name must not start with a digit and must consist of letters, digits and ._$ characters
+func isValidName(name string) bool {
+	for i, c := range []byte(name) {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c == '.', c == '_', c == '$':
+		case c >= '0' && c <= '9':
+			if i == 0 {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+/*
+############################## attribute dictionary #################################
+*/
+
+// Dictionary holds the attributes in the order they were added.
+// The dictionary is never changed after creation: Set and Delete return a new dictionary,
+// so a pointer to the dictionary may be freely shared between the apertures and the steps.
+// nil pointer is a valid empty dictionary.
+type Dictionary struct {
+	attrs []*Attribute
+}
+
+func NewDictionary() *Dictionary {
+	return new(Dictionary)
+}
+
+// returns the number of attributes in the dictionary
+func (d *Dictionary) Len() int {
+	if d == nil {
+		return 0
+	}
+	return len(d.attrs)
+}
+
+// returns the attribute by name or nil if the attribute does not exist
+func (d *Dictionary) Get(name string) *Attribute {
+	if d == nil {
+		return nil
+	}
+	for _, a := range d.attrs {
+		if a.Name == name {
+			return a
+		}
+	}
+	return nil
+}
+
+// returns the value of the attribute and true if the attribute exists
+func (d *Dictionary) Value(name string) (string, bool) {
+	a := d.Get(name)
+	if a == nil {
+		return "", false
+	}
+	return a.Value(), true
+}
+
+// returns the names of the attributes
+func (d *Dictionary) Names() []string {
+	retVal := make([]string, 0, d.Len())
+	if d == nil {
+		return retVal
+	}
+	for _, a := range d.attrs {
+		retVal = append(retVal, a.Name)
+	}
+	return retVal
+}
+
+// returns a new dictionary with the attribute added or replaced
+func (d *Dictionary) Set(a *Attribute) *Dictionary {
+	retVal := new(Dictionary)
+	replaced := false
+	if d != nil {
+		retVal.attrs = make([]*Attribute, 0, len(d.attrs)+1)
+		for _, old := range d.attrs {
+			if old.Name == a.Name {
+				retVal.attrs = append(retVal.attrs, a)
+				replaced = true
+				continue
+			}
+			retVal.attrs = append(retVal.attrs, old)
+		}
+	}
+	if replaced == false {
+		retVal.attrs = append(retVal.attrs, a)
+	}
+	return retVal
+}
+
+// returns a new dictionary without the attribute
+// empty name deletes all the attributes
+func (d *Dictionary) Delete(name string) *Dictionary {
+	if len(name) == 0 || d.Len() == 0 {
+		return nil
+	}
+	if d.Get(name) == nil {
+		return d
+	}
+	retVal := new(Dictionary)
+	for _, a := range d.attrs {
+		if a.Name != name {
+			retVal.attrs = append(retVal.attrs, a)
+		}
+	}
+	return retVal
+}
+
+func (d *Dictionary) String() string {
+	if d.Len() == 0 {
+		return "<empty>"
+	}
+	s := make([]string, 0, len(d.attrs))
+	for _, a := range d.attrs {
+		s = append(s, a.String())
+	}
+	return strings.Join(s, "; ")
+}
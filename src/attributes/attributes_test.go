@@ -0,0 +1,96 @@
+package attributes
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	a, err := Parse("%TF.FileFunction,Copper,L1,Top*%")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Kind != KindFile || a.Name != FileFunction || a.Value() != "Copper,L1,Top" {
+		t.Error("bad file attribute: " + a.String())
+	}
+
+	a, err = Parse("%TO.N,Net1*%")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Kind != KindObject || a.Name != Net || len(a.Values) != 1 || a.Values[0] != "Net1" {
+		t.Error("bad object attribute: " + a.String())
+	}
+
+	a, err = Parse("%TD*%")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Kind != KindDelete || len(a.Name) != 0 {
+		t.Error("bad delete command: " + a.String())
+	}
+
+	a, err = Parse("%TD.AperFunction*%")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Kind != KindDelete || a.Name != AperFunction {
+		t.Error("bad delete command: " + a.String())
+	}
+
+	badStrings := []string{
+		"%TF*%",
+		"%TA.AperFunction,Conductor",
+		"%TO1N,Net1*%",
+		"%TD.N,Net1*%",
+		"%ADD10C,0.1*%",
+	}
+	for _, s := range badStrings {
+		if _, err := Parse(s); err == nil {
+			t.Error("error expected for " + s)
+		}
+	}
+}
+
+func TestDictionary(t *testing.T) {
+	var d *Dictionary
+	if d.Len() != 0 || d.Get(Net) != nil {
+		t.Fatal("nil dictionary must be empty")
+	}
+	n1, _ := Parse("%TO.N,Net1*%")
+	n2, _ := Parse("%TO.N,Net2*%")
+	c, _ := Parse("%TO.C,R1*%")
+
+	d1 := d.Set(n1)
+	d2 := d1.Set(c)
+	d3 := d2.Set(n2)
+
+	if v, ok := d1.Value(Net); ok == false || v != "Net1" {
+		t.Error("d1 must hold Net1")
+	}
+	if v, _ := d3.Value(Net); v != "Net2" {
+		t.Error("d3 must hold Net2, got " + v)
+	}
+	if d3.Len() != 2 {
+		t.Error("the attribute must be replaced, not added")
+	}
+	if strings.Join(d3.Names(), " ") != ".N .C" {
+		t.Error("bad order of the attributes: " + strings.Join(d3.Names(), " "))
+	}
+	// the dictionaries must stay unchanged
+	if v, _ := d2.Value(Net); v != "Net1" || d1.Len() != 1 {
+		t.Error("the dictionary has been modified")
+	}
+
+	d4 := d3.Delete(Net)
+	if d4.Get(Net) != nil || d4.Get(ComponentRefDes) == nil || d3.Get(Net) == nil {
+		t.Error("bad delete by name")
+	}
+	if d4.Delete(Pin) != d4 {
+		t.Error("deletion of the absent attribute must return the same dictionary")
+	}
+	if d3.Delete("").Len() != 0 {
+		t.Error("all the attributes must be deleted")
+	}
+	t.Log(d3.String())
+}
@@ -1,6 +1,7 @@
 package calculator
 
 import (
+	"errors"
 	"strconv"
 	"strings"
 )
@@ -155,18 +156,18 @@ func (stack *Stack) Push(val int) {
 	(*stack).data = append((*stack).data, val)
 }
 
-func (stack *Stack) Pop() int {
+func (stack *Stack) Pop() (int, error) {
 	slen := len((*stack).data)
 	if slen == 0 {
-		panic("Pop() error: stack is empty")
+		return 0, errors.New("Pop() error: stack is empty")
 	}
 	retVal := (*stack).data[slen-1]
 	(*stack).data = (*stack).data[:slen-1]
-	return retVal
+	return retVal, nil
 }
 
-//
-func CalcExpression(str string, varStorage *map[string]float64) float64 {
+// calculates the expression, returns an error if the expression can not be parsed
+func CalcExpression(str string, varStorage *map[string]float64) (float64, error) {
 
 	//	log.SetFlags(log.Lshortfile)
 
@@ -180,16 +181,23 @@ func CalcExpression(str string, varStorage *map[string]float64) float64 {
 	var i int
 	str = "(" + str + ")"
 	for {
+		reduced := false
 		for i, r = range str {
 			if r == LEFT_PAR {
 				stack.Push(i)
 				continue
 			}
 			if r == RIGHT_PAR {
-				lPar := stack.Pop()
+				lPar, err := stack.Pop()
+				if err != nil {
+					return 0, errors.New("unbalanced parentheses in " + str)
+				}
 				substring := str[lPar+1 : i]
 				//				log.Println(substring)
-				tf := TokenizeFormulae(substring, varStorage)
+				tf, err := TokenizeFormulae(substring, varStorage)
+				if err != nil {
+					return 0, err
+				}
 				val := CalcTokenizedFormulae(&tf)
 				valName = "$$" + strconv.Itoa(tempVarId)
 				tempVarId++
@@ -197,14 +205,19 @@ func CalcExpression(str string, varStorage *map[string]float64) float64 {
 				//				log.Println("Variable " + valName + " = " + strconv.FormatFloat(val, 'f', 10, 64))
 				str = strings.Replace(str, str[lPar:i+1], valName, 1)
 				//				log.Println("Reduced str = " + str)
+				reduced = true
 				break
 			}
 		}
 		if strings.Compare(str, valName) == 0 {
 			break
 		}
+		if reduced == false {
+			return 0, errors.New("unbalanced parentheses in " + str)
+		}
+		stack = NewStack()
 	}
-	return (*varStorage)[str]
+	return (*varStorage)[str], nil
 }
 
 type TokenizedFormula struct {
@@ -216,7 +229,7 @@ func (tf *TokenizedFormula) String() string {
 	return strconv.FormatFloat((*tf).value, 'f', 10, 64) + " " + (*tf).operation.String()
 }
 
-func TokenizeFormulae(str string, varStorage *map[string]float64) []TokenizedFormula {
+func TokenizeFormulae(str string, varStorage *map[string]float64) ([]TokenizedFormula, error) {
 	retVal := make([]TokenizedFormula, 0)
 	runeStr := []rune(str)
 	tokenStart := true
@@ -226,7 +239,7 @@ func TokenizeFormulae(str string, varStorage *map[string]float64) []TokenizedFor
 	var opCode OpCode
 	var floatVal float64
 	var err error
-	panicString := "TokenizeFormulae() is unable to parse " + str
+	errString := "TokenizeFormulae() is unable to parse " + str
 	for i := 0; i < len(runeStr); i++ {
 		if tokenStart == true {
 			if runeStr[i] == '+' || runeStr[i] == '-' {
@@ -271,7 +284,7 @@ func TokenizeFormulae(str string, varStorage *map[string]float64) []TokenizedFor
 		} else {
 			floatVal, err = strconv.ParseFloat(convString, 64)
 			if err != nil {
-				panic(panicString)
+				return nil, errors.New(errString)
 			}
 		}
 		if needInvNext {
@@ -301,7 +314,7 @@ func TokenizeFormulae(str string, varStorage *map[string]float64) []TokenizedFor
 
 		floatVal, err = strconv.ParseFloat(convString, 64)
 		if err != nil {
-			panic(panicString)
+			return nil, errors.New(errString)
 		}
 	}
 	if needInvNext {
@@ -314,7 +327,7 @@ func TokenizeFormulae(str string, varStorage *map[string]float64) []TokenizedFor
 	}
 	retVal = append(retVal, TokenizedFormula{floatVal, Nop})
 
-	return retVal
+	return retVal, nil
 }
 
 func CalcTokenizedFormulae(tf *[]TokenizedFormula) float64 {
@@ -72,7 +72,10 @@ var src2 = []string{
 func TestCalcExpression(t *testing.T) {
 	for _, s := range src {
 		varStorage := make(map[string]float64)
-		result := CalcExpression(s.src, &varStorage)
+		result, err := CalcExpression(s.src, &varStorage)
+		if err != nil {
+			t.Fatal(err)
+		}
 		if result != s.ans {
 			t.Fatal(s.src + " calculation error! got " +
 				strconv.FormatFloat(result, 'f', 10, 64) +
@@ -83,6 +86,15 @@ func TestCalcExpression(t *testing.T) {
 	}
 }
 
+func TestCalcExpressionErrors(t *testing.T) {
+	for _, src := range []string{"(1+2", "1+2)", "1+$1x", "1+A"} {
+		varStorage := make(map[string]float64)
+		if _, err := CalcExpression(src, &varStorage); err == nil {
+			t.Error("the error is expected for " + src)
+		}
+	}
+}
+
 //func TestTokenizeFormulae(t *testing.T) {
 //	for _, s := range src {
 //		tf := TokenizeFormulae(s.src)
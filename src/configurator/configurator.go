@@ -15,18 +15,100 @@ const (
 	CfgCommonPrintGerberComments string = "common.PrintGerberComments"
 	CfgRendererOutFile           string = "renderer.OutFile"
 	CfgRendererGeneratePNG       string = "renderer.GeneratePNG"
+	CfgRendererGenerateSVG       string = "renderer.GenerateSVG"
+	CfgRendererSVGOutFile        string = "renderer.SVGOutFile"
 
 	CfgPlotterOutFile  string = "plotter.OutFile"
 	CfgPlotterXRes     string = "plotter.xRes"
 	CfgPlotterYRes     string = "plotter.yRes"
 	CfgPlotterPenSizes string = "plotter.PenSizes"
+	CfgPlotterBackend  string = "plotter.Backend"
+
+	CfgPlotterOptimizeTravel string = "plotter.OptimizeTravel"
+
+	CfgPlotterMaxWidth  string = "plotter.MaxWidth"
+	CfgPlotterMaxHeight string = "plotter.MaxHeight"
+
+	CfgPlotterHPGLUnitsPerMM string = "plotter.hpgl.UnitsPerMM"
+
+	CfgPlotterGCodePenMode        string = "plotter.gcode.PenMode"
+	CfgPlotterGCodePenUpZ         string = "plotter.gcode.PenUpZ"
+	CfgPlotterGCodePenDownZ       string = "plotter.gcode.PenDownZ"
+	CfgPlotterGCodeZFeed          string = "plotter.gcode.ZFeed"
+	CfgPlotterGCodeServoUp        string = "plotter.gcode.ServoUp"
+	CfgPlotterGCodeServoDown      string = "plotter.gcode.ServoDown"
+	CfgPlotterGCodeServoDwell     string = "plotter.gcode.ServoDwell"
+	CfgPlotterGCodeLaserPower     string = "plotter.gcode.LaserPower"
+	CfgPlotterGCodeDrawFeed       string = "plotter.gcode.DrawFeed"
+	CfgPlotterGCodeMoveFeed       string = "plotter.gcode.MoveFeed"
+	CfgPlotterGCodePauseOnPenSwap string = "plotter.gcode.PauseOnPenSwap"
+)
+
+const (
+	CfgPcbXOrigin  string = "pcb.xOrigin"
+	CfgPcbYOrigin  string = "pcb.yOrigin"
+	CfgPcbMirrorX  string = "pcb.MirrorX"
+	CfgPcbMirrorY  string = "pcb.MirrorY"
+	CfgPcbRotation string = "pcb.Rotation"
+	CfgPcbScale    string = "pcb.Scale"
+)
+
+const (
+	CfgRenderCanvasWidth  string = "renderer.CanvasWidth"
+	CfgRenderCanvasHeight string = "renderer.CanvasHeight"
+
+	CfgPaperSize        string = "paper.Size"
+	CfgPaperOrientation string = "paper.Orientation"
+	CfgPaperMargin      string = "paper.Margin"
+	CfgPaperAutoRotate  string = "paper.AutoRotate"
+	CfgPaperPlacement   string = "paper.Placement"
+	CfgPaperXOffset     string = "paper.xOffset"
+	CfgPaperYOffset     string = "paper.yOffset"
+)
+
+const (
+	CfgTitleEnable     string = "title.Enable"
+	CfgTitleTextHeight string = "title.TextHeight"
+	CfgTitleRevision   string = "title.Revision"
+)
+
+const (
+	CfgRenderDrawContours     string = "renderer.DrawContours"
+	CfgRenderDrawMoves        string = "renderer.DrawMoves"
+	CfgRenderDrawOnlyRegions  string = "renderer.DrawOnlyRegions"
+	CfgRenderChainTraces      string = "renderer.ChainTraces"
+	CfgRenderWidePenThreshold string = "renderer.WidePenThreshold"
+	CfgRenderNegative         string = "renderer.Negative"
+	CfgRenderNegativeMargin   string = "renderer.NegativeMargin"
+	CfgPrintRegionInfo        string = "renderer.PrintRegionInfo"
 )
 
 const (
-	CfgRenderDrawContours    string = "renderer.DrawContours"
-	CfgRenderDrawMoves       string = "renderer.DrawMoves"
-	CfgRenderDrawOnlyRegions string = "renderer.DrawOnlyRegions"
-	CfgPrintRegionInfo       string = "renderer.PrintRegionInfo"
+	CfgRenderTilesEnable   string = "renderer.tiles.Enable"
+	CfgRenderTilesOverlap  string = "renderer.tiles.Overlap"
+	CfgRenderTilesMarkSize string = "renderer.tiles.MarkSize"
+)
+
+const (
+	CfgRenderMarksFrame          string = "renderer.marks.Frame"
+	CfgRenderMarksCropMarks      string = "renderer.marks.CropMarks"
+	CfgRenderMarksCropMarkLength string = "renderer.marks.CropMarkLength"
+	CfgRenderMarksFiducials      string = "renderer.marks.Fiducials"
+	CfgRenderMarksFiducialSize   string = "renderer.marks.FiducialSize"
+	CfgRenderMarksScaleBar       string = "renderer.marks.ScaleBar"
+	CfgRenderMarksScaleBarLength string = "renderer.marks.ScaleBarLength"
+)
+
+const (
+	CfgRenderFlashFillStrategy  string = "renderer.fill.flash.Strategy"
+	CfgRenderFlashFillAngle     string = "renderer.fill.flash.Angle"
+	CfgRenderFlashFillOverlap   string = "renderer.fill.flash.Overlap"
+	CfgRenderRegionFillStrategy string = "renderer.fill.region.Strategy"
+	CfgRenderRegionFillAngle    string = "renderer.fill.region.Angle"
+	CfgRenderRegionFillOverlap  string = "renderer.fill.region.Overlap"
+	CfgRenderDrawFillStrategy   string = "renderer.fill.draw.Strategy"
+	CfgRenderDrawFillAngle      string = "renderer.fill.draw.Angle"
+	CfgRenderDrawFillOverlap    string = "renderer.fill.draw.Overlap"
 )
 
 const (
@@ -51,25 +133,108 @@ func SetDefaults(v *viper.Viper) {
 	v.SetDefault(CfgParserSaveIntermediate, true)
 	v.SetDefault(CfgRendererGeneratePNG, true)
 	v.SetDefault(CfgRendererOutFile, "")
+	// the toolpath svg is saved to the png folder
+	v.SetDefault(CfgRendererGenerateSVG, false)
+	v.SetDefault(CfgRendererSVGOutFile, "")
 
-	//
-	v.SetDefault("pcb.xOrigin", 0)
-	v.SetDefault("pcb.yOrigin", 0)
+	// the board transformation: mirroring, then rotation (degrees, counterclockwise), then scaling,
+	// then moving the board origin to xOrigin, yOrigin (mm)
+	v.SetDefault(CfgPcbXOrigin, 0.0)
+	v.SetDefault(CfgPcbYOrigin, 0.0)
+	v.SetDefault(CfgPcbMirrorX, false)
+	v.SetDefault(CfgPcbMirrorY, false)
+	v.SetDefault(CfgPcbRotation, 0.0)
+	v.SetDefault(CfgPcbScale, 1.0)
 
-	//
-	v.SetDefault("renderer.CanvasWidth", 297)
-	v.SetDefault("renderer.CanvasHeight", 210)
+	// the custom paper size, mm
+	v.SetDefault(CfgRenderCanvasWidth, 297)
+	v.SetDefault(CfgRenderCanvasHeight, 210)
+
+	// the sheet: A4, A3, Letter or custom (CanvasWidth x CanvasHeight), landscape or portrait
+	v.SetDefault(CfgPaperSize, "custom")
+	v.SetDefault(CfgPaperOrientation, "landscape")
+	// the blank space around the board, mm
+	v.SetDefault(CfgPaperMargin, 10.0)
+	// the board is turned by 90 degrees if it fits the sheet only this way
+	v.SetDefault(CfgPaperAutoRotate, true)
+	// the board is placed at the lower left corner, in the center or at xOffset, yOffset (mm)
+	v.SetDefault(CfgPaperPlacement, "lowerleft")
+	v.SetDefault(CfgPaperXOffset, 0.0)
+	v.SetDefault(CfgPaperYOffset, 0.0)
+
+	// the title block under the board: the file name, the layer, the date, the scale, the pens and the revision,
+	// the height of the capitals, mm
+	v.SetDefault(CfgTitleEnable, false)
+	v.SetDefault(CfgTitleTextHeight, 2.5)
+	v.SetDefault(CfgTitleRevision, "")
 
 	v.SetDefault(CfgRenderDrawContours, false)
 	v.SetDefault(CfgRenderDrawMoves, false)
 	v.SetDefault(CfgRenderDrawOnlyRegions, false)
+	// the connected D01 segments of a round or a rectangle aperture are drawn as one trace, the other apertures are not chained
+	v.SetDefault(CfgRenderChainTraces, true)
+	// the features at least this wide (mm) are drawn by the widest pen, the other ones by the narrowest pen
+	v.SetDefault(CfgRenderWidePenThreshold, 0.0)
+	// the board without the dark objects is drawn, the board is expanded by the margin (mm)
+	v.SetDefault(CfgRenderNegative, false)
+	v.SetDefault(CfgRenderNegativeMargin, 0.0)
 	v.SetDefault(CfgPrintRegionInfo, false)
 
+	// the board bigger than the sheet is plotted on several sheets overlapped by Overlap (mm),
+	// the sheets are aligned by the registration marks of MarkSize (mm) in the overlap zones
+	v.SetDefault(CfgRenderTilesEnable, false)
+	v.SetDefault(CfgRenderTilesOverlap, 20.0)
+	v.SetDefault(CfgRenderTilesMarkSize, 8.0)
+
+	// the sheet furniture plotted in the margin: the dashed frame of the board, the crop marks at its corners,
+	// the fiducials to align the layers of the double sided board and the scale bar (mm)
+	v.SetDefault(CfgRenderMarksFrame, false)
+	v.SetDefault(CfgRenderMarksCropMarks, false)
+	v.SetDefault(CfgRenderMarksCropMarkLength, 5.0)
+	v.SetDefault(CfgRenderMarksFiducials, false)
+	v.SetDefault(CfgRenderMarksFiducialSize, 5.0)
+	v.SetDefault(CfgRenderMarksScaleBar, false)
+	v.SetDefault(CfgRenderMarksScaleBarLength, 50.0)
+
+	// fill strategies: zigzag, concentric, hatch, unidirectional
+	v.SetDefault(CfgRenderFlashFillStrategy, "zigzag")
+	v.SetDefault(CfgRenderFlashFillAngle, 45.0)
+	v.SetDefault(CfgRenderFlashFillOverlap, 0.0)
+	v.SetDefault(CfgRenderRegionFillStrategy, "zigzag")
+	v.SetDefault(CfgRenderRegionFillAngle, 45.0)
+	v.SetDefault(CfgRenderRegionFillOverlap, 0.0)
+	v.SetDefault(CfgRenderDrawFillStrategy, "zigzag")
+	v.SetDefault(CfgRenderDrawFillAngle, 45.0)
+	v.SetDefault(CfgRenderDrawFillOverlap, 0.0)
+
 	// TODO: something wrong with the default values
 	v.SetDefault(CfgPlotterPenSizes, []float64{0.07, 0.07, 0.07, 0.00})
 	v.SetDefault(CfgPlotterXRes, 0.025)
 	v.SetDefault(CfgPlotterYRes, 0.025)
 	v.SetDefault(CfgPlotterOutFile, "")
+	// the name of the registered plotter backend
+	v.SetDefault(CfgPlotterBackend, "em7052")
+	// the drawing units are reordered to shorten the pen-up travel,
+	// the units drawn by a pen are kept in memory until the pen is changed
+	v.SetDefault(CfgPlotterOptimizeTravel, false)
+	// the working area of the device, mm
+	v.SetDefault(CfgPlotterMaxWidth, 420.0)
+	v.SetDefault(CfgPlotterMaxHeight, 297.0)
+	// HP-GL plotter unit is 0.025 mm
+	v.SetDefault(CfgPlotterHPGLUnitsPerMM, 40)
+	// G-code pen control: "z" moves Z axis, "servo" and "laser" use M3/M5 spindle commands
+	v.SetDefault(CfgPlotterGCodePenMode, "z")
+	v.SetDefault(CfgPlotterGCodePenUpZ, 2.0)
+	v.SetDefault(CfgPlotterGCodePenDownZ, 0.0)
+	v.SetDefault(CfgPlotterGCodeZFeed, 300.0)
+	v.SetDefault(CfgPlotterGCodeServoUp, 50)
+	v.SetDefault(CfgPlotterGCodeServoDown, 30)
+	v.SetDefault(CfgPlotterGCodeServoDwell, 0.2)
+	v.SetDefault(CfgPlotterGCodeLaserPower, 1000)
+	// mm/min, the moves are rapid (G0) if MoveFeed is 0
+	v.SetDefault(CfgPlotterGCodeDrawFeed, 1000.0)
+	v.SetDefault(CfgPlotterGCodeMoveFeed, 0.0)
+	v.SetDefault(CfgPlotterGCodePauseOnPenSwap, true)
 
 	/*
 	   [folders]
@@ -82,6 +247,34 @@ func SetDefaults(v *viper.Viper) {
 	v.SetDefault(CfgFoldersPNGFilesFolder, "")
 }
 
+// returns the pen sizes (mm), the pen N size has index N-1
+// the config file gives []interface{}, the built-in defaults give []float64
+func PenSizes(v *viper.Viper) ([]float64, error) {
+	err := errors.New("penSizes configuration error")
+	retVal := make([]float64, 0)
+	switch arr := v.Get(CfgPlotterPenSizes).(type) {
+	case []interface{}:
+		for _, item := range arr {
+			switch size := item.(type) {
+			case float64:
+				retVal = append(retVal, size)
+			case int64:
+				retVal = append(retVal, float64(size))
+			default:
+				return nil, err
+			}
+		}
+	case []float64:
+		retVal = append(retVal, arr...)
+	default:
+		return nil, err
+	}
+	if len(retVal) == 0 {
+		return nil, err
+	}
+	return retVal, nil
+}
+
 func ProcessConfigFile(v *viper.Viper) error {
 	return v.ReadInConfig()
 	return errors.New("configuration file error. Using defaults")
@@ -0,0 +1,357 @@
+/*
+Simulates EM-7052 plotter running the command stream
+*/
+package emsim
+
+import (
+	"bufio"
+	. "gerberbasetypes"
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// the pens of the device, pen 0 is no pen
+const MaxPenNumber = 4
+
+// the command stream statistic, the lengths are in the plotter steps
+type Statistic struct {
+	Commands   int
+	PenChanges int
+	Moves      int
+	MoveLength float64
+	Lines      int
+	Arcs       int
+	Circles    int
+	DrawLength float64
+}
+
+// the pen trace
+type stroke struct {
+	pen    int
+	points []image.Point
+}
+
+/*
+The simulated device. The commands are executed as the plotter does,
+the arcs start at the current position which is the point of the circle at the start angle,
+so the center is found by the plotter itself.
+*/
+type Simulator struct {
+	// working area, the plotter steps
+	Width, Height int
+	// pen widths in the plotter steps, PenWidths[0] is the width of the pen 1
+	PenWidths []int
+	// the travel moves are drawn to the image too
+	DrawMoves bool
+
+	Stat Statistic
+
+	started bool
+	pen     int
+	x, y    int
+	strokes []stroke
+	moves   []stroke
+}
+
+// creates the simulator of the device with the working area width x height
+func NewSimulator(width, height int, penWidths []int) *Simulator {
+	retVal := new(Simulator)
+	retVal.Width = width
+	retVal.Height = height
+	retVal.PenWidths = penWidths
+	return retVal
+}
+
+// returns the pen and its position
+func (sim *Simulator) Position() (pen, x, y int) {
+	return sim.pen, sim.x, sim.y
+}
+
+// executes the command stream, the error is returned with the line number of the offending command
+func (sim *Simulator) Run(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if err := sim.Exec(scanner.Text()); err != nil {
+			if loc, ok := err.(Locator); ok == true {
+				loc.Locate(line, strings.TrimSpace(scanner.Text()))
+			}
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// splits "XX a , b , c" to the integer arguments
+func args(s string, n int) ([]int, error) {
+	fields := strings.Split(s, ",")
+	if len(fields) != n {
+		return nil, NewParseError("expected " + strconv.Itoa(n) + " arguments")
+	}
+	retVal := make([]int, n)
+	for i := range fields {
+		v, err := strconv.Atoi(strings.TrimSpace(fields[i]))
+		if err != nil {
+			return nil, NewParseError("bad argument " + strings.TrimSpace(fields[i]))
+		}
+		retVal[i] = v
+	}
+	return retVal, nil
+}
+
+// executes one command
+func (sim *Simulator) Exec(cmd string) error {
+	cmd = strings.TrimSpace(cmd)
+	if len(cmd) == 0 {
+		return nil
+	}
+	sim.Stat.Commands++
+	if cmd == "J" {
+		sim.started = true
+		sim.pen = 0
+		sim.x = 0
+		sim.y = 0
+		return nil
+	}
+	if sim.started == false {
+		return NewParseError("the plotter is not reset")
+	}
+	switch {
+	case strings.HasPrefix(cmd, "D C"):
+		a, err := args(cmd[3:], 3)
+		if err != nil {
+			return err
+		}
+		if a[1] != 0 || a[2] != 360 {
+			return NewUnsupportedFeatureError("circle from " + strconv.Itoa(a[1]) + " to " + strconv.Itoa(a[2]) + " degrees")
+		}
+		sim.Stat.Circles++
+		return sim.arc(a[0], a[1], a[2])
+	case strings.HasPrefix(cmd, "DC"):
+		a, err := args(cmd[2:], 3)
+		if err != nil {
+			return err
+		}
+		sim.Stat.Arcs++
+		// the clockwise arcs have the negative radius
+		if a[0] < 0 {
+			return sim.arc(-a[0], a[1], a[2]-360*ceilDiv(a[2]-a[1], 360))
+		}
+		return sim.arc(a[0], a[1], a[2]+360*ceilDiv(a[1]-a[2], 360))
+	case strings.HasPrefix(cmd, "DA"):
+		a, err := args(cmd[2:], 2)
+		if err != nil {
+			return err
+		}
+		sim.Stat.Lines++
+		return sim.draw([]image.Point{{sim.x, sim.y}, {a[0], a[1]}})
+	case strings.HasPrefix(cmd, "MA"):
+		a, err := args(cmd[2:], 2)
+		if err != nil {
+			return err
+		}
+		return sim.move(a[0], a[1])
+	case strings.HasPrefix(cmd, "P"):
+		n, err := strconv.Atoi(strings.TrimSpace(cmd[1:]))
+		if err != nil {
+			return NewParseError("bad pen number")
+		}
+		if n < 0 || n > MaxPenNumber {
+			return NewUnsupportedFeatureError("pen " + strconv.Itoa(n))
+		}
+		if n != sim.pen {
+			sim.Stat.PenChanges++
+		}
+		sim.pen = n
+		return nil
+	}
+	return NewParseError("unknown command")
+}
+
+// the number of the whole turns to make the sweep not negative
+func ceilDiv(a, b int) int {
+	if a <= 0 {
+		return 0
+	}
+	return (a + b - 1) / b
+}
+
+func (sim *Simulator) check(x, y int) error {
+	if x < 0 || y < 0 || x > sim.Width || y > sim.Height {
+		return NewGeometryError("the point (" + strconv.Itoa(x) + "," + strconv.Itoa(y) + ") is out of the working area")
+	}
+	return nil
+}
+
+func (sim *Simulator) move(x, y int) error {
+	if err := sim.check(x, y); err != nil {
+		return err
+	}
+	sim.Stat.Moves++
+	sim.Stat.MoveLength += math.Hypot(float64(x-sim.x), float64(y-sim.y))
+	sim.moves = append(sim.moves, stroke{0, []image.Point{{sim.x, sim.y}, {x, y}}})
+	sim.x = x
+	sim.y = y
+	return nil
+}
+
+// draws the polyline starting at the current position
+func (sim *Simulator) draw(points []image.Point) error {
+	if sim.pen == 0 {
+		return NewGeometryError("drawing without a pen")
+	}
+	for i := range points {
+		if err := sim.check(points[i].X, points[i].Y); err != nil {
+			return err
+		}
+	}
+	for i := 1; i < len(points); i++ {
+		sim.Stat.DrawLength += math.Hypot(float64(points[i].X-points[i-1].X), float64(points[i].Y-points[i-1].Y))
+	}
+	sim.strokes = append(sim.strokes, stroke{sim.pen, points})
+	last := points[len(points)-1]
+	sim.x = last.X
+	sim.y = last.Y
+	return nil
+}
+
+// draws the arc of the radius from the angle fi0 to fi1 (degrees), the arc starts at the current position
+func (sim *Simulator) arc(radius, fi0, fi1 int) error {
+	r := float64(radius)
+	a0 := float64(fi0) * math.Pi / 180
+	a1 := float64(fi1) * math.Pi / 180
+	xc := float64(sim.x) - r*math.Cos(a0)
+	yc := float64(sim.y) - r*math.Sin(a0)
+	// the chord is not longer than a step
+	n := int(math.Ceil(math.Abs(a1-a0) * r))
+	if n < 1 {
+		n = 1
+	}
+	points := make([]image.Point, 0, n+1)
+	points = append(points, image.Point{sim.x, sim.y})
+	for i := 1; i <= n; i++ {
+		a := a0 + (a1-a0)*float64(i)/float64(n)
+		p := image.Point{int(math.Round(xc + r*math.Cos(a))), int(math.Round(yc + r*math.Sin(a)))}
+		if p != points[len(points)-1] {
+			points = append(points, p)
+		}
+	}
+	return sim.draw(points)
+}
+
+// the colors of the pens 1..4 and the travel moves
+var penColors = []color.NRGBA{
+	{0, 0, 0, 255},
+	{0, 0, 255, 255},
+	{255, 0, 0, 255},
+	{0, 128, 0, 255},
+}
+var moveColor = color.NRGBA{192, 192, 192, 255}
+
+/*
+Rasterizes the pen traces, a pixel is a plotter step, the Y axis points up.
+The image covers the drawn area from the origin.
+*/
+func (sim *Simulator) Image() *image.NRGBA {
+	maxX, maxY := 0, 0
+	maxWidth := 1
+	for _, w := range sim.PenWidths {
+		if w > maxWidth {
+			maxWidth = w
+		}
+	}
+	traces := sim.strokes
+	if sim.DrawMoves == true {
+		traces = append(append([]stroke{}, sim.moves...), sim.strokes...)
+	}
+	for i := range traces {
+		for _, p := range traces[i].points {
+			if p.X > maxX {
+				maxX = p.X
+			}
+			if p.Y > maxY {
+				maxY = p.Y
+			}
+		}
+	}
+	img := image.NewNRGBA(image.Rect(0, 0, maxX+maxWidth+1, maxY+maxWidth+1))
+	for i := range img.Pix {
+		img.Pix[i] = 255
+	}
+	for i := range traces {
+		width := 1
+		col := moveColor
+		if pen := traces[i].pen; pen != 0 {
+			col = penColors[(pen-1)%len(penColors)]
+			if pen <= len(sim.PenWidths) && sim.PenWidths[pen-1] > 1 {
+				width = sim.PenWidths[pen-1]
+			}
+		}
+		dot := penDot(width)
+		points := traces[i].points
+		for j := 1; j < len(points); j++ {
+			line(img, points[j-1], points[j], dot, col)
+		}
+	}
+	return img
+}
+
+// the offsets of the pixels covered by the round pen
+func penDot(width int) []image.Point {
+	r := float64(width) / 2
+	ri := width / 2
+	retVal := make([]image.Point, 0)
+	for dy := -ri; dy <= ri; dy++ {
+		for dx := -ri; dx <= ri; dx++ {
+			if math.Hypot(float64(dx), float64(dy)) <= r {
+				retVal = append(retVal, image.Point{dx, dy})
+			}
+		}
+	}
+	return retVal
+}
+
+// draws the line by bresenham, the image rows are flipped
+func line(img *image.NRGBA, p0, p1 image.Point, dot []image.Point, col color.NRGBA) {
+	height := img.Bounds().Dy()
+	dx := abs(p1.X - p0.X)
+	dy := -abs(p1.Y - p0.Y)
+	sx, sy := 1, 1
+	if p0.X > p1.X {
+		sx = -1
+	}
+	if p0.Y > p1.Y {
+		sy = -1
+	}
+	e := dx + dy
+	x, y := p0.X, p0.Y
+	for {
+		for _, d := range dot {
+			img.SetNRGBA(x+d.X, height-1-(y+d.Y), col)
+		}
+		if x == p1.X && y == p1.Y {
+			break
+		}
+		e2 := 2 * e
+		if e2 >= dy {
+			e += dy
+			x += sx
+		}
+		if e2 <= dx {
+			e += dx
+			y += sy
+		}
+	}
+}
+
+func abs(a int) int {
+	if a < 0 {
+		return -a
+	}
+	return a
+}
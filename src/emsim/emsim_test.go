@@ -0,0 +1,101 @@
+package emsim
+
+import (
+	"bytes"
+	. "gerberbasetypes"
+	"plotter"
+	"strings"
+	"testing"
+)
+
+func TestSimulator(t *testing.T) {
+	sim := NewSimulator(1000, 1000, []int{3, 5})
+	stream := "J\nP1\nMA 100 , 100\nDA 200 , 100\nD C10 , 0 , 360\nMA 300 , 300\nDC 50 , 0 , 90\nP2\nDC -50 , 90 , 0\nP0\n"
+	if err := sim.Run(strings.NewReader(stream)); err != nil {
+		t.Fatal(err)
+	}
+	if pen, x, y := sim.Position(); pen != 0 || x != 300 || y != 300 {
+		t.Error("expected pen 0 at (300,300), got", pen, x, y)
+	}
+	expected := Statistic{Commands: 10, PenChanges: 3, Moves: 2, Lines: 1, Arcs: 2, Circles: 1}
+	stat := sim.Stat
+	stat.MoveLength, stat.DrawLength = 0, 0
+	if stat != expected {
+		t.Errorf("expected %+v, got %+v", expected, stat)
+	}
+	img := sim.Image()
+	// the Y axis points up
+	height := img.Bounds().Dy()
+	if img.NRGBAAt(150, height-1-100) != penColors[0] {
+		t.Error("the line is not drawn")
+	}
+	// the arc center is (250,300), the top of the arc is (250,350)
+	if img.NRGBAAt(250, height-1-350) != penColors[1] {
+		t.Error("the arc is not drawn")
+	}
+	if img.NRGBAAt(150, height-1-150) == penColors[0] {
+		t.Error("the move is drawn")
+	}
+}
+
+func TestSimulatorErrors(t *testing.T) {
+	cases := []struct {
+		stream string
+		line   int
+	}{
+		{"P1\n", 1},
+		{"J\nP5\n", 2},
+		{"J\nDA 10 , 10\n", 2},
+		{"J\nP1\nMA 10 , 10\nDA 2000 , 10\n", 4},
+		{"J\nMA -1 , 0\n", 2},
+		{"J\nP1\nMA 10 , 10\nDC 20 , 0 , 90\n", 4},
+		{"J\nMA 10\n", 2},
+		{"J\nXX\n", 2},
+	}
+	for _, c := range cases {
+		err := NewSimulator(100, 100, nil).Run(strings.NewReader(c.stream))
+		if err == nil {
+			t.Error("the error is not found in", c.stream)
+			continue
+		}
+		var line int
+		switch e := err.(type) {
+		case *ParseError:
+			line = e.Line
+		case *UnsupportedFeatureError:
+			line = e.Line
+		case *GeometryError:
+			line = e.Line
+		default:
+			t.Error("unexpected error", err)
+		}
+		if line != c.line {
+			t.Errorf("%v: expected line %d", err, c.line)
+		}
+	}
+}
+
+// the stream of the plotter is executed by the device
+func TestPlotterStream(t *testing.T) {
+	out := new(bytes.Buffer)
+	plt := plotter.NewPlotter(out)
+	plt.Start()
+	plt.TakePen(1)
+	plt.DrawLine(10, 10, 100, 10)
+	plt.Circle(200, 200, 20)
+	plt.Arc(300, 200, 200, 300, 200, 200, 100, 0, 90, IPModeCCwC)
+	plt.Arc(200, 300, 300, 200, 200, 200, 100, 90, 0, IPModeCwC)
+	if err := plt.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	sim := NewSimulator(1000, 1000, []int{3})
+	if err := sim.Run(out); err != nil {
+		t.Fatal(err)
+	}
+	if pen, x, y := sim.Position(); pen != 0 || x != 300 || y != 200 {
+		t.Error("expected pen 0 at (300,200), got", pen, x, y)
+	}
+	if sim.Stat.Lines != 1 || sim.Stat.Circles != 1 || sim.Stat.Arcs != 2 {
+		t.Errorf("unexpected statistic %+v", sim.Stat)
+	}
+}
@@ -221,21 +221,38 @@ var GCmdExtArray = []GerberCommandId{
 
 /* XY initializer */
 
-var lexFS = xy.FormatSpec{"", "", 0, 0, 0, 0, 1.0}
+// the state of the lexer, one instance per input
+type lexer struct {
+	fs xy.FormatSpec
+	// the last coordinates, the base for the modal and incremental coordinates
+	lastXY *xy.XY
+	// the number of the commands created
+	cmdNr int
+}
+
+func newLexer() *lexer {
+	return &lexer{fs: xy.FormatSpec{MU: 1.0, ZeroOmission: xy.OmitLeadingZeros, Notation: xy.AbsoluteNotation}}
+}
 
 // first initialization
-func (gc *GerberCommand) Init() {
+func (gc *GerberCommand) initCmd(lx *lexer) {
 	switch gc.cmd {
 	case FS:
-		lexFS.Init("%FS"+gc.cmdString+"%", "%MOMM*%")
+		lx.fs.Init("%FS"+gc.cmdString+"%", "%MOMM*%")
 	case MO:
 		if gc.cmdString == "IN" {
-			lexFS.MUString = "%MOIN*%"
-			lexFS.MU = xy.InchesToMM
+			lx.fs.MUString = "%MOIN*%"
+			lx.fs.MU = xy.InchesToMM
 		}
+	case G90:
+		lx.fs.Notation = xy.AbsoluteNotation
+	case G91:
+		lx.fs.Notation = xy.IncrementalNotation
 	case D01, D02, D03:
 		gc.xy = xy.NewXY()
-		gc.xy.Init(gc.cmdString+"D", &lexFS, nil)
+		if gc.xy.Init(gc.cmdString+"D", &lx.fs, lx.lastXY) == true {
+			lx.lastXY = gc.xy
+		}
 	case G04, TF, TA:
 
 	default:
@@ -243,8 +260,6 @@ func (gc *GerberCommand) Init() {
 	}
 }
 
-var GerberCommandNr int = 0
-
 type GerberCommand struct {
 	cmd       GerberCommandId
 	cmdString string
@@ -264,11 +279,17 @@ func NewGerberCommand(cmd GerberCommandId) GerberCommand {
 	retVal := new(GerberCommand)
 	retVal.cmd = cmd
 	retVal.cmdString = "<empty>"
-	retVal.cmdNumber = GerberCommandNr
-	GerberCommandNr++
 	return *retVal
 }
 
+// creates the next command of the input
+func (lx *lexer) newCommand(cmd GerberCommandId) GerberCommand {
+	retVal := NewGerberCommand(cmd)
+	retVal.cmdNumber = lx.cmdNr
+	lx.cmdNr++
+	return retVal
+}
+
 type Delim byte
 
 const (
@@ -307,6 +328,7 @@ func FormatGCode(sym string, num string) string {
 }
 
 func SplitByGCommands2(buf []byte) *[]GerberCommand {
+	lx := newLexer()
 	retVal := make([]GerberCommand, 0)
 	extCmdStartPos := -1
 	extCmdEndPos := -1
@@ -333,7 +355,7 @@ func SplitByGCommands2(buf []byte) *[]GerberCommand {
 				extCmdEndPos = i
 			}
 			extCmdString := string(buf[extCmdStartPos+1 : extCmdEndPos])
-			extCmd := parseExtCmd(extCmdString)
+			extCmd := lx.parseExtCmd(extCmdString)
 			if extCmd != nil {
 				retVal = append(retVal, *extCmd)
 			}
@@ -367,7 +389,7 @@ func SplitByGCommands2(buf []byte) *[]GerberCommand {
 							}
 						}
 						if notNumPos < len(baseCmdString) {
-							baseCmd := parseBaseCmd(baseCmdString[:notNumPos])
+							baseCmd := lx.parseBaseCmd(baseCmdString[:notNumPos])
 							baseCmdString = baseCmdString[notNumPos:]
 							if baseCmd != nil {
 								retVal = append(retVal, *baseCmd)
@@ -384,7 +406,7 @@ func SplitByGCommands2(buf []byte) *[]GerberCommand {
 						break
 					}
 				}
-				baseCmd := parseBaseCmd(baseCmdString)
+				baseCmd := lx.parseBaseCmd(baseCmdString)
 				if baseCmd != nil {
 					retVal = append(retVal, *baseCmd)
 				}
@@ -395,19 +417,19 @@ func SplitByGCommands2(buf []byte) *[]GerberCommand {
 		}
 	}
 	for gc := range retVal {
-		retVal[gc].Init()
+		retVal[gc].initCmd(lx)
 	}
 	return &retVal
 }
 
-func parseExtCmd(in string) *GerberCommand {
+func (lx *lexer) parseExtCmd(in string) *GerberCommand {
 	if len(in) < 3 {
 		return nil
 	}
 	retVal := new(GerberCommand)
 	for j := range GCmdExtArray {
 		if in[:2] == GCmdExtArray[j].String() {
-			*retVal = NewGerberCommand(GCmdExtArray[j])
+			*retVal = lx.newCommand(GCmdExtArray[j])
 			(*retVal).cmdString = in[2:]
 			return retVal
 		}
@@ -416,7 +438,7 @@ func parseExtCmd(in string) *GerberCommand {
 	return nil
 }
 
-func parseBaseCmd(in string) *GerberCommand {
+func (lx *lexer) parseBaseCmd(in string) *GerberCommand {
 	in = strings.TrimSpace(in)
 	if len(in) < 2 {
 		return nil
@@ -434,7 +456,7 @@ func parseBaseCmd(in string) *GerberCommand {
 		}
 		for j := range GCmdBaseArray {
 			if cmd == GCmdBaseArray[j].String() {
-				*retVal = NewGerberCommand(GCmdBaseArray[j])
+				*retVal = lx.newCommand(GCmdBaseArray[j])
 				(*retVal).cmdString = cmdString
 				return retVal
 			}
@@ -474,7 +496,7 @@ func parseBaseCmd(in string) *GerberCommand {
 			}
 			for j := range GCmdBaseArray {
 				if cmd == GCmdBaseArray[j].String() {
-					*retVal = NewGerberCommand(GCmdBaseArray[j])
+					*retVal = lx.newCommand(GCmdBaseArray[j])
 					(*retVal).cmdString = cmdString
 					return retVal
 				}
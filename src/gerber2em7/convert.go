@@ -0,0 +1,756 @@
+// Copyright 2018 Vasily Turchenko <turchenkov@gmail.com>. All rights reserved.
+// Use of this source code is free
+
+package gerber2em7
+
+import (
+	"attributes"
+	"bytes"
+	"configurator"
+	"container/list"
+	"context"
+	"errors"
+	"github.com/spf13/viper"
+	"image"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	stor "strings_storage"
+	"time"
+)
+
+import (
+	. "gerberbasetypes"
+	glog "glog_t"
+	"plotter"
+	"render"
+	. "xy"
+)
+
+// the context and the plotter output are checked every ctxCheckInterval rendered steps
+const ctxCheckInterval = 1024
+
+// conversion options
+type Options struct {
+	// configuration, the built-in defaults are used if nil
+	Config *viper.Viper
+	// name of the input, the base of the intermediate file names
+	Name string
+	// the plotter commands are written to Output while rendering,
+	// the stream is returned in Result.Plotter if Output is nil
+	// the tiled plot is returned in Result.Tiles, Output must be nil then
+	Output io.Writer
+	// the toolpath is written as SVG to Toolpath if it is not nil
+	Toolpath io.Writer
+}
+
+// conversion statistic
+type Statistic struct {
+	// number of the steps rendered
+	Steps int
+	// number of the apertures and regions found
+	Apertures int
+	Regions   int
+	// pcb extents, mm
+	MinX, MinY, MaxX, MaxY float64
+	// plotter work, lengths are in mm
+	Lines            int
+	LinesLength      float64
+	Circles          int
+	CirclesLength    float64
+	FilledRectangles int
+	Obrounds         int
+	PenMoves         int
+	MoveDistance     float64
+	// pen-up travel between the drawn objects before and after the optimization, mm
+	// both are 0 if the optimization is off
+	TravelBefore float64
+	TravelAfter  float64
+}
+
+// conversion result
+type Result struct {
+	// plotter commands stream, nil if it is written to Options.Output
+	Plotter []byte
+	// preview image, the Y axis points up
+	Image *image.NRGBA
+	// file attributes (%TF) of the gerber file
+	FileAttributes *attributes.Dictionary
+	Statistic      Statistic
+	// the sheets of the tiled plot in the plotting order, Plotter is nil then
+	// nil if the tiling is off
+	Tiles []Tile
+}
+
+// the state of a single conversion
+type converter struct {
+	ctx context.Context
+
+	// configuration base
+	viperConfig *viper.Viper
+
+	// name of the input
+	name string
+
+	// plotter commands stream destination
+	output io.Writer
+
+	// svg toolpath destination, nil if not requested
+	toolpath io.Writer
+
+	timeStamp time.Time
+
+	// storage of input gerber file strings, the source to feed some processors
+	gerberStrings *stor.Storage
+
+	// array of steps to be executed to generate PCB
+	arrayOfSteps []*render.State
+
+	// the list of regions
+	regionsList *list.List
+
+	// the list of all the apertures
+	aperturesList *list.List
+
+	// the map consisting all the aperture blocks
+	apertureBlocks map[string]*render.BlockAperture
+
+	// aperture macro dictionary
+	aMacroDict []*render.ApertureMacro
+
+	// format specification for the gerber file
+	fSpec *FormatSpec
+
+	// file attributes (%TF) of the gerber file
+	fileAttributes *attributes.Dictionary
+
+	// the transformation of the whole board
+	boardTransform *render.BoardTransform
+
+	//render context
+	renderContext *render.Render
+}
+
+// Converts the gerber file read from r to the plotter commands stream and the preview image.
+// Convert does not use any global state and may be called concurrently.
+// The errors found in the input are *ParseError, *UnsupportedFeatureError or *GeometryError,
+// they carry the source line number and the offending command.
+func Convert(ctx context.Context, r io.Reader, opts Options) (*Result, error) {
+	cv := new(converter)
+	cv.ctx = ctx
+	cv.name = opts.Name
+	cv.viperConfig = opts.Config
+	cv.output = opts.Output
+	cv.toolpath = opts.Toolpath
+	if cv.viperConfig == nil {
+		cv.viperConfig = viper.New()
+		configurator.SetDefaults(cv.viperConfig)
+		// the library call must not leave any files behind
+		cv.viperConfig.Set(configurator.CfgParserSaveIntermediate, false)
+	}
+	cv.timeStamp = time.Now()
+
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = cv.parse(content); err != nil {
+		return nil, err
+	}
+	if err = cv.extractApertures(); err != nil {
+		return nil, err
+	}
+	if err = cv.createSteps(); err != nil {
+		return nil, err
+	}
+	return cv.render()
+}
+
+// splits the input to the strings and searches for the format definition
+func (cv *converter) parse(content []byte) error {
+	cv.printMemUsage("Memory usage before reading input file:")
+
+	cv.gerberStrings = stor.NewStorage()
+	splittedString, lines := TokenizeGerberLines(&content)
+	// feed the storage
+	for k, str := range *splittedString {
+		if attributes.IsAttribute(str) {
+			// attribute names and values are case sensitive
+			cv.printSqueezedOut("Attribute " + str + " is found")
+			cv.gerberStrings.AcceptLine(str, lines[k])
+			continue
+		}
+		cv.gerberStrings.AcceptLine(cv.squeezeString(strings.ToUpper(str)), lines[k])
+	}
+	// save splitted strings to a file
+	if err := cv.saveIntermediate(cv.gerberStrings, cv.name+"_pure_gerber.txt"); err != nil {
+		return err
+	}
+
+	// search for format definition strings
+	mo, err := searchMO(cv.gerberStrings)
+	if err != nil {
+		glog.Warning(err)
+	}
+
+	fs, err := searchFS(cv.gerberStrings)
+	if err != nil {
+		return NewParseError(err.Error())
+	}
+	fsLine := cv.gerberStrings.Line()
+
+	cv.fSpec = new(FormatSpec)
+	if cv.fSpec.Init(fs, mo) == false {
+		return sourceError(NewParseError("can not parse the format specification with "+mo), fsLine, fs)
+	}
+	return nil
+}
+
+// extracts aperture macro definitions, apertures and aperture blocks
+func (cv *converter) extractApertures() error {
+	cv.printMemUsage("Memory usage before extracting apertures:")
+	/* ---------------------- extract aperture macro defs to the am dictionary ----------- */
+	var err error
+	cv.aMacroDict, cv.gerberStrings, err = render.ExtractAMDefinitions(cv.gerberStrings)
+	if err != nil {
+		return err
+	}
+
+	if cv.viperConfig.GetBool(configurator.CfgCommonPrintAperturesInfo) == true {
+		for i := range cv.aMacroDict {
+			glog.Info(cv.aMacroDict[i].String())
+		}
+	}
+
+	/* ---------------------- extract apertures and aperture blocks  --------------------- */
+	gerberStrings2 := stor.NewStorage()
+	cv.aperturesList = list.New()
+	cv.apertureBlocks = make(map[string]*render.BlockAperture)
+	apertureBlockOpened := make([]string, 0)
+	// current aperture attributes dictionary
+	var apertureAttributes *attributes.Dictionary
+	// Aperture processing loop
+	cv.gerberStrings.ResetPos()
+	for {
+		i := cv.gerberStrings.PeekPos()
+		gerberString := cv.gerberStrings.String()
+		if len(gerberString) == 0 {
+			break
+		}
+		line := cv.gerberStrings.Line()
+		// attributes processing
+		// %TF and %TA are consumed here, %TO and %TD are passed to the steps creation
+		if attributes.IsAttribute(gerberString) {
+			attr, err := attributes.Parse(gerberString)
+			if err != nil {
+				return sourceError(NewParseError(err.Error()), line, gerberString)
+			}
+			switch attr.Kind {
+			case attributes.KindFile:
+				cv.fileAttributes = cv.fileAttributes.Set(attr)
+				continue
+			case attributes.KindAperture:
+				apertureAttributes = apertureAttributes.Set(attr)
+				continue
+			case attributes.KindDelete:
+				// file attributes are immutable, %TD deletes aperture and object attributes only
+				apertureAttributes = apertureAttributes.Delete(attr.Name)
+			}
+		}
+		// aperture blocks processing
+		if strings.Compare(gerberString, GerberApertureBlockDefEnd) == 0 {
+			lastOpenedAB := len(apertureBlockOpened) - 1
+			if lastOpenedAB < 0 {
+				return sourceError(NewParseError("no more open aperture blocks left"), line, gerberString)
+			}
+			aperture := new(render.Aperture)
+			aperture.Code = cv.apertureBlocks[apertureBlockOpened[lastOpenedAB]].Code
+			aperture.Type = AptypeBlock
+			aperture.BlockPtr = cv.apertureBlocks[apertureBlockOpened[lastOpenedAB]]
+			aperture.Attributes = aperture.BlockPtr.Attributes
+			aperture.BlockPtr.StepsPtr = make([]*render.State, len(aperture.BlockPtr.BodyStrings)+1)
+			aperture.BlockPtr.StepsPtr[0] = render.NewState()
+			apertureBlockOpened = apertureBlockOpened[:lastOpenedAB]
+			cv.aperturesList.PushBack(aperture) // store correct aperture
+			continue
+		}
+		// new block is met
+		if strings.HasPrefix(gerberString, GerberApertureBlockDef) &&
+			strings.HasSuffix(gerberString, "*%") {
+			// aperture block found
+			apBlk := new(render.BlockAperture)
+			apBlk.StartStringNum = i
+			apBlk.Code, err = strconv.Atoi(gerberString[4 : len(gerberString)-2])
+			if err != nil {
+				return sourceError(NewParseError("bad aperture block code"), line, gerberString)
+			}
+			apBlk.Attributes = apertureAttributes
+			cv.apertureBlocks[gerberString] = apBlk
+			apertureBlockOpened = append(apertureBlockOpened, gerberString)
+			continue
+		}
+
+		if len(apertureBlockOpened) != 0 {
+			last := len(apertureBlockOpened) - 1
+			cv.apertureBlocks[apertureBlockOpened[last]].BodyStrings = append(cv.apertureBlocks[apertureBlockOpened[last]].BodyStrings, gerberString)
+			cv.apertureBlocks[apertureBlockOpened[last]].BodyLines = append(cv.apertureBlocks[apertureBlockOpened[last]].BodyLines, line)
+			continue
+		}
+		/*------------------ aperture blocks processing END ----------------- */
+
+		/*------------------ standard apertures processing  ------------------*/
+		if strings.HasPrefix(gerberString, GerberApertureDef) &&
+			strings.HasSuffix(gerberString, "*%") {
+			aperture, err := render.NewApertureInstance(gerberString, cv.fSpec.ReadMU(), cv.aMacroDict)
+			if err != nil {
+				return sourceError(err, line, gerberString)
+			}
+			aperture.Attributes = apertureAttributes
+			cv.aperturesList.PushBack(aperture)
+			continue
+		}
+		// all unprocessed above goes here
+		gerberStrings2.AcceptLine(gerberString, line)
+	}
+
+	cv.gerberStrings = gerberStrings2
+
+	if err := cv.saveIntermediate(cv.gerberStrings, cv.name+"_before_steps.txt"); err != nil {
+		return err
+	}
+
+	if cv.fileAttributes.Len() != 0 {
+		glog.Infoln("File attributes:", cv.fileAttributes.String())
+	}
+	return nil
+}
+
+// creates the sequence of the steps, unwinds the aperture blocks and SR blocks
+func (cv *converter) createSteps() error {
+	// Main sequence of steps
+	cv.arrayOfSteps = make([]*render.State, cv.gerberStrings.Len()+1)
+	// List of Regions
+	cv.regionsList = list.New()
+
+	//  Aperture blocks must be converted to the steps w/o AB
+	//  S&R blocks and regions inside each instance of AB added to the lists!
+	for apBlock := range cv.apertureBlocks {
+		bsn, err := render.CreateStepSequence(&cv.apertureBlocks[apBlock].BodyStrings,
+			cv.apertureBlocks[apBlock].BodyLines,
+			&cv.apertureBlocks[apBlock].StepsPtr,
+			cv.aperturesList,
+			cv.regionsList,
+			cv.fSpec)
+		if err != nil {
+			return err
+		}
+		cv.apertureBlocks[apBlock].StepsPtr = cv.apertureBlocks[apBlock].StepsPtr[:bsn]
+	}
+
+	cv.printMemUsage("Memory usage before creating Main step sequence:")
+
+	// patch
+	// TODO get rid of the patch!
+	gerberStringsArray := cv.gerberStrings.ToArray()
+
+	numberOfSteps, err := render.CreateStepSequence(&gerberStringsArray,
+		cv.gerberStrings.LinesToArray(),
+		&cv.arrayOfSteps,
+		cv.aperturesList,
+		cv.regionsList,
+		cv.fSpec)
+	if err != nil {
+		return err
+	}
+	cv.arrayOfSteps = cv.arrayOfSteps[1:numberOfSteps]
+
+	if err := cv.ctx.Err(); err != nil {
+		return err
+	}
+
+	/* ------------------ aperture blocks to steps ---------------------------*/
+	// each D03 must be checked against aperture block
+
+	cv.printMemUsage("Memory usage before unwinding aperture blocks:")
+
+	for {
+		touch := false
+		arrayOfSteps2 := make([]*render.State, 0)
+		for k := 0; k < len(cv.arrayOfSteps); k++ {
+			if cv.arrayOfSteps[k].CurrentAp != nil &&
+				cv.arrayOfSteps[k].CurrentAp.Type == AptypeBlock &&
+				cv.arrayOfSteps[k].Action == OpcodeD03_FLASH {
+				for i, bs := range cv.arrayOfSteps[k].CurrentAp.BlockPtr.StepsPtr {
+					if i == 0 { // skip root element
+						continue
+					}
+					newStep := render.NewState()
+					newStep.CopyOfWithTransform(bs, &cv.arrayOfSteps[k].ApTransParams,
+						cv.arrayOfSteps[k].Coord.GetX(), cv.arrayOfSteps[k].Coord.GetY())
+					if i == 1 {
+						newStep.PrevCoord = cv.arrayOfSteps[k].PrevCoord
+					} else {
+						newStep.PrevCoord = arrayOfSteps2[len(arrayOfSteps2)-1].Coord
+					}
+					arrayOfSteps2 = append(arrayOfSteps2, newStep)
+				}
+				touch = true
+			} else {
+				arrayOfSteps2 = append(arrayOfSteps2, cv.arrayOfSteps[k])
+			}
+		}
+		cv.arrayOfSteps, arrayOfSteps2 = arrayOfSteps2, nil
+		if touch == false {
+			break
+		}
+	}
+
+	// unwinding SR blocks
+	cv.printMemUsage("Memory usage before unwinding SR blocks:")
+
+	i := 0
+	for i < len(cv.arrayOfSteps) {
+		if cv.arrayOfSteps[i].SRBlock != nil {
+			insert, tailI := render.UnwindSRBlock(&cv.arrayOfSteps, i)
+			lenTail := len(cv.arrayOfSteps) - tailI
+			tail := make([]*render.State, lenTail)
+			for j := 0; j < lenTail; j++ {
+				tail[j] = render.NewState()
+				tail[j].CopyOfWithOffset(cv.arrayOfSteps[tailI+j], 0, 0)
+			}
+			cv.arrayOfSteps = cv.arrayOfSteps[:i]
+			cv.arrayOfSteps = append(cv.arrayOfSteps, *insert...)
+			cv.arrayOfSteps = append(cv.arrayOfSteps, tail...)
+			i += len(*insert)
+		} else {
+			i++
+		}
+	}
+
+	// the whole board is transformed after all the blocks are unwound
+	cv.boardTransform, err = render.NewBoardTransform(cv.viperConfig)
+	if err != nil {
+		return err
+	}
+	if cv.boardTransform.IsIdentity() == false {
+		glog.Infof("Board transformation: %s; Origin=(%f,%f)\n", cv.boardTransform.String(),
+			cv.boardTransform.XOrigin, cv.boardTransform.YOrigin)
+		cv.arrayOfSteps = cv.boardTransform.Steps(cv.arrayOfSteps)
+	}
+
+	// print regions info
+	if cv.viperConfig.GetBool(configurator.CfgCommonPrintRegionsInfo) == true {
+		j := 0
+		for k := cv.regionsList.Front(); k != nil; k = k.Next() {
+			glog.Infoln("\n" + k.Value.(*render.Aperture).String())
+			j++
+		}
+		glog.Infoln("Total", j, "regions found.")
+	}
+	// print apertures info
+	if cv.viperConfig.GetBool(configurator.CfgCommonPrintAperturesInfo) == true {
+		j := 0
+		for k := cv.aperturesList.Front(); k != nil; k = k.Next() {
+			glog.Infoln("\n" + k.Value.(*render.Aperture).String())
+			j++
+		}
+		glog.Infoln("Total", j, "apertures found.")
+	}
+
+	glog.Infoln("Total", len(cv.arrayOfSteps)-1, "steps to do.")
+	return cv.ctx.Err()
+}
+
+// renders the steps
+func (cv *converter) render() (*Result, error) {
+	retVal := new(Result)
+	retVal.FileAttributes = cv.fileAttributes
+
+	minX, minY, maxX, maxY := cv.extents()
+	// the board is turned to fit the sheet
+	paper, err := render.NewPaper(cv.viperConfig)
+	if err != nil {
+		return nil, err
+	}
+	if paper.NeedsRotation(maxX-minX, maxY-minY) == true {
+		glog.Infoln("The board is turned by 90 degrees to fit the sheet")
+		cv.arrayOfSteps = render.NewQuarterTurn(minX, minY, maxX, maxY).Steps(cv.arrayOfSteps)
+		minX, minY, maxX, maxY = cv.extents()
+	}
+
+	cv.printMemUsage("Memory usage before rendering:")
+
+	glog.Info(timeInfo(cv.timeStamp) + "Rendering process started\n")
+
+	/*
+	   let's render the PCB
+	*/
+	cv.renderContext = new(render.Render)
+	// the drawing is expanded to hold the title block
+	if cv.renderContext.Title, err = cv.titleBlock(); err != nil {
+		return nil, err
+	}
+	if err = cv.renderContext.Init(nil, cv.viperConfig, minX, minY, maxX, maxY); err != nil {
+		return nil, err
+	}
+	backend := cv.viperConfig.GetString(configurator.CfgPlotterBackend)
+	var buffer *bytes.Buffer
+	var plotterInstance plotter.Plotter
+	// each sheet of the tiled plot has its own stream, the commands out of the sheet are cut
+	var tiles []render.Tile
+	var tileBuffers []*bytes.Buffer
+	if cv.renderContext.Tiling == true {
+		if cv.output != nil {
+			return nil, errors.New("the tiled plot can not be written to one output")
+		}
+		tiles = cv.renderContext.Tiles()
+		sheets := make([]plotter.Plotter, len(tiles))
+		tileBuffers = make([]*bytes.Buffer, len(tiles))
+		for i, tile := range tiles {
+			tileBuffers[i] = new(bytes.Buffer)
+			sheet, err := plotter.New(backend, tileBuffers[i], cv.viperConfig)
+			if err != nil {
+				return nil, err
+			}
+			sheets[i] = plotter.NewClipper(sheet, tile.X, tile.Y, tile.Width, tile.Height)
+		}
+		plotterInstance = plotter.NewTee(sheets...)
+		glog.Infoln("The board is plotted on", len(tiles), "sheets")
+	} else {
+		output := cv.output
+		if output == nil {
+			buffer = new(bytes.Buffer)
+			output = buffer
+		}
+		if plotterInstance, err = plotter.New(backend, output, cv.viperConfig); err != nil {
+			return nil, err
+		}
+		// the drawing is placed on the sheet, the commands out of the sheet are cut
+		x, y, width, height := cv.renderContext.Sheet()
+		plotterInstance = plotter.NewClipper(plotterInstance, x, y, width, height)
+	}
+	if cv.toolpath != nil {
+		toolpath, err := plotter.NewSVGPlotter(cv.toolpath, cv.viperConfig)
+		if err != nil {
+			return nil, err
+		}
+		plotterInstance = plotter.NewTee(plotterInstance, toolpath)
+	}
+	var optimizer *plotter.Optimizer
+	if cv.viperConfig.GetBool(configurator.CfgPlotterOptimizeTravel) == true {
+		optimizer = plotter.NewOptimizer(plotterInstance)
+		plotterInstance = optimizer
+	}
+
+	cv.renderContext.Plt = plotterInstance
+	if sizer, ok := plotterInstance.(plotter.Sizer); ok == true {
+		sizer.SetExtents(cv.renderContext.Extents())
+	}
+	if err = plotterInstance.Start(); err != nil {
+		return nil, err
+	}
+	// the negative file is plotted as the positive one in the negative mode
+	if polarity, ok := cv.fileAttributes.Value(attributes.FilePolarity); ok == true && strings.EqualFold(polarity, "Negative") {
+		cv.renderContext.Negative = !cv.renderContext.Negative
+	}
+	if cv.renderContext.Negative == true {
+		glog.Infoln("The negative image is plotted")
+	}
+	glog.Infof("Min. X, Y found: (%f,%f)\n", minX, minY)
+	glog.Infof("Max. X, Y found: (%f,%f)\n", maxX, maxY)
+
+	cv.printMemUsage("Memory usage after render context was initialized:")
+
+	// the border of the drawing area is shown in the png
+	cv.renderContext.DrawFrame()
+
+	// the features of each pen are drawn together to change the pen once
+	stepPens := cv.renderContext.StepPens(cv.arrayOfSteps)
+	lastClear := render.LastClearStep(cv.arrayOfSteps)
+	if cv.renderContext.Negative == true {
+		// all the objects are composed to be subtracted from the board
+		lastClear = len(cv.arrayOfSteps) - 1
+	}
+	chainTraces := cv.viperConfig.GetBool(configurator.CfgRenderChainTraces)
+	// the steps rendered by all the pens
+	rendered := 0
+	for _, pen := range cv.renderContext.Pens() {
+		cv.renderContext.SelectPen(pen)
+		plotterInstance.TakePen(pen)
+		k := 0
+		// the objects up to the last clear one are composed according to their polarity
+		if lastClear >= 0 {
+			if pen == cv.renderContext.CompositePen() {
+				glog.Infoln(timeInfo(cv.timeStamp) + "Composing dark and clear objects")
+				if err := cv.renderContext.RenderComposite(cv.arrayOfSteps[:lastClear+1]); err != nil {
+					return nil, err
+				}
+				rendered += lastClear + 1
+			}
+			k = lastClear + 1
+		}
+		nextCheck := k
+		for k < len(cv.arrayOfSteps) {
+			if cv.arrayOfSteps[k].Action == OpcodeStop {
+				break
+			}
+			if k >= nextCheck {
+				nextCheck = k + ctxCheckInterval
+				if err := cv.ctx.Err(); err != nil {
+					return nil, err
+				}
+				// the output may be closed by the reader
+				if err := plotterInstance.Err(); err != nil {
+					return nil, err
+				}
+			}
+			if stepPens[k] != pen {
+				k++
+				continue
+			}
+			if optimizer != nil {
+				optimizer.BeginUnit()
+			}
+			// the trace of several segments is drawn at once
+			if n := render.TraceLength(cv.arrayOfSteps[k:]); chainTraces == true && n > 1 {
+				if err := cv.renderContext.RenderTrace(cv.arrayOfSteps[k : k+n]); err != nil {
+					return nil, err
+				}
+				rendered += n
+				k += n
+				continue
+			}
+			if err := cv.arrayOfSteps[k].Render(cv.renderContext); err != nil {
+				return nil, err
+			}
+			rendered++
+			k++
+		}
+	}
+
+	// the sheets are aligned by the marks
+	if len(tiles) > 1 {
+		if optimizer != nil {
+			optimizer.BeginUnit()
+		}
+		cv.renderContext.DrawRegistrationMarks(tiles)
+	}
+	// the sheet furniture is drawn by the last pen
+	if cv.renderContext.Marks.Enabled() == true {
+		if optimizer != nil {
+			optimizer.BeginUnit()
+		}
+		cv.renderContext.DrawMarks()
+	}
+	if cv.renderContext.Title != nil {
+		if optimizer != nil {
+			optimizer.BeginUnit()
+		}
+		cv.renderContext.DrawTitle()
+	}
+
+	rc := cv.renderContext
+	retVal.Statistic = Statistic{
+		Steps:            rendered,
+		Apertures:        cv.aperturesList.Len(),
+		Regions:          cv.regionsList.Len(),
+		MinX:             minX,
+		MinY:             minY,
+		MaxX:             maxX,
+		MaxY:             maxY,
+		Lines:            rc.LineBresCounter,
+		LinesLength:      rc.LineBresLen * rc.XRes,
+		Circles:          rc.CircleBresCounter,
+		CirclesLength:    rc.CircleLen * rc.XRes,
+		FilledRectangles: rc.FilledRctCounter,
+		Obrounds:         rc.ObRoundCounter,
+		PenMoves:         rc.MovePenCounters,
+		MoveDistance:     rc.MovePenDistance * rc.XRes,
+	}
+
+	if rc.YNeedsFlip == true {
+		glog.Infoln(timeInfo(cv.timeStamp) + "Started flipping (only png image) over X-axis")
+		imgLines := rc.Img.Bounds().Max.Y - rc.Img.Bounds().Min.Y
+		pixelsInLine := rc.Img.Bounds().Max.X - rc.Img.Bounds().Min.X
+		steps := imgLines / 2
+		for j := 0; j < steps; j++ {
+			for i := 0; i < pixelsInLine; i++ {
+				tmp := rc.Img.At(i, j)
+				rc.Img.Set(i, j, rc.Img.At(i, imgLines-j-1))
+				rc.Img.Set(i, imgLines-j-1, tmp)
+			}
+		}
+	}
+	retVal.Image = rc.Img
+
+	glog.Infoln(timeInfo(cv.timeStamp) + "Rendering process finished")
+
+	if err = plotterInstance.Stop(); err != nil {
+		return nil, err
+	}
+	if optimizer != nil {
+		retVal.Statistic.TravelBefore = optimizer.TravelBefore * rc.XRes
+		retVal.Statistic.TravelAfter = optimizer.TravelAfter * rc.XRes
+	}
+	if buffer != nil {
+		retVal.Plotter = buffer.Bytes()
+	}
+	for i, tile := range tiles {
+		retVal.Tiles = append(retVal.Tiles, Tile{
+			Column:  tile.Column,
+			Row:     tile.Row,
+			X:       float64(tile.X) * rc.XRes,
+			Y:       float64(tile.Y) * rc.YRes,
+			Width:   float64(tile.Width) * rc.XRes,
+			Height:  float64(tile.Height) * rc.YRes,
+			Plotter: tileBuffers[i].Bytes(),
+			Image:   tileImage(rc.Img, tile),
+		})
+	}
+	return retVal, nil
+}
+
+// returns the title block of the plot, nil if it is off
+func (cv *converter) titleBlock() (*render.TitleBlock, error) {
+	layer, _ := cv.fileAttributes.Value(attributes.FileFunction)
+	scale := 1.0
+	if cv.boardTransform != nil {
+		scale = cv.boardTransform.Scale
+	}
+	return render.NewTitleBlock(cv.viperConfig, cv.name, layer, cv.timeStamp, scale)
+}
+
+// returns the extents of the steps coordinates, the moved board keeps the origin
+func (cv *converter) extents() (float64, float64, float64, float64) {
+	var maxX, maxY float64 = 0, 0
+	var minX, minY = 1000000.0, 1000000.0
+	if cv.boardTransform != nil && cv.boardTransform.IsMoved() == true {
+		// the moved board is placed relative to the origin
+		minX, minY = 0, 0
+	}
+	for k := range cv.arrayOfSteps {
+		if cv.arrayOfSteps[k].Coord.GetX() > maxX {
+			maxX = cv.arrayOfSteps[k].Coord.GetX()
+		}
+		if cv.arrayOfSteps[k].Coord.GetX() < minX {
+			minX = cv.arrayOfSteps[k].Coord.GetX()
+		}
+		if cv.arrayOfSteps[k].Coord.GetY() > maxY {
+			maxY = cv.arrayOfSteps[k].Coord.GetY()
+		}
+		if cv.arrayOfSteps[k].Coord.GetY() < minY {
+			minY = cv.arrayOfSteps[k].Coord.GetY()
+		}
+	}
+	return minX, minY, maxX, maxY
+}
+
+// sets the place of the error found in the input
+func sourceError(err error, line int, command string) error {
+	if loc, ok := err.(Locator); ok == true {
+		loc.Locate(line, command)
+	}
+	return err
+}
@@ -5,13 +5,14 @@ package gerber2em7
 
 import (
 	"configurator"
-	"container/list"
+	"context"
 	"errors"
 	"flag"
 	"fmt"
 	"github.com/spf13/viper"
 	"image/png"
-	"io/ioutil"
+	"io"
+	"math"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -25,43 +26,41 @@ import (
 import (
 	. "gerberbasetypes"
 	glog "glog_t"
-	"plotter"
-	"render"
 	. "xy"
 )
 
-import "versiongenerator"
-
-var (
-
-	// configuration base
-	viperConfig *viper.Viper
-
-	// global storage of input gerber file strings, the source to feed some processors
-	gerberStrings *stor.Storage
-
-	// plotter instance which is responsible for generating the command stream for the target device
-	plotterInstance *plotter.PlotterParams
-
-	// array of steps to be executed to generate PCB
-	arrayOfSteps []*render.State
-
-	// the list of regions
-	regionsList *list.List
-
-	// the list of all the apertures
-	aperturesList *list.List
-
-	// the map consisting all the aperture blocks
-	apertureBlocks map[string]*render.BlockAperture
-
-	// format specification for the gerber file
-	fSpec *FormatSpec
+import (
+	"emsim"
+	"render"
+	"versiongenerator"
+)
 
-	//render context
-	renderContext *render.Render
+// process exit codes
+const (
+	ExitOK                 = iota // the conversion is done
+	ExitError                     // input/output or any other error
+	ExitUsage                     // bad command line
+	ExitParseError                // malformed gerber file
+	ExitUnsupportedFeature        // the gerber file uses a feature the converter does not support
+	ExitGeometryError             // an object can not be drawn
 )
 
+// returns the process exit code for the error class
+func ExitCode(err error) int {
+	switch err.(type) {
+	case nil:
+		return ExitOK
+	case *ParseError:
+		return ExitParseError
+	case *UnsupportedFeatureError:
+		return ExitUnsupportedFeature
+	case *GeometryError:
+		return ExitGeometryError
+	default:
+		return ExitError
+	}
+}
+
 func init() {
 	flag.Usage = usage
 }
@@ -69,7 +68,13 @@ func init() {
 func usage() {
 	fmt.Fprintf(os.Stderr, "usage: example -stderrthreshold=[INFO|WARN|FATAL] -log_dir=[string]\n")
 	flag.PrintDefaults()
-	os.Exit(2)
+	os.Exit(ExitUsage)
+}
+
+// flushes the log and exits
+func exit(code int) {
+	glog.Flush()
+	os.Exit(code)
 }
 
 func Main() {
@@ -83,34 +88,48 @@ func Main() {
 
 	var sourceFileName string
 	flag.StringVar(&sourceFileName, "i", "", "input file")
+	var plotterFileName string
+	flag.StringVar(&plotterFileName, "o", "", "plotter output file or device, - writes to stdout")
+	var simFileName string
+	flag.StringVar(&simFileName, "s", "", "EM-7052 plotter file to simulate, the png image is saved")
 
 	flag.Set("stderrthreshold", "ERROR")
 	flag.Set("alsologtostderr", "true")
 	flag.Set("logtostderr", "true")
 
 	flag.Parse()
+	if plotterFileName == "-" {
+		// stdout is the plotter output, the log messages go to stderr
+		flag.Set("stderrthreshold", "INFO")
+	}
 
 	glog.Infoln(returnAppInfo(3))
 
-	viperConfig = viper.New()
+	viperConfig := viper.New()
 	configurator.SetDefaults(viperConfig)
 
 	//	configurator.DiagnosticAllCfgPrint(viperConfig)
 
 	cfgFileError := configurator.ProcessConfigFile(viperConfig)
 	if cfgFileError != nil {
-		fmt.Print("An error has occured: ")
-		fmt.Println(cfgFileError)
-		fmt.Println("Using built-in defaults.")
+		// stdout may be the plotter output
+		fmt.Fprint(os.Stderr, "An error has occured: ")
+		fmt.Fprintln(os.Stderr, cfgFileError)
+		fmt.Fprintln(os.Stderr, "Using built-in defaults.")
 		configurator.SetDefaults(viperConfig)
 	}
 
 	//	configurator.DiagnosticAllCfgPrint(viperConfig)
 
+	if len(simFileName) != 0 {
+		checkError(simulate(viperConfig, simFileName))
+		exit(ExitOK)
+	}
+
 	if len(sourceFileName) == 0 {
-		fmt.Println("No input file specified.\nUsage:")
+		fmt.Fprintln(os.Stderr, "No input file specified.\nUsage:")
 		flag.PrintDefaults()
-		os.Exit(-1)
+		exit(ExitUsage)
 	}
 
 	_, inFileName = filepath.Split(sourceFileName)
@@ -123,338 +142,118 @@ func Main() {
 	//	IntermediateFilesFolder = filepath.FromSlash(viperConfig.Get(configurator.CfgFoldersIntermediateFilesFolder).(string))
 	PNGFilesFolder = filepath.FromSlash(viperConfig.Get(configurator.CfgFoldersPNGFilesFolder).(string))
 
-	//glog.Infoln("folders.PlotterFilesFolder = " + PlotterFilesFolder)
-	//glog.Infoln("folders.IntermediateFilesFolder = " + IntermediateFilesFolder)
-	//glog.Infoln("folders.PNGFilesFolder = " + PNGFilesFolder)
-
-	/*
-	   Process input string
-	*/
-	printMemUsage("Memory usage before reading input file:")
-
-	gerberStrings = stor.NewStorage()
-
-	fSpec = new(FormatSpec)
-
-	content, err := ioutil.ReadFile(sourceFileName)
-	if err != nil {
-		checkError(err)
-	}
-	splittedString := TokenizeGerber(&content)
-	// feed the storage
-	for _, str := range *splittedString {
-		gerberStrings.Accept(squeezeString(strings.ToUpper(str)))
-	}
-	// save splitted strings to a file
-	saveIntermediate(gerberStrings, inFileName+"_pure_gerber.txt")
-
-	// search for format definition strings
-	mo, err := searchMO(gerberStrings)
-	if err != nil {
-		glog.Warning(err)
-	}
-
-	fs, err := searchFS(gerberStrings)
-	checkError(err)
-
-	fSpec = new(FormatSpec)
-	if fSpec.Init(fs, mo) == false {
-		glog.Fatalf("Can not parse: %s \\n %s\n", fs, mo)
-	}
-	printMemUsage("Memory usage before extracting apertures:")
-	/* ---------------------- extract aperture macro defs to the am dictionary ----------- */
-	render.AMacroDict, gerberStrings = render.ExtractAMDefinitions(gerberStrings)
-
-	if viperConfig.GetBool(configurator.CfgCommonPrintAperturesInfo) == true {
-		for i := range render.AMacroDict {
-			glog.Info(render.AMacroDict[i].String())
-		}
-	}
-
-	/* ---------------------- extract apertures and aperture blocks  --------------------- */
-	gerberStrings2 := stor.NewStorage()
-	aperturesList = list.New()
-	apertureBlocks = make(map[string]*render.BlockAperture)
-	apertureBlockOpened := make([]string, 0)
-	// Aperture processing loop
-	gerberStrings.ResetPos()
-	for {
-		i := gerberStrings.PeekPos()
-		gerberString := gerberStrings.String()
-		if len(gerberString) == 0 {
-			break
-		}
-		// aperture blocks processing
-		if strings.Compare(gerberString, GerberApertureBlockDefEnd) == 0 {
-			lastOpenedAB := len(apertureBlockOpened) - 1
-			if lastOpenedAB < 0 {
-				//				panic("No more open aperture blocks left!")
-				glog.Fatalln("No more open aperture blocks left!")
-			}
-			aperture := new(render.Aperture)
-			aperture.Code = apertureBlocks[apertureBlockOpened[lastOpenedAB]].Code
-			aperture.Type = AptypeBlock
-			aperture.BlockPtr = apertureBlocks[apertureBlockOpened[lastOpenedAB]]
-			aperture.BlockPtr.StepsPtr = make([]*render.State, len(aperture.BlockPtr.BodyStrings)+1)
-			aperture.BlockPtr.StepsPtr[0] = render.NewState()
-			apertureBlockOpened = apertureBlockOpened[:lastOpenedAB]
-			aperturesList.PushBack(aperture) // store correct aperture
-			continue
-		}
-		// new block is met
-		if strings.HasPrefix(gerberString, GerberApertureBlockDef) &&
-			strings.HasSuffix(gerberString, "*%") {
-			// aperture block found
-			apBlk := new(render.BlockAperture)
-			apBlk.StartStringNum = i
-			apBlk.Code, err = strconv.Atoi(gerberString[4 : len(gerberString)-2])
-			apertureBlocks[gerberString] = apBlk
-			apertureBlockOpened = append(apertureBlockOpened, gerberString)
-			continue
-		}
-
-		if len(apertureBlockOpened) != 0 {
-			last := len(apertureBlockOpened) - 1
-			apertureBlocks[apertureBlockOpened[last]].BodyStrings = append(apertureBlocks[apertureBlockOpened[last]].BodyStrings, gerberString)
-			continue
-		}
-		/*------------------ aperture blocks processing END ----------------- */
-
-		/*------------------ standard apertures processing  ------------------*/
-		if strings.HasPrefix(gerberString, GerberApertureDef) &&
-			strings.HasSuffix(gerberString, "*%") {
-			aperturesList.PushBack(render.NewApertureInstance(gerberString, fSpec.ReadMU()))
-			continue
-		}
-		// all unprocessed above goes here
-		gerberStrings2.Accept(gerberString)
-	}
-
-	// Global array of commands
-	gerberStrings, gerberStrings2 = gerberStrings2, nil
-
-	saveIntermediate(gerberStrings, inFileName+"_before_steps.txt")
-
-	// Main sequence of steps
-	arrayOfSteps = make([]*render.State, gerberStrings.Len()+1)
-	// Global list of Regions
-	regionsList = list.New()
-
-	//  Aperture blocks must be converted to the steps w/o AB
-	//  S&R blocks and regions inside each instance of AB added to the global lists!
-	for apBlock := range apertureBlocks {
-		bsn := render.CreateStepSequence(&apertureBlocks[apBlock].BodyStrings,
-			&apertureBlocks[apBlock].StepsPtr,
-			aperturesList,
-			regionsList,
-			fSpec)
-		apertureBlocks[apBlock].StepsPtr = apertureBlocks[apBlock].StepsPtr[:bsn]
-	}
-
-	printMemUsage("Memory usage before creating Main step sequence:")
-
-	// patch
-	// TODO get rid of the patch!
-	gerberStringsArray := gerberStrings.ToArray()
-
-	numberOfSteps := render.CreateStepSequence(&gerberStringsArray,
-		&arrayOfSteps,
-		aperturesList,
-		regionsList,
-		fSpec)
-	arrayOfSteps = arrayOfSteps[1:numberOfSteps]
-
-	/* ------------------ aperture blocks to steps ---------------------------*/
-	// each D03 must be checked against aperture block
-
-	printMemUsage("Memory usage before unwinding aperture blocks:")
-
-	//	var touch bool = false
-	for {
-		touch := false
-		arrayOfSteps2 := make([]*render.State, 0)
-		for k := 0; k < len(arrayOfSteps); k++ {
-			if arrayOfSteps[k].CurrentAp != nil &&
-				arrayOfSteps[k].CurrentAp.Type == AptypeBlock &&
-				arrayOfSteps[k].Action == OpcodeD03_FLASH {
-				for i, bs := range arrayOfSteps[k].CurrentAp.BlockPtr.StepsPtr {
-					if i == 0 { // skip root element
-						continue
-					}
-					newStep := render.NewState()
-					newStep.CopyOfWithOffset(bs, arrayOfSteps[k].Coord.GetX(), arrayOfSteps[k].Coord.GetY())
-					if i == 1 {
-						newStep.PrevCoord = arrayOfSteps[k].PrevCoord
-					} else {
-						newStep.PrevCoord = arrayOfSteps2[len(arrayOfSteps2)-1].Coord
-					}
-					arrayOfSteps2 = append(arrayOfSteps2, newStep)
-				}
-				touch = true
-			} else {
-				arrayOfSteps2 = append(arrayOfSteps2, arrayOfSteps[k])
+	// the plotter commands are written while rendering, the sheets of the tiled plot are written after it
+	tiling := viperConfig.GetBool(configurator.CfgRenderTilesEnable)
+	var plotterOut io.Writer
+	var plotterFile *os.File
+	if plotterFileName == "-" && tiling == true {
+		fmt.Fprintln(os.Stderr, "The tiled plot can not be written to stdout.")
+		exit(ExitUsage)
+	}
+	if plotterFileName == "-" {
+		plotterOut = os.Stdout
+		plotterFileName = "stdout"
+	} else {
+		if len(plotterFileName) == 0 {
+			ofNameFromCfg := viperConfig.GetString(configurator.CfgPlotterOutFile)
+			if len(ofNameFromCfg) == 0 {
+				ofNameFromCfg = inFileName + ".plt"
 			}
+			plotterFileName = filepath.Join(filepath.ToSlash(PlotterFilesFolder), ofNameFromCfg)
 		}
-		arrayOfSteps, arrayOfSteps2 = arrayOfSteps2, nil
-		if touch == false {
-			break
+		if tiling == false {
+			var err error
+			plotterFile, err = os.OpenFile(plotterFileName, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+			checkError(err)
+			plotterOut = plotterFile
 		}
 	}
 
-	// unwinding SR blocks
-	printMemUsage("Memory usage before unwinding SR blocks:")
-
-	// unwind SR blocks
-	i := 0
-	for i < len(arrayOfSteps) {
-		if arrayOfSteps[i].SRBlock != nil {
-			insert, tailI := render.UnwindSRBlock(&arrayOfSteps, i)
-			lenTail := len(arrayOfSteps) - tailI
-			tail := make([]*render.State, lenTail)
-			for j := 0; j < lenTail; j++ {
-				//				tail[j] = new(render.State)
-				tail[j] = render.NewState()
-				tail[j].CopyOfWithOffset(arrayOfSteps[tailI+j], 0, 0)
-			}
-			arrayOfSteps = arrayOfSteps[:i]
-			arrayOfSteps = append(arrayOfSteps, *insert...)
-			arrayOfSteps = append(arrayOfSteps, tail...)
-			i += len(*insert)
-		} else {
-			i++
+	// the toolpath is written while rendering too
+	var svgFile *os.File
+	var svgFileName string
+	if viperConfig.GetBool(configurator.CfgRendererGenerateSVG) == true {
+		svgNameFromCfg := viperConfig.GetString(configurator.CfgRendererSVGOutFile)
+		if len(svgNameFromCfg) == 0 {
+			svgNameFromCfg = inFileName + ".svg"
 		}
+		svgFileName = filepath.Join(filepath.ToSlash(PNGFilesFolder), svgNameFromCfg)
+		var err error
+		svgFile, err = os.OpenFile(svgFileName, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		checkError(err)
 	}
 
-	// print regions info
-	if viperConfig.GetBool(configurator.CfgCommonPrintRegionsInfo) == true {
-		j := 0
-		for k := regionsList.Front(); k != nil; k = k.Next() {
-			glog.Infoln("\n" + k.Value.(*render.Aperture).String())
-			j++
+	inFile, err := os.Open(sourceFileName)
+	checkError(err)
+	glog.Infoln(timeInfo(timeStamp)+"Writing plotter commands to", plotterFileName)
+	opts := Options{Config: viperConfig, Name: inFileName, Output: plotterOut}
+	if svgFile != nil {
+		opts.Toolpath = svgFile
+	}
+	result, err := Convert(context.Background(), inFile, opts)
+	inFile.Close()
+	if svgFile != nil {
+		if closeErr := svgFile.Close(); err == nil {
+			err = closeErr
 		}
-		glog.Infoln("Total", j, "regions found.")
-	}
-	// print apertures info
-	if viperConfig.GetBool(configurator.CfgCommonPrintAperturesInfo) == true {
-		j := 0
-		for k := aperturesList.Front(); k != nil; k = k.Next() {
-			glog.Infoln("\n" + k.Value.(*render.Aperture).String())
-			j++
+		if err != nil {
+			os.Remove(svgFileName)
 		}
-		glog.Infoln("Total", j, "apertures found.")
 	}
-
-	glog.Infoln("Total", len(arrayOfSteps)-1, "steps to do.")
-
-	var maxX, maxY float64 = 0, 0
-	var minX, minY = 1000000.0, 1000000.0
-	for k := range arrayOfSteps {
-		if arrayOfSteps[k].Coord.GetX() > maxX {
-			maxX = arrayOfSteps[k].Coord.GetX()
+	if plotterFile != nil {
+		if closeErr := plotterFile.Close(); err == nil {
+			err = closeErr
 		}
-		if arrayOfSteps[k].Coord.GetX() < minX {
-			minX = arrayOfSteps[k].Coord.GetX()
-		}
-		if arrayOfSteps[k].Coord.GetY() > maxY {
-			maxY = arrayOfSteps[k].Coord.GetY()
-		}
-		if arrayOfSteps[k].Coord.GetY() < minY {
-			minY = arrayOfSteps[k].Coord.GetY()
+		if err != nil {
+			// do not leave the incomplete stream
+			os.Remove(plotterFileName)
 		}
 	}
-
-	printMemUsage("Memory usage before rendering:")
-
-	glog.Info(timeInfo(timeStamp) + "Rendering process started\n")
-
-	/*
-	   let's render the PCB
-	*/
-	plotterInstance = plotter.NewPlotter()
-	plotterInstance.TakePen(1)
-
-	ofNameFromCfg := viperConfig.GetString(configurator.CfgPlotterOutFile)
-	if len(ofNameFromCfg) == 0 {
-		ofNameFromCfg = inFileName + ".plt"
+	checkError(err)
+	if tiling == true {
+		checkError(saveTiles(plotterFileName, result.Tiles))
+		glog.Infoln(timeInfo(timeStamp)+"The sheets are listed in", ManifestFileName(plotterFileName))
+	} else {
+		glog.Infoln(timeInfo(timeStamp)+"Plotter commands are saved to", plotterFileName)
 	}
-
-	outfname := filepath.Join(filepath.ToSlash(PlotterFilesFolder), ofNameFromCfg)
-	plotterInstance.SetOutFileName(outfname)
-	renderContext = render.NewRender(plotterInstance, viperConfig, minX, minY, maxX, maxY)
-	glog.Infof("Min. X, Y found: (%f,%f)\n", minX, minY)
-	glog.Infof("Max. X, Y found: (%f,%f)\n", maxX, maxY)
-
-	printMemUsage("Memory usage after render context was initialized:")
-
-	// draw frame by dashed line
-	renderContext.DrawFrame()
-
-	k := 0
-	for k < len(arrayOfSteps) {
-		if arrayOfSteps[k].Action == OpcodeStop {
-			break
-		}
-		//		ProcessStep(arrayOfSteps[k])
-		arrayOfSteps[k].Render(renderContext)
-		k++
+	if svgFile != nil {
+		glog.Infoln(timeInfo(timeStamp)+"Toolpath is saved to the file", svgFileName)
 	}
 
 	if viperConfig.GetBool(configurator.CfgCommonPrintStatistic) == true {
-		glog.Infof("%s%d%s", "The plotter have drawn ", renderContext.LineBresCounter, " straight lines using Brezenham\n")
-		glog.Infof("%s%.0f%s", "Total lenght of straight lines = ", renderContext.LineBresLen*renderContext.XRes, " mm\n")
-		glog.Infof("%s%d%s", "The plotter have drawn ", renderContext.CircleBresCounter, " circles\n")
-		glog.Infof("%s%.0f%s", "Total lenght of circles = ", renderContext.CircleLen*renderContext.XRes, " mm\n")
-		glog.Infoln("The plotter have drawn", renderContext.FilledRctCounter, "filled rectangles")
-		glog.Infoln("The plotter have drawn", renderContext.ObRoundCounter, "obrounds (boxes)")
-		glog.Infoln("The plotter have moved pen", renderContext.MovePenCounters, "times")
-		glog.Infof("%s%.0f%s", "Total move distance = ", renderContext.MovePenDistance*renderContext.XRes, " mm\n")
-	}
-
-	if renderContext.YNeedsFlip == true {
-		glog.Infoln(timeInfo(timeStamp) + "Started flipping (only png image) over X-axis")
-		imgLines := renderContext.Img.Bounds().Max.Y - renderContext.Img.Bounds().Min.Y
-		pixelsInLine := renderContext.Img.Bounds().Max.X - renderContext.Img.Bounds().Min.X
-		steps := imgLines / 2
-		for j := 0; j < steps; j++ {
-			for i := 0; i < pixelsInLine; i++ {
-				tmp := renderContext.Img.At(i, j)
-				renderContext.Img.Set(i, j, renderContext.Img.At(i, imgLines-j-1))
-				renderContext.Img.Set(i, imgLines-j-1, tmp)
-			}
+		stat := result.Statistic
+		glog.Infof("%s%d%s", "The plotter have drawn ", stat.Lines, " straight lines using Brezenham\n")
+		glog.Infof("%s%.0f%s", "Total lenght of straight lines = ", stat.LinesLength, " mm\n")
+		glog.Infof("%s%d%s", "The plotter have drawn ", stat.Circles, " circles\n")
+		glog.Infof("%s%.0f%s", "Total lenght of circles = ", stat.CirclesLength, " mm\n")
+		glog.Infoln("The plotter have drawn", stat.FilledRectangles, "filled rectangles")
+		glog.Infoln("The plotter have drawn", stat.Obrounds, "obrounds (boxes)")
+		glog.Infoln("The plotter have moved pen", stat.PenMoves, "times")
+		glog.Infof("%s%.0f%s", "Total move distance = ", stat.MoveDistance, " mm\n")
+		if viperConfig.GetBool(configurator.CfgPlotterOptimizeTravel) == true {
+			glog.Infof("%s%.0f%s%.0f%s", "Pen-up travel is optimized from ", stat.TravelBefore, " mm to ", stat.TravelAfter, " mm\n")
 		}
 	}
 
-	glog.Infoln(timeInfo(timeStamp) + "Rendering process finished")
-
 	// Save to out.png
 	if viperConfig.GetBool(configurator.CfgRendererGeneratePNG) == true {
-		printMemUsage("Memory usage before png encoding:")
-
-		glog.Infoln(timeInfo(timeStamp)+"Generating png image ", renderContext.Img.Bounds().String())
-		/*
-			ofNameFromCfg := viperConfig.GetString(configurator.CfgPlotterOutFile)
-			if len(ofNameFromCfg) == 0 {
-				ofNameFromCfg = inFileName + ".plt"
-			}
-
-		*/
+		glog.Infoln(timeInfo(timeStamp)+"Generating png image ", result.Image.Bounds().String())
 		pngNameFromCfg := viperConfig.GetString(configurator.CfgRendererOutFile)
 		if len(pngNameFromCfg) == 0 {
 			pngNameFromCfg = inFileName + ".png"
 		}
 		ofname := filepath.Join(filepath.ToSlash(PNGFilesFolder), pngNameFromCfg)
-		f, _ := os.OpenFile(ofname, os.O_WRONLY|os.O_CREATE, 0600)
-		defer f.Close()
-		png.Encode(f, renderContext.Img)
-
+		checkError(savePNG(ofname, result.Image))
 		glog.Infoln(timeInfo(timeStamp)+"Image is saved to the file", ofname)
-		printMemUsage("Memory usage after png encoding:")
+		for i := range result.Tiles {
+			tileName := TileFileName(ofname, &result.Tiles[i])
+			checkError(savePNG(tileName, result.Tiles[i].Image))
+			glog.Infoln(timeInfo(timeStamp)+"Image of the sheet is saved to the file", tileName)
+		}
 	}
 
-	glog.Infoln(timeInfo(timeStamp) + "Saving plotter commands stream to file")
-	plotterInstance.Stop()
-	glog.Infoln(timeInfo(timeStamp)+"Plotter commands are saved to the file", outfname)
-	glog.Exitln(timeInfo(timeStamp) + "Exiting")
+	glog.Infoln(timeInfo(timeStamp) + "Exiting")
+	exit(ExitOK)
 }
 
 ////////////////////////////////////////////////////// end of main ///////////////////////////////////////////////////
@@ -481,6 +280,7 @@ func searchMO(storage *stor.Storage) (string, error) {
 	return GerberMOIN, err
 }
 
+// returns the format specification, both the leading and the trailing zeros omission are accepted
 func searchFS(storage *stor.Storage) (string, error) {
 
 	storage.ResetPos()
@@ -488,14 +288,7 @@ func searchFS(storage *stor.Storage) (string, error) {
 
 	s := storage.String()
 	for len(s) > 0 {
-		if strings.HasPrefix(s, "%FST") {
-			return s, errors.New("trailing zero omission format is not supported") // + 09-Jun-2018
-		}
-		if strings.HasPrefix(s, "%FSLI") || strings.HasPrefix(s, "%FSTI") {
-			return s, errors.New("incremental coordinates ain't supported") // + 09-Jun-2018
-		}
-
-		if strings.HasPrefix(s, GerberFormatSpec) {
+		if strings.HasPrefix(s, GerberFormatSpecPrefix) {
 			return s, nil
 		}
 		s = storage.String()
@@ -506,24 +299,22 @@ func searchFS(storage *stor.Storage) (string, error) {
 /*
 	Saves intermediate results from the strings storage to the file
 */
-func saveIntermediate(storage *stor.Storage, fileName string) {
+func (cv *converter) saveIntermediate(storage *stor.Storage, fileName string) error {
 
-	if viperConfig.GetBool(configurator.CfgParserSaveIntermediate) == false {
-		return
+	if cv.viperConfig.GetBool(configurator.CfgParserSaveIntermediate) == false {
+		return nil
 	}
 
-	fileName = filepath.Join(viperConfig.Get(configurator.CfgFoldersIntermediateFilesFolder).(string), fileName)
+	fileName = filepath.Join(cv.viperConfig.Get(configurator.CfgFoldersIntermediateFilesFolder).(string), fileName)
 
 	file, err := os.OpenFile(fileName, os.O_WRONLY|os.O_CREATE, 0600)
 	if err != nil {
-		//		panic(err)
-		glog.Fatalln(err)
+		return err
 	}
 	defer file.Close()
 	err = file.Truncate(0)
 	if err != nil {
-		//		panic(err)
-		glog.Fatalln(err)
+		return err
 	}
 	storage.ResetPos()
 	for {
@@ -535,33 +326,31 @@ func saveIntermediate(storage *stor.Storage, fileName string) {
 		}
 		_, err = file.WriteString(str + "\n")
 		if err != nil {
-			glog.Fatalln(err)
-			//			panic(err)
+			return err
 		}
 	}
 	file.Sync()
 	err = file.Close()
 	if err != nil {
-		//		panic(err)
-		glog.Fatalln(err)
+		return err
 	}
 	glog.Infoln("Intermediate file " + fileName + " is saved.")
+	return nil
 }
 
-func printSqueezedOut(str string) {
-	if viperConfig.GetBool(configurator.CfgCommonPrintGerberComments) == true {
+func (cv *converter) printSqueezedOut(str string) {
+	if cv.viperConfig.GetBool(configurator.CfgCommonPrintGerberComments) == true {
 		glog.Infoln(str)
 	}
 	return
 }
 
-func squeezeString(inString string) string {
+func (cv *converter) squeezeString(inString string) string {
 	// remove comments and other un-nesessary strings
 	// obsolete commands
-	// attributes - TODO MAKE USE!!!!
 	// strip comments
 	if strings.HasPrefix(inString, "G04") || strings.HasPrefix(inString, "G4") { // +09-Jun-2018
-		printSqueezedOut("Comment " + inString + " is found")
+		cv.printSqueezedOut("Comment " + inString + " is found")
 		return ""
 	}
 	// strip some obsolete commands
@@ -572,20 +361,12 @@ func squeezeString(inString string) string {
 		strings.HasPrefix(inString, "%SF") ||
 		strings.HasPrefix(inString, "%IN") ||
 		strings.HasPrefix(inString, "%LN") {
-		printSqueezedOut("Obsolete command " + inString + " is found")
+		cv.printSqueezedOut("Obsolete command " + inString + " is found")
 		return ""
 	}
 	if strings.Compare(inString, "%SRX1Y1I0J0*%") == 0 { //  +09-Jun-2018
 		return ""
 	}
-	// strip attributes - TODO!!!!!
-	if strings.HasPrefix(inString, "%TF") ||
-		strings.HasPrefix(inString, "%TA") ||
-		strings.HasPrefix(inString, "%TO") ||
-		strings.HasPrefix(inString, "%TD") {
-		printSqueezedOut("Attribute " + inString + " is found")
-		return ""
-	}
 	if strings.Compare(inString, "*") == 0 {
 		return ""
 	}
@@ -595,6 +376,62 @@ func squeezeString(inString string) string {
 	return inString
 }
 
+/*
+	Executes the plotter file by the simulated device and saves the png image of the result
+*/
+func simulate(viperConfig *viper.Viper, fileName string) error {
+	timeStamp := time.Now()
+	xRes := viperConfig.GetFloat64(configurator.CfgPlotterXRes)
+	yRes := viperConfig.GetFloat64(configurator.CfgPlotterYRes)
+	penSizes, err := configurator.PenSizes(viperConfig)
+	if err != nil {
+		return err
+	}
+	penWidths := make([]int, len(penSizes))
+	for i := range penSizes {
+		penWidths[i] = int(math.Round(penSizes[i] / xRes))
+	}
+	// the working area is the sheet
+	paper, err := render.NewPaper(viperConfig)
+	if err != nil {
+		return err
+	}
+	sim := emsim.NewSimulator(transformCoord(paper.Width, xRes), transformCoord(paper.Height, yRes), penWidths)
+	sim.DrawMoves = viperConfig.GetBool(configurator.CfgRenderDrawMoves)
+
+	glog.Infoln(timeInfo(timeStamp)+"Simulating plotter file", fileName)
+	inFile, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	err = sim.Run(inFile)
+	inFile.Close()
+	if err != nil {
+		return err
+	}
+	stat := sim.Stat
+	glog.Infoln("The plotter have executed", stat.Commands, "commands,", stat.PenChanges, "pen changes")
+	glog.Infof("%s%d%s%.0f%s", "The plotter have drawn ", stat.Lines, " lines, ", stat.DrawLength*xRes, " mm total\n")
+	glog.Infoln("The plotter have drawn", stat.Arcs, "arcs and", stat.Circles, "circles")
+	glog.Infof("%s%d%s%.0f%s", "The plotter have moved pen ", stat.Moves, " times, ", stat.MoveLength*xRes, " mm total\n")
+
+	_, name := filepath.Split(fileName)
+	ofname := filepath.Join(filepath.FromSlash(viperConfig.GetString(configurator.CfgFoldersPNGFilesFolder)), name+".png")
+	f, err := os.OpenFile(ofname, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if err = png.Encode(f, sim.Image()); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	glog.Infoln(timeInfo(timeStamp)+"Image is saved to the file", ofname)
+	return nil
+}
+
 // this function returns application info
 func returnAppInfo(verbLevel int) string {
 	var header = "Gerber to EM-7052 translation tool. "
@@ -615,8 +452,8 @@ func returnAppInfo(verbLevel int) string {
 
 // PrintMemUsage outputs the current, total and OS memory being used. As well as the number
 // of garbage collection cycles completed.
-func printMemUsage(header string) {
-	if viperConfig.GetBool(configurator.CfgCommonPrintMemoryInfo) == false {
+func (cv *converter) printMemUsage(header string) {
+	if cv.viperConfig.GetBool(configurator.CfgCommonPrintMemoryInfo) == false {
 		return
 	}
 	var memStats runtime.MemStats
@@ -682,16 +519,36 @@ func abs(x int) int {
 	return 0
 }
 
+// logs the error and exits with the code of the error class
 func checkError(err error) {
 	if err != nil {
-		glog.Fatalln(err)
+		glog.Errorln(err)
+		exit(ExitCode(err))
 	}
 }
 
 /* ----- gerber string tokenizer ------------------------------------ */
 
 func TokenizeGerber(buf *[]byte) *[]string {
+	retVal, _ := TokenizeGerberLines(buf)
+	return retVal
+}
+
+// splits the buffer as TokenizeGerber does and returns the source line number of each string
+func TokenizeGerberLines(buf *[]byte) (*[]string, []int) {
 	retVal := make([]string, 0)
+	lines := make([]int, 0)
+	// the line numbers are counted up to the start of the string being appended
+	line := 1
+	counted := 0
+	lineOf := func(pos int) int {
+		for ; counted < pos; counted++ {
+			if (*buf)[counted] == '\n' {
+				line++
+			}
+		}
+		return line
+	}
 	/*
 		1. if we met '%', all the bytes until next '%' stay unchanged.
 		Leading and trailing '%' are included in the out string
@@ -699,7 +556,7 @@ func TokenizeGerber(buf *[]byte) *[]string {
 		3. each stream of bytes with trailing '*' is treated as separate string
 	*/
 	if len(*buf) < 2 {
-		return &[]string{string(*buf)}
+		return &[]string{string(*buf)}, []int{1}
 	}
 	a := 0
 	b := len(*buf)
@@ -722,6 +579,7 @@ func TokenizeGerber(buf *[]byte) *[]string {
 			}
 			filtered := FilterNewLines(string((*buf)[start:a]))
 			retVal = append(retVal, filtered)
+			lines = append(lines, lineOf(start))
 			continue
 		}
 		if unicode.IsSpace(rune((*buf)[a])) == true {
@@ -759,6 +617,7 @@ func TokenizeGerber(buf *[]byte) *[]string {
 				for {
 					if len(filtered) > 4 && filtered[0] == 'G' && filtered[3] != '*' {
 						retVal = append(retVal, filtered[:3]+"*")
+						lines = append(lines, lineOf(start))
 						filtered = filtered[3:]
 						continue
 					}
@@ -768,10 +627,12 @@ func TokenizeGerber(buf *[]byte) *[]string {
 					//		continue
 					//	}
 					retVal = append(retVal, filtered)
+					lines = append(lines, lineOf(start))
 					break
 				}
 			} else {
 				retVal = append(retVal, filtered)
+				lines = append(lines, lineOf(start))
 			}
 			continue
 		} else {
@@ -779,7 +640,7 @@ func TokenizeGerber(buf *[]byte) *[]string {
 			continue
 		}
 	}
-	return &retVal
+	return &retVal, lines
 }
 
 //filters \n \r symbols from the string
@@ -1,11 +1,22 @@
 package gerber2em7
 
 import (
+	"bytes"
+	"configurator"
+	"context"
+	"emsim"
 	"fmt"
+	"github.com/spf13/viper"
+	"image"
+	"math"
 	"strconv"
+	"strings"
+	"sync"
 	"testing"
 )
 
+import . "gerberbasetypes"
+
 func TestTokenizeGerber(t *testing.T) {
 	testCase1 := []byte("\n\t\t   0000****%1111*******%\n22222")
 	testCase2 := []byte("%11\n\r\tkkkkkkk%\n******G75G03XXX*G04G11zzzz*G4gG11cccc*aaaaa*sssss*dddd*G01*")
@@ -21,3 +32,302 @@ func TestTokenizeGerber(t *testing.T) {
 	}
 
 }
+
+const testGerber = `%FSLAX26Y26*%
+%MOMM*%
+%AMTHX*
+1,1,1.2,0,0*%
+%ADD10C,0.5*%
+%ADD11THX*%
+D10*
+X1000000Y1000000D02*
+G01X5000000Y1000000D01*
+G75G03X9000000Y1000000I2000000J0D01*
+D11*
+X5000000Y5000000D03*
+M02*
+`
+
+func TestConvert(t *testing.T) {
+	const n = 4
+	results := make([]*Result, n)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], errs[i] = Convert(context.Background(), strings.NewReader(testGerber), Options{Name: "test"})
+		}(i)
+	}
+	wg.Wait()
+	for i := 0; i < n; i++ {
+		if errs[i] != nil {
+			t.Fatal(errs[i])
+		}
+		if len(results[i].Plotter) == 0 || results[i].Image == nil {
+			t.Fatal("empty result")
+		}
+		if bytes.Equal(results[i].Plotter, results[0].Plotter) == false {
+			t.Error("concurrent conversions gave different plotter streams")
+		}
+	}
+	if results[0].Statistic.Apertures != 2 {
+		t.Error("expected 2 apertures, got", results[0].Statistic.Apertures)
+	}
+
+	// the stream is executed by the device
+	sim := emsim.NewSimulator(297*40, 210*40, []int{3})
+	if err := sim.Run(bytes.NewReader(results[0].Plotter)); err != nil {
+		t.Error("the simulator failed:", err)
+	}
+	if sim.Stat.Lines == 0 {
+		t.Error("nothing is drawn by the simulator")
+	}
+
+	// the stream written to the output is the same
+	out := new(bytes.Buffer)
+	res, err := Convert(context.Background(), strings.NewReader(testGerber), Options{Output: out})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Plotter != nil || bytes.Equal(out.Bytes(), results[0].Plotter) == false {
+		t.Error("the plotter stream must be written to the output only")
+	}
+
+	// the toolpath does not change the plotter stream
+	toolpath := new(bytes.Buffer)
+	res, err = Convert(context.Background(), strings.NewReader(testGerber), Options{Toolpath: toolpath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(res.Plotter, results[0].Plotter) == false {
+		t.Error("the plotter stream is changed by the toolpath")
+	}
+	if strings.HasSuffix(toolpath.String(), "</svg>\n") == false || strings.Contains(toolpath.String(), "<path d=") == false {
+		t.Error("bad toolpath", toolpath.String())
+	}
+}
+
+func TestConvertErrors(t *testing.T) {
+	// no format specification
+	_, err := Convert(context.Background(), strings.NewReader("%MOMM*%\nM02*\n"), Options{})
+	if err == nil {
+		t.Error("the missing format specification must be reported")
+	}
+	// undefined aperture
+	_, err = Convert(context.Background(), strings.NewReader("%FSLAX26Y26*%\n%MOMM*%\nD12*\nX0Y0D03*\nM02*\n"), Options{})
+	if err == nil {
+		t.Error("the undefined aperture must be reported")
+	}
+	// unknown plotter backend
+	cfg := viper.New()
+	configurator.SetDefaults(cfg)
+	cfg.Set(configurator.CfgParserSaveIntermediate, false)
+	cfg.Set(configurator.CfgPlotterBackend, "none")
+	_, err = Convert(context.Background(), strings.NewReader(testGerber), Options{Config: cfg})
+	if err == nil {
+		t.Error("the unknown plotter backend must be reported")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = Convert(ctx, strings.NewReader(testGerber), Options{})
+	if err != context.Canceled {
+		t.Error("expected context.Canceled, got", err)
+	}
+}
+
+func TestConvertErrorClasses(t *testing.T) {
+	header := "%FSLAX26Y26*%\n%MOMM*%\n%ADD10C,0.5*%\n"
+	cases := []struct {
+		src     string
+		code    int
+		line    int
+		command string
+	}{
+		{"%MOMM*%\nM02*\n", ExitParseError, 0, ""},
+		{header + "D10*\nX0Y0D02*\n\nD12*\nX0Y0D03*\nM02*\n", ExitParseError, 7, "D12*"},
+		{header + "D10*\nX0Y0D02*\nX1Q0Y0D01*\nM02*\n", ExitParseError, 6, "X1Q0Y0D01*"},
+		{header + "%ADD11R,0.5X*%\nM02*\n", ExitParseError, 4, "%ADD11R,0.5X*%"},
+		{header + "%AMT*\n1,1,$1+(2*%\n%ADD11T,1*%\nM02*\n", ExitParseError, 6, "%ADD11T,1*%"},
+		{"%FSLAX26Y26*%\n%MOMM*%\n%AMT*\n9,1,2*%\nM02*\n", ExitUnsupportedFeature, 3, "%AMT*9,1,2*%"},
+		{header + "%TA1bad*%\nM02*\n", ExitParseError, 4, "%TA1bad*%"},
+		{header + "D10*\n%TO.N,GND\n", ExitParseError, 5, "%TO.N,GND"},
+	}
+	for _, c := range cases {
+		_, err := Convert(context.Background(), strings.NewReader(c.src), Options{})
+		if ExitCode(err) != c.code {
+			t.Errorf("%q: expected exit code %d, got %d (%v)", c.src, c.code, ExitCode(err), err)
+			continue
+		}
+		var ref *SourceRef
+		switch e := err.(type) {
+		case *ParseError:
+			ref = &e.SourceRef
+		case *UnsupportedFeatureError:
+			ref = &e.SourceRef
+		}
+		if ref.Command != c.command || (c.line != 0 && ref.Line != c.line) {
+			t.Errorf("%q: expected line %d in %s, got %v", c.src, c.line, c.command, err)
+		}
+	}
+	if ExitCode(nil) != ExitOK || ExitCode(NewGeometryError("")) != ExitGeometryError ||
+		ExitCode(context.Canceled) != ExitError {
+		t.Error("bad exit codes")
+	}
+}
+
+func TestTokenizeGerberLines(t *testing.T) {
+	src := []byte("G04 comment*\n%FSLAX26Y26*%\n\n%AMT*\n1,1,1,0,0*%\nG75G03X0Y0D03*X1*\n")
+	strs, lines := TokenizeGerberLines(&src)
+	expStrs := []string{"G04 comment*", "%FSLAX26Y26*%", "%AMT*1,1,1,0,0*%", "G75*", "G03*", "X0Y0D03*", "X1*"}
+	expLines := []int{1, 2, 4, 6, 6, 6, 6}
+	if len(*strs) != len(expStrs) || len(lines) != len(expLines) {
+		t.Fatal("unexpected strings", *strs, lines)
+	}
+	for i := range expStrs {
+		if (*strs)[i] != expStrs[i] || lines[i] != expLines[i] {
+			t.Errorf("expected %s at line %d, got %s at line %d", expStrs[i], expLines[i], (*strs)[i], lines[i])
+		}
+	}
+}
+
+func TestConvertNegative(t *testing.T) {
+	convert := func(src string, negative bool) []byte {
+		cfg := viper.New()
+		configurator.SetDefaults(cfg)
+		cfg.Set(configurator.CfgParserSaveIntermediate, false)
+		cfg.Set(configurator.CfgRendererGeneratePNG, false)
+		cfg.Set(configurator.CfgRenderNegative, negative)
+		res, err := Convert(context.Background(), strings.NewReader(src), Options{Config: cfg})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res.Plotter
+	}
+	positive := convert(testGerber, false)
+	negative := convert(testGerber, true)
+	if bytes.Equal(positive, negative) == true {
+		t.Fatal("the negative image is the same as the positive one")
+	}
+	sim := emsim.NewSimulator(297*40, 210*40, []int{3})
+	if err := sim.Run(bytes.NewReader(negative)); err != nil {
+		t.Fatal("the simulator failed:", err)
+	}
+
+	// the negative file is inverted by the negative mode
+	negativeFile := strings.Replace(testGerber, "%MOMM*%\n", "%MOMM*%\n%TF.FilePolarity,Negative*%\n", 1)
+	if bytes.Equal(convert(negativeFile, false), negative) == false {
+		t.Error("the negative file is not plotted negative")
+	}
+	if bytes.Equal(convert(negativeFile, true), positive) == false {
+		t.Error("the negative file is not plotted positive in the negative mode")
+	}
+}
+
+func TestConvertTiles(t *testing.T) {
+	// the line is longer than the sheet
+	src := "%FSLAX36Y36*%\n%MOMM*%\n%ADD10C,0.1*%\nD10*\nX0Y0D02*\nX400000000Y0D01*\nM02*\n"
+	cfg := viper.New()
+	configurator.SetDefaults(cfg)
+	cfg.Set(configurator.CfgParserSaveIntermediate, false)
+	cfg.Set(configurator.CfgRenderTilesEnable, true)
+	if _, err := Convert(context.Background(), strings.NewReader(src), Options{Config: cfg, Output: new(bytes.Buffer)}); err == nil {
+		t.Error("the tiled plot is written to one output")
+	}
+	res, err := Convert(context.Background(), strings.NewReader(src), Options{Config: cfg})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Plotter != nil || len(res.Tiles) != 2 {
+		t.Fatal("expected 2 sheets, got", len(res.Tiles))
+	}
+	second := res.Tiles[1]
+	if second.Column != 2 || second.Row != 1 || second.X != 277 || second.Width != 297 || second.Image.Bounds().Dx() != 297*40 {
+		t.Error("bad second sheet", second.Column, second.Row, second.X, second.Width, second.Image.Bounds())
+	}
+	for i := range res.Tiles {
+		sim := emsim.NewSimulator(297*40, 210*40, []int{3})
+		if err := sim.Run(bytes.NewReader(res.Tiles[i].Plotter)); err != nil {
+			t.Fatal("the simulator failed:", err)
+		}
+		// the line and the cross of the mark
+		if sim.Stat.Lines < 3 {
+			t.Error("the sheet", i+1, "is not drawn")
+		}
+	}
+
+	manifest := new(bytes.Buffer)
+	if err := WriteManifest(manifest, "plt/board.plt", res.Tiles); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(manifest.String(), "\n2 board.r1c2.plt 2 1 277.000 0.000 297.000 210.000\n") == false {
+		t.Error("bad manifest\n", manifest.String())
+	}
+}
+
+func TestConvertRectangleDraw(t *testing.T) {
+	// the 45 degrees draw by the rectangle aperture is filled along the whole segment
+	src := "%FSLAX26Y26*%\n%MOMM*%\n%ADD10R,1X0.5*%\nD10*\nX0Y0D02*\nX10000000Y10000000D01*\nM02*\n"
+	cfg := viper.New()
+	configurator.SetDefaults(cfg)
+	cfg.Set(configurator.CfgParserSaveIntermediate, false)
+	cfg.Set(configurator.CfgRendererGeneratePNG, false)
+	res, err := Convert(context.Background(), strings.NewReader(src), Options{Config: cfg})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sim := emsim.NewSimulator(297*40, 210*40, []int{3})
+	if err := sim.Run(bytes.NewReader(res.Plotter)); err != nil {
+		t.Fatal("the simulator failed:", err)
+	}
+	// the swept area is about 15 mm2, it is filled by the strokes of 0.075 mm
+	if sim.Stat.DrawLength < 100*40 {
+		t.Fatal("the draw is not filled, the drawn length is", sim.Stat.DrawLength/40, "mm")
+	}
+	img := sim.Image()
+	bounds := image.Rectangle{Min: img.Bounds().Max, Max: img.Bounds().Min}
+	for y := img.Bounds().Min.Y; y < img.Bounds().Max.Y; y++ {
+		for x := img.Bounds().Min.X; x < img.Bounds().Max.X; x++ {
+			if img.NRGBAAt(x, y).R == 0 {
+				bounds = bounds.Union(image.Rect(x, y, x+1, y+1))
+			}
+		}
+	}
+	// the segment is 10 x 10 mm, the aperture adds 1 mm
+	if bounds.Dx() < 10*40 || bounds.Dx() > 12*40 || bounds.Dy() < 10*40 || bounds.Dy() > 12*40 {
+		t.Fatal("bad extents of the draw", bounds)
+	}
+	center := image.Point{X: (bounds.Min.X + bounds.Max.X) / 2, Y: (bounds.Min.Y + bounds.Max.Y) / 2}
+	if img.NRGBAAt(center.X, center.Y).R != 0 {
+		t.Error("the middle of the draw is not inked", center)
+	}
+}
+
+func TestConvertPens(t *testing.T) {
+	// the fine draws are separated by the move, the pad is drawn by the wide pen
+	src := "%FSLAX26Y26*%\n%MOMM*%\n%ADD10C,0.2*%\n%ADD11R,2X2*%\nD10*\nX0Y0D02*\nX10000000Y0D01*\n" +
+		"X10000000Y20000000D02*\nX20000000Y20000000D01*\nD11*\nX50000000Y0D03*\nM02*\n"
+	convert := func(threshold float64) Statistic {
+		cfg := viper.New()
+		configurator.SetDefaults(cfg)
+		cfg.Set(configurator.CfgParserSaveIntermediate, false)
+		cfg.Set(configurator.CfgRendererGeneratePNG, false)
+		cfg.Set(configurator.CfgPlotterPenSizes, []float64{0.075, 0.3, 0.0, 0.0})
+		cfg.Set(configurator.CfgRenderWidePenThreshold, threshold)
+		res, err := Convert(context.Background(), strings.NewReader(src), Options{Config: cfg})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res.Statistic
+	}
+	one := convert(0)
+	two := convert(1.0)
+	if one.Steps != 5 || two.Steps != 5 {
+		t.Error("expected 5 steps, got", one.Steps, "by one pen and", two.Steps, "by two pens")
+	}
+	// the pad is the last, so the pens travel the same way
+	if two.PenMoves != one.PenMoves || math.Abs(two.MoveDistance-one.MoveDistance) > 1e-6 {
+		t.Error("the moves are lost by two pens:", two.PenMoves, two.MoveDistance, "expected", one.PenMoves, one.MoveDistance)
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright 2018 Vasily Turchenko <turchenkov@gmail.com>. All rights reserved.
+// Use of this source code is free
+
+package gerber2em7
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+import (
+	"render"
+)
+
+// the sheet of the tiled plot
+type Tile struct {
+	// the position of the sheet, counted from 1 from the lower left one
+	Column, Row int
+	// the offset of the sheet origin on the drawing and the sheet size, mm
+	X, Y, Width, Height float64
+	// plotter commands stream of the sheet
+	Plotter []byte
+	// preview image of the sheet, the Y axis points up
+	Image *image.NRGBA
+}
+
+// cuts the sheet out of the flipped image of the drawing
+func tileImage(img *image.NRGBA, tile render.Tile) *image.NRGBA {
+	retVal := image.NewNRGBA(image.Rect(0, 0, tile.Width, tile.Height))
+	top := img.Bounds().Dy() - tile.Y - tile.Height
+	draw.Draw(retVal, retVal.Bounds(), img, image.Point{X: tile.X, Y: top}, draw.Src)
+	return retVal
+}
+
+// returns the file name of the sheet made of the file name of the whole plot: board.plt -> board.r1c2.plt
+func TileFileName(name string, tile *Tile) string {
+	ext := filepath.Ext(name)
+	return strings.TrimSuffix(name, ext) + ".r" + strconv.Itoa(tile.Row) + "c" + strconv.Itoa(tile.Column) + ext
+}
+
+// returns the file name of the manifest made of the file name of the whole plot: board.plt -> board.tiles
+func ManifestFileName(name string) string {
+	return strings.TrimSuffix(name, filepath.Ext(name)) + ".tiles"
+}
+
+/*
+Writes the list of the sheets in the plotting order.
+Each line is: order, file name, column, row, offset of the sheet origin on the drawing and the sheet size (mm).
+The adjacent sheets overlap, the same registration marks are plotted on both ones.
+*/
+func WriteManifest(w io.Writer, name string, tiles []Tile) error {
+	columns, rows := 0, 0
+	for i := range tiles {
+		if tiles[i].Column > columns {
+			columns = tiles[i].Column
+		}
+		if tiles[i].Row > rows {
+			rows = tiles[i].Row
+		}
+	}
+	if _, err := fmt.Fprintf(w, "# %s: %d sheets, %d columns, %d rows\n# order file column row x y width height\n",
+		filepath.Base(name), len(tiles), columns, rows); err != nil {
+		return err
+	}
+	for i := range tiles {
+		t := &tiles[i]
+		if _, err := fmt.Fprintf(w, "%d %s %d %d %.3f %.3f %.3f %.3f\n", i+1, filepath.Base(TileFileName(name, t)),
+			t.Column, t.Row, t.X, t.Y, t.Width, t.Height); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writes the plotter file of each sheet and the manifest, name is the file name of the whole plot
+func saveTiles(name string, tiles []Tile) error {
+	for i := range tiles {
+		if err := ioutil.WriteFile(TileFileName(name, &tiles[i]), tiles[i].Plotter, 0600); err != nil {
+			return err
+		}
+	}
+	f, err := os.OpenFile(ManifestFileName(name), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if err = WriteManifest(f, name, tiles); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// saves the image to the png file
+func savePNG(name string, img image.Image) error {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if err = png.Encode(f, img); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,80 @@
+// Errors found in the gerber source
+package gerberbasetypes
+
+import "strconv"
+
+// the place of an error in the gerber source
+type SourceRef struct {
+	// source line number, 0 if unknown
+	Line int
+	// the offending command
+	Command string
+}
+
+// sets the place of the error if it is not set yet
+func (ref *SourceRef) Locate(line int, command string) {
+	if ref.Line == 0 {
+		ref.Line = line
+	}
+	if len(ref.Command) == 0 {
+		ref.Command = command
+	}
+}
+
+func (ref *SourceRef) where() string {
+	retVal := ""
+	if ref.Line != 0 {
+		retVal = " at line " + strconv.Itoa(ref.Line)
+	}
+	if len(ref.Command) != 0 {
+		retVal = retVal + " in " + ref.Command
+	}
+	return retVal
+}
+
+// the errors which may be attributed to the source implement Locator
+type Locator interface {
+	Locate(line int, command string)
+}
+
+// malformed or inconsistent input
+type ParseError struct {
+	SourceRef
+	Msg string
+}
+
+func NewParseError(msg string) *ParseError {
+	return &ParseError{Msg: msg}
+}
+
+func (e *ParseError) Error() string {
+	return "parse error" + e.where() + ": " + e.Msg
+}
+
+// valid input which can not be converted
+type UnsupportedFeatureError struct {
+	SourceRef
+	Feature string
+}
+
+func NewUnsupportedFeatureError(feature string) *UnsupportedFeatureError {
+	return &UnsupportedFeatureError{Feature: feature}
+}
+
+func (e *UnsupportedFeatureError) Error() string {
+	return "unsupported feature" + e.where() + ": " + e.Feature
+}
+
+// the object can not be drawn
+type GeometryError struct {
+	SourceRef
+	Msg string
+}
+
+func NewGeometryError(msg string) *GeometryError {
+	return &GeometryError{Msg: msg}
+}
+
+func (e *GeometryError) Error() string {
+	return "geometry error" + e.where() + ": " + e.Msg
+}
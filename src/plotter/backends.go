@@ -0,0 +1,59 @@
+/*
+Registry of the plotter backends
+*/
+package plotter
+
+import (
+	"errors"
+	"github.com/spf13/viper"
+	"io"
+	"sort"
+	"sync"
+)
+
+// the backend used if none is configured
+const DefaultBackend = "em7052"
+
+// creates the plotter writing its command stream to w, v is the configuration
+type Factory func(w io.Writer, v *viper.Viper) (Plotter, error)
+
+var (
+	backendsMu sync.RWMutex
+	backends   = make(map[string]Factory)
+)
+
+// makes the backend available by the name, the backends register themselves in init()
+func Register(name string, factory Factory) {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+	if factory == nil {
+		panic("plotter: Register factory is nil")
+	}
+	if _, dup := backends[name]; dup {
+		panic("plotter: Register called twice for backend " + name)
+	}
+	backends[name] = factory
+}
+
+// returns the sorted list of the registered backend names
+func Backends() []string {
+	backendsMu.RLock()
+	defer backendsMu.RUnlock()
+	retVal := make([]string, 0, len(backends))
+	for name := range backends {
+		retVal = append(retVal, name)
+	}
+	sort.Strings(retVal)
+	return retVal
+}
+
+// creates the plotter of the backend selected by the name
+func New(name string, w io.Writer, v *viper.Viper) (Plotter, error) {
+	backendsMu.RLock()
+	factory, ok := backends[name]
+	backendsMu.RUnlock()
+	if ok == false {
+		return nil, errors.New("unknown plotter backend: " + name)
+	}
+	return factory(w, v)
+}
@@ -0,0 +1,33 @@
+package plotter
+
+import (
+	"bytes"
+	"github.com/spf13/viper"
+	"io"
+	"testing"
+)
+
+func TestBackends(t *testing.T) {
+	out := new(bytes.Buffer)
+	plt, err := New(DefaultBackend, out, viper.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := plt.(*PlotterParams); ok == false {
+		t.Error("the default backend must be EM-7052")
+	}
+	if _, err = New("no such backend", out, viper.New()); err == nil {
+		t.Error("the unknown backend must be reported")
+	}
+
+	Register("test", func(w io.Writer, _ *viper.Viper) (Plotter, error) {
+		return NewPlotter(w), nil
+	})
+	found := false
+	for _, name := range Backends() {
+		found = found || name == "test"
+	}
+	if found == false {
+		t.Error("the registered backend is not listed", Backends())
+	}
+}
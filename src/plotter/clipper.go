@@ -0,0 +1,206 @@
+/*
+Passes the part of the drawing inside the window to the plotter, the sheet of the tiled plot
+*/
+package plotter
+
+import (
+	. "gerberbasetypes"
+	"math"
+)
+
+// the window of the drawing in the plotter steps
+type window struct {
+	x0, y0, x1, y1 int
+}
+
+// returns true if the rectangle (x0, y0) - (x1, y1) is inside the window
+func (w *window) contains(x0, y0, x1, y1 int) bool {
+	return x0 >= w.x0 && y0 >= w.y0 && x1 <= w.x1 && y1 <= w.y1
+}
+
+// returns true if the rectangle (x0, y0) - (x1, y1) is outside the window
+func (w *window) misses(x0, y0, x1, y1 int) bool {
+	return x1 < w.x0 || y1 < w.y0 || x0 > w.x1 || y0 > w.y1
+}
+
+/*
+Clips the segment by the window (Liang-Barsky), returns false if nothing is left.
+*/
+func (w *window) clipLine(x0, y0, x1, y1 float64) (float64, float64, float64, float64, bool) {
+	t0, t1 := 0.0, 1.0
+	dx, dy := x1-x0, y1-y0
+	p := [4]float64{-dx, dx, -dy, dy}
+	q := [4]float64{x0 - float64(w.x0), float64(w.x1) - x0, y0 - float64(w.y0), float64(w.y1) - y0}
+	for i := range p {
+		if p[i] == 0 {
+			if q[i] < 0 {
+				return 0, 0, 0, 0, false
+			}
+			continue
+		}
+		t := q[i] / p[i]
+		if p[i] < 0 {
+			if t > t1 {
+				return 0, 0, 0, 0, false
+			}
+			t0 = math.Max(t0, t)
+		} else {
+			if t < t0 {
+				return 0, 0, 0, 0, false
+			}
+			t1 = math.Min(t1, t)
+		}
+	}
+	return x0 + t0*dx, y0 + t0*dy, x0 + t1*dx, y0 + t1*dy, true
+}
+
+type clipper struct {
+	out Plotter
+	window
+	// the pen of out is not where the drawing expects it, the commands out of the window are dropped
+	lost bool
+}
+
+/*
+Returns the plotter which draws the window (x, y, width, height) of the drawing by out,
+the window origin is the origin of out.
+The lines crossing the window border are cut, the arcs and the circles crossing it are drawn by the chords.
+*/
+func NewClipper(out Plotter, x, y, width, height int) Plotter {
+	return &clipper{out: out, window: window{x, y, x + width, y + height}}
+}
+
+// the size of the output is the size of the window
+func (c *clipper) SetExtents(_, _ int) {
+	if sizer, ok := c.out.(Sizer); ok == true {
+		sizer.SetExtents(c.x1-c.x0, c.y1-c.y0)
+	}
+}
+
+func (c *clipper) Start() error {
+	return c.out.Start()
+}
+
+func (c *clipper) Stop() error {
+	return c.out.Stop()
+}
+
+func (c *clipper) Err() error {
+	return c.out.Err()
+}
+
+// the moves out of the window are dropped, the drawing commands move the pen themselves
+func (c *clipper) MoveTo(x, y int) {
+	c.lost = c.contains(x, y, x, y) == false
+	if c.lost == false {
+		c.out.MoveTo(x-c.x0, y-c.y0)
+	}
+}
+
+func (c *clipper) DrawLine(x0, y0, x1, y1 int) {
+	if c.contains(minInt(x0, x1), minInt(y0, y1), maxInt(x0, x1), maxInt(y0, y1)) == true {
+		c.out.DrawLine(x0-c.x0, y0-c.y0, x1-c.x0, y1-c.y0)
+		c.lost = false
+		return
+	}
+	c.lost = true
+	c.drawChord(float64(x0), float64(y0), float64(x1), float64(y1))
+}
+
+// draws the visible part of the segment
+func (c *clipper) drawChord(x0, y0, x1, y1 float64) {
+	x0, y0, x1, y1, ok := c.clipLine(x0, y0, x1, y1)
+	if ok == false {
+		return
+	}
+	c.out.DrawLine(int(math.Round(x0))-c.x0, int(math.Round(y0))-c.y0,
+		int(math.Round(x1))-c.x0, int(math.Round(y1))-c.y0)
+}
+
+func (c *clipper) Circle(xc, yc, r int) {
+	if c.contains(xc-r, yc-r, xc+r, yc+r) == true {
+		c.out.Circle(xc-c.x0, yc-c.y0, r)
+		c.lost = false
+		return
+	}
+	c.lost = true
+	if c.misses(xc-r, yc-r, xc+r, yc+r) == true {
+		return
+	}
+	c.drawChords(xc, yc, r, 0, 2*math.Pi)
+}
+
+func (c *clipper) Arc(x0, y0, x1, y1, xc, yc, radius, fi0, fi1 int, ipm IPmode) {
+	// the angles are taken from the end points, the rounded fi0, fi1 miss the ends of the neighbouring lines
+	phi0, sweep := arcSweep(x0, y0, x1, y1, xc, yc, fi0, fi1, ipm)
+	xs, ys := arcEnd(x0, y0, xc, yc, radius)
+	xe, ye := arcEnd(x1, y1, xc, yc, radius)
+	bx0, by0, bx1, by1 := arcBounds(xs, ys, xe, ye, xc, yc, radius, phi0, sweep)
+	if c.contains(bx0, by0, bx1, by1) == true {
+		if c.lost == true {
+			c.out.MoveTo(x0-c.x0, y0-c.y0)
+		}
+		c.out.Arc(x0-c.x0, y0-c.y0, x1-c.x0, y1-c.y0, xc-c.x0, yc-c.y0, radius, fi0, fi1, ipm)
+		c.lost = false
+		return
+	}
+	c.lost = true
+	if c.misses(bx0, by0, bx1, by1) == true {
+		return
+	}
+	c.drawArcChords(float64(xs), float64(ys), float64(xe), float64(ye), xc, yc, radius,
+		phi0*math.Pi/180.0, sweep*math.Pi/180.0)
+}
+
+// draws the arc by the chords, the chord deviates from the arc by one plotter step at most
+func (c *clipper) drawChords(xc, yc, r int, phi0, sweep float64) {
+	x, y := float64(xc)+float64(r)*math.Cos(phi0), float64(yc)+float64(r)*math.Sin(phi0)
+	c.drawArcChords(x, y, x, y, xc, yc, r, phi0, sweep)
+}
+
+// draws the arc from (x0, y0) to (x1, y1) by the chords, the ends are taken as they are
+// to meet the lines drawn to them
+func (c *clipper) drawArcChords(x0, y0, x1, y1 float64, xc, yc, r int, phi0, sweep float64) {
+	if r <= 0 || sweep == 0 {
+		return
+	}
+	step := math.Pi / 4
+	if r > 1 {
+		step = math.Min(step, 2*math.Acos(1-1/float64(r)))
+	}
+	n := int(math.Ceil(math.Abs(sweep) / step))
+	x, y := x0, y0
+	for i := 1; i <= n; i++ {
+		nx, ny := x1, y1
+		if i < n {
+			phi := phi0 + sweep*float64(i)/float64(n)
+			nx, ny = float64(xc)+float64(r)*math.Cos(phi), float64(yc)+float64(r)*math.Sin(phi)
+		}
+		c.drawChord(x, y, nx, ny)
+		x, y = nx, ny
+	}
+}
+
+// returns the bounding box of the arc: the end points and the extreme points of the circle the arc passes,
+// the angles are in degrees
+func arcBounds(x0, y0, x1, y1, xc, yc, r int, phi0, sweep float64) (int, int, int, int) {
+	bx0, by0, bx1, by1 := minInt(x0, x1), minInt(y0, y1), maxInt(x0, x1), maxInt(y0, y1)
+	lo, hi := phi0, phi0+sweep
+	if sweep < 0 {
+		lo, hi = hi, lo
+	}
+	for fi := 0; fi < 360; fi += 90 {
+		// the extreme point is passed if any of its turns is in the sweep
+		k := math.Ceil((lo - float64(fi)) / 360)
+		if float64(fi)+360*k > hi {
+			continue
+		}
+		x, y := arcPoint(xc, yc, r, fi)
+		bx0, by0, bx1, by1 = minInt(bx0, x), minInt(by0, y), maxInt(bx1, x), maxInt(by1, y)
+	}
+	return bx0, by0, bx1, by1
+}
+
+func (c *clipper) TakePen(penNumber int) {
+	c.out.TakePen(penNumber)
+}
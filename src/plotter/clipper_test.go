@@ -0,0 +1,89 @@
+package plotter
+
+import (
+	"bytes"
+	. "gerberbasetypes"
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestClipper(t *testing.T) {
+	out := new(bytes.Buffer)
+	plt := NewClipper(NewPlotter(out), 100, 100, 200, 100)
+	plt.Start()
+	plt.TakePen(1)
+	// inside, crossing the left border and outside
+	plt.DrawLine(150, 150, 250, 150)
+	plt.DrawLine(0, 120, 200, 120)
+	plt.DrawLine(0, 0, 50, 50)
+	// the circles inside and outside are drawn as they are
+	plt.Circle(200, 150, 20)
+	plt.Circle(1000, 1000, 20)
+	plt.MoveTo(220, 150)
+	plt.Arc(220, 150, 200, 170, 200, 150, 20, 0, 90, IPModeCCwC)
+	// the circle of the arc crosses the border, the arc is inside
+	plt.MoveTo(280, 110)
+	plt.Arc(280, 110, 120, 110, 200, 110, 80, 0, 180, IPModeCCwC)
+	plt.Stop()
+	stream := out.String()
+	for _, cmd := range []string{"MA 50 , 50\nDA 150 , 50\n", "MA 0 , 20\nDA 100 , 20\n", "D C20 , 0 , 360\n",
+		"MA 120 , 50\nDC 20 , 0 , 90\n", "MA 180 , 10\nDC 80 , 0 , 180\n"} {
+		if strings.Contains(stream, cmd) == false {
+			t.Errorf("%q is not found in\n%s", cmd, stream)
+		}
+	}
+	if strings.Count(stream, "DA ") != 2 || strings.Count(stream, "D C") != 1 {
+		t.Error("the commands out of the window are drawn\n", stream)
+	}
+
+	// the circle crossing the border is drawn by the chords inside the window only
+	out.Reset()
+	plt = NewClipper(NewPlotter(out), 100, 100, 200, 100)
+	plt.Start()
+	plt.TakePen(1)
+	plt.Circle(100, 150, 40)
+	plt.Stop()
+	n := 0
+	for _, cmd := range strings.Split(out.String(), "\n") {
+		if strings.HasPrefix(cmd, "DA ") == false {
+			continue
+		}
+		n++
+		xy := strings.Split(cmd[3:], " , ")
+		x, _ := strconv.Atoi(xy[0])
+		y, _ := strconv.Atoi(xy[1])
+		if x < 0 || math.Abs(math.Hypot(float64(x), float64(y-50))-40) > 1.5 {
+			t.Error("bad chord end", cmd)
+		}
+	}
+	if n < 5 {
+		t.Error("the half of the circle is drawn by", n, "chords")
+	}
+}
+
+func TestClipperArcEnds(t *testing.T) {
+	// the arc starts at 22.4 degrees, the chords continue the line drawn to its start point
+	// and end at the crossing of the circle and the border
+	out := new(bytes.Buffer)
+	plt := NewClipper(NewPlotter(out), 0, 0, 10000, 10000)
+	plt.Start()
+	plt.TakePen(1)
+	plt.DrawLine(8000, 6905, 3623, 6905)
+	plt.Arc(3623, 6905, -6000, 5000, -1000, 5000, 5000, 22, 180, IPModeCCwC)
+	plt.Stop()
+	stream := out.String()
+	i := strings.Index(stream, "DA 3623 , 6905\n")
+	if i < 0 || strings.HasPrefix(stream[i+len("DA 3623 , 6905\n"):], "DA ") == false {
+		t.Error("the chords do not start at the end of the line\n", stream)
+	}
+	j := strings.LastIndex(stream, "DA 0 , ")
+	y := 0
+	if j >= 0 {
+		y, _ = strconv.Atoi(strings.SplitN(stream[j+len("DA 0 , "):], "\n", 2)[0])
+	}
+	if y < 9898 || y > 9899 {
+		t.Error("the chords do not end at the border\n", stream)
+	}
+}
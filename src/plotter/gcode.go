@@ -0,0 +1,189 @@
+/*
+Generates a stream of G-code commands for GRBL pen plotters and laser engravers
+*/
+package plotter
+
+import (
+	"configurator"
+	"errors"
+	. "gerberbasetypes"
+	"github.com/spf13/viper"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const GCodeBackend = "gcode"
+
+func init() {
+	Register(GCodeBackend, func(w io.Writer, v *viper.Viper) (Plotter, error) {
+		return NewGCodePlotter(w, v)
+	})
+}
+
+// G-code plotter, the coordinates are in mm, the G0 moves are squeezed as the MA moves of EM-7052
+type GCodePlotter struct {
+	// plotter step size, mm
+	resX, resY float64
+	// pen control commands
+	penUpCmd, penDownCmd string
+	// feed words of the drawing and the moving commands
+	drawFeed, moveFeed string
+	pauseOnPenSwap     bool
+	pen                int
+	penIsDown          bool
+	currentPosX        int
+	currentPosY        int
+	stream
+}
+
+// formats the number for the G-code words
+func gcodeNumber(f float64) string {
+	return strconv.FormatFloat(f, 'f', 3, 64)
+}
+
+// creates the G-code plotter which writes the command stream to w
+// the pen is controlled by Z axis moves, by the servo (M3 S<angle>) or by the laser (M3 S<power>, M5)
+func NewGCodePlotter(w io.Writer, v *viper.Viper) (*GCodePlotter, error) {
+	retVal := new(GCodePlotter)
+	retVal.resX = v.GetFloat64(configurator.CfgPlotterXRes)
+	retVal.resY = v.GetFloat64(configurator.CfgPlotterYRes)
+	if retVal.resX <= 0 || retVal.resY <= 0 {
+		return nil, errors.New("bad G-code plotter resolution")
+	}
+	switch strings.ToLower(v.GetString(configurator.CfgPlotterGCodePenMode)) {
+	case "z":
+		retVal.penUpCmd = "G0 Z" + gcodeNumber(v.GetFloat64(configurator.CfgPlotterGCodePenUpZ)) + "\n"
+		retVal.penDownCmd = "G1 Z" + gcodeNumber(v.GetFloat64(configurator.CfgPlotterGCodePenDownZ)) +
+			" F" + gcodeNumber(v.GetFloat64(configurator.CfgPlotterGCodeZFeed)) + "\n"
+	case "servo":
+		// the servo needs time to move the pen
+		dwell := "G4 P" + gcodeNumber(v.GetFloat64(configurator.CfgPlotterGCodeServoDwell)) + "\n"
+		retVal.penUpCmd = "M3 S" + strconv.Itoa(v.GetInt(configurator.CfgPlotterGCodeServoUp)) + "\n" + dwell
+		retVal.penDownCmd = "M3 S" + strconv.Itoa(v.GetInt(configurator.CfgPlotterGCodeServoDown)) + "\n" + dwell
+	case "laser":
+		retVal.penUpCmd = "M5\n"
+		retVal.penDownCmd = "M3 S" + strconv.Itoa(v.GetInt(configurator.CfgPlotterGCodeLaserPower)) + "\n"
+	default:
+		return nil, errors.New("bad G-code pen mode: " + v.GetString(configurator.CfgPlotterGCodePenMode))
+	}
+	drawFeed := v.GetFloat64(configurator.CfgPlotterGCodeDrawFeed)
+	if drawFeed <= 0 {
+		return nil, errors.New("bad G-code draw feed rate")
+	}
+	retVal.drawFeed = " F" + gcodeNumber(drawFeed)
+	if moveFeed := v.GetFloat64(configurator.CfgPlotterGCodeMoveFeed); moveFeed > 0 {
+		retVal.moveFeed = " F" + gcodeNumber(moveFeed)
+	}
+	retVal.pauseOnPenSwap = v.GetBool(configurator.CfgPlotterGCodePauseOnPenSwap)
+	retVal.init(w)
+	return retVal, nil
+}
+
+// converts the point to the G-code X and Y words
+func (plotter *GCodePlotter) point(x, y int) string {
+	return "X" + gcodeNumber(float64(x)*plotter.resX) + " Y" + gcodeNumber(float64(y)*plotter.resY)
+}
+
+func (plotter *GCodePlotter) raisePen() {
+	if plotter.penIsDown == true {
+		plotter.emit(plotter.penUpCmd)
+		plotter.penIsDown = false
+	}
+}
+
+func (plotter *GCodePlotter) lowerPen() {
+	if plotter.penIsDown == false {
+		plotter.emit(plotter.penDownCmd)
+		plotter.penIsDown = true
+	}
+}
+
+// sets millimeters and absolute coordinates, raises the pen
+func (plotter *GCodePlotter) Start() error {
+	plotter.currentPosX = 0
+	plotter.currentPosY = 0
+	plotter.pen = 0
+	plotter.emit("G21\nG90\nG17\n")
+	plotter.emit(plotter.penUpCmd)
+	plotter.penIsDown = false
+	return plotter.err
+}
+
+// raises the pen, returns to the origin and ends the program
+func (plotter *GCodePlotter) Stop() error {
+	plotter.TakePen(0)
+	plotter.MoveTo(0, 0)
+	plotter.emit("M2\n")
+	return plotter.finish()
+}
+
+func (plotter *GCodePlotter) MoveTo(x, y int) {
+	plotter.raisePen()
+	plotter.currentPosX = x
+	plotter.currentPosY = y
+	if len(plotter.moveFeed) == 0 {
+		plotter.move("G0 " + plotter.point(x, y) + "\n")
+	} else {
+		plotter.move("G1 " + plotter.point(x, y) + plotter.moveFeed + "\n")
+	}
+}
+
+func (plotter *GCodePlotter) DrawLine(x0, y0, x1, y1 int) {
+	if (plotter.currentPosX != x0) || (plotter.currentPosY != y0) {
+		plotter.MoveTo(x0, y0)
+	}
+	plotter.lowerPen()
+	plotter.currentPosX = x1
+	plotter.currentPosY = y1
+	plotter.emit("G1 " + plotter.point(x1, y1) + plotter.drawFeed + "\n")
+}
+
+// the full circle starts at the rightmost point
+func (plotter *GCodePlotter) Circle(xc, yc, r int) {
+	plotter.MoveTo(xc+r, yc)
+	plotter.lowerPen()
+	plotter.emit("G3 " + plotter.point(xc+r, yc) + " I" + gcodeNumber(-float64(r)*plotter.resX) + " J0.000" +
+		plotter.drawFeed + "\n")
+	plotter.MoveTo(xc, yc)
+}
+
+// the arc of the circle (xc, yc, radius) is drawn by G2 (clockwise) or G3 with the center offset,
+// the arc of the track center line goes exactly between its ends (x0, y0) and (x1, y1)
+func (plotter *GCodePlotter) Arc(x0, y0, x1, y1, xc, yc, radius, fi0, fi1 int, ipm IPmode) {
+	xs, ys := arcEnd(x0, y0, xc, yc, radius)
+	xe, ye := arcEnd(x1, y1, xc, yc, radius)
+	if (plotter.currentPosX != xs) || (plotter.currentPosY != ys) {
+		plotter.MoveTo(xs, ys)
+	}
+	cmd := "G3 "
+	if ipm == IPModeCwC {
+		cmd = "G2 "
+	}
+	plotter.lowerPen()
+	plotter.emit(cmd + plotter.point(xe, ye) +
+		" I" + gcodeNumber(float64(xc-xs)*plotter.resX) + " J" + gcodeNumber(float64(yc-ys)*plotter.resY) +
+		plotter.drawFeed + "\n")
+	plotter.currentPosX = xe
+	plotter.currentPosY = ye
+}
+
+// the program is paused to change the pen, pen 0 only raises the pen
+func (plotter *GCodePlotter) TakePen(penNumber int) {
+	if err := checkPen(penNumber); err != nil {
+		plotter.fail(err)
+		return
+	}
+	plotter.raisePen()
+	if penNumber == plotter.pen {
+		return
+	}
+	if penNumber != 0 {
+		if plotter.pen != 0 && plotter.pauseOnPenSwap == true {
+			plotter.emit("M0 (take pen " + strconv.Itoa(penNumber) + ")\n")
+		} else {
+			plotter.emit("(pen " + strconv.Itoa(penNumber) + ")\n")
+		}
+	}
+	plotter.pen = penNumber
+}
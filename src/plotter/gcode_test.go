@@ -0,0 +1,66 @@
+package plotter
+
+import (
+	"bytes"
+	"configurator"
+	. "gerberbasetypes"
+	"github.com/spf13/viper"
+	"testing"
+)
+
+func TestGCodePlotter(t *testing.T) {
+	v := viper.New()
+	configurator.SetDefaults(v)
+	v.Set(configurator.CfgPlotterXRes, 0.5)
+	v.Set(configurator.CfgPlotterYRes, 0.5)
+	v.Set(configurator.CfgPlotterGCodePenMode, "laser")
+	out := new(bytes.Buffer)
+	plt, err := New(GCodeBackend, out, v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := plt.Start(); err != nil {
+		t.Fatal(err)
+	}
+	plt.TakePen(1)
+	plt.MoveTo(5, 5)
+	plt.DrawLine(10, 10, 20, 10)
+	plt.DrawLine(20, 10, 20, 20)
+	// quarter of the circle of radius 10 around (20, 30)
+	plt.Arc(30, 30, 20, 40, 20, 30, 10, 0, 90, IPModeCCwC)
+	plt.Arc(20, 40, 30, 30, 20, 30, 10, 90, 0, IPModeCwC)
+	// the end at 53.13 degrees is not moved to the rounded angle
+	plt.Arc(1000, 0, 600, 800, 0, 0, 1000, 0, 53, IPModeCCwC)
+	plt.TakePen(2)
+	plt.Circle(50, 50, 10)
+	if err := plt.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	expected := "G21\nG90\nG17\nM5\n(pen 1)\n" +
+		"G0 X5.000 Y5.000\nM3 S1000\nG1 X10.000 Y5.000 F1000.000\nG1 X10.000 Y10.000 F1000.000\n" +
+		"M5\nG0 X15.000 Y15.000\nM3 S1000\nG3 X10.000 Y20.000 I-5.000 J0.000 F1000.000\n" +
+		"G2 X15.000 Y15.000 I0.000 J-5.000 F1000.000\n" +
+		"M5\nG0 X500.000 Y0.000\nM3 S1000\nG3 X300.000 Y400.000 I-500.000 J0.000 F1000.000\n" +
+		"M5\nM0 (take pen 2)\nG0 X30.000 Y25.000\nM3 S1000\nG3 X30.000 Y25.000 I-5.000 J0.000 F1000.000\n" +
+		"M5\nG0 X0.000 Y0.000\nM2\n"
+	if out.String() != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, out.String())
+	}
+
+	v.Set(configurator.CfgPlotterGCodePenMode, "pencil")
+	if _, err = New(GCodeBackend, out, v); err == nil {
+		t.Error("the bad pen mode must be reported")
+	}
+	v.Set(configurator.CfgPlotterGCodePenMode, "z")
+	v.Set(configurator.CfgPlotterGCodeMoveFeed, 3000)
+	out.Reset()
+	plt, _ = New(GCodeBackend, out, v)
+	plt.MoveTo(2, 2)
+	plt.DrawLine(2, 2, 4, 4)
+	plt.Stop()
+	expected = "G1 X1.000 Y1.000 F3000.000\nG1 Z0.000 F300.000\nG1 X2.000 Y2.000 F1000.000\n" +
+		"G0 Z2.000\nG1 X0.000 Y0.000 F3000.000\nM2\n"
+	if out.String() != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, out.String())
+	}
+}
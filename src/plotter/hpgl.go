@@ -0,0 +1,108 @@
+/*
+Generates a stream of HP-GL commands
+*/
+package plotter
+
+import (
+	"configurator"
+	"errors"
+	. "gerberbasetypes"
+	"github.com/spf13/viper"
+	"io"
+	"math"
+	"strconv"
+)
+
+const HPGLBackend = "hpgl"
+
+func init() {
+	Register(HPGLBackend, func(w io.Writer, v *viper.Viper) (Plotter, error) {
+		return NewHPGLPlotter(w, v)
+	})
+}
+
+// HP-GL plotter, the PU moves are squeezed as the MA moves of EM-7052
+type HPGLPlotter struct {
+	// plotter steps to HP-GL units
+	scaleX, scaleY float64
+	currentPosX    int
+	currentPosY    int
+	stream
+}
+
+// creates the HP-GL plotter which writes the command stream to w
+// the coordinates are converted from the plotter steps (plotter.xRes, plotter.yRes) to the HP-GL units
+func NewHPGLPlotter(w io.Writer, v *viper.Viper) (*HPGLPlotter, error) {
+	retVal := new(HPGLPlotter)
+	units := v.GetFloat64(configurator.CfgPlotterHPGLUnitsPerMM)
+	retVal.scaleX = v.GetFloat64(configurator.CfgPlotterXRes) * units
+	retVal.scaleY = v.GetFloat64(configurator.CfgPlotterYRes) * units
+	if retVal.scaleX <= 0 || retVal.scaleY <= 0 {
+		return nil, errors.New("bad HP-GL plotter resolution")
+	}
+	retVal.init(w)
+	return retVal, nil
+}
+
+// converts the point to HP-GL coordinates string
+func (plotter *HPGLPlotter) point(x, y int) string {
+	return strconv.Itoa(int(math.Round(float64(x)*plotter.scaleX))) + "," +
+		strconv.Itoa(int(math.Round(float64(y)*plotter.scaleY)))
+}
+
+func (plotter *HPGLPlotter) Start() error {
+	plotter.currentPosX = 0
+	plotter.currentPosY = 0
+	plotter.emit("IN;\n")
+	return plotter.err
+}
+
+// puts the pen away, the trailing PU is dropped
+func (plotter *HPGLPlotter) Stop() error {
+	plotter.TakePen(0)
+	plotter.MoveTo(0, 0)
+	return plotter.finish()
+}
+
+func (plotter *HPGLPlotter) MoveTo(x, y int) {
+	plotter.currentPosX = x
+	plotter.currentPosY = y
+	plotter.move("PU" + plotter.point(x, y) + ";\n")
+}
+
+func (plotter *HPGLPlotter) DrawLine(x0, y0, x1, y1 int) {
+	if (plotter.currentPosX != x0) || (plotter.currentPosY != y0) {
+		plotter.MoveTo(x0, y0)
+	}
+	plotter.currentPosX = x1
+	plotter.currentPosY = y1
+	plotter.emit("PD" + plotter.point(x1, y1) + ";\n")
+}
+
+// CI draws the circle around the current position
+func (plotter *HPGLPlotter) Circle(xc, yc, r int) {
+	plotter.MoveTo(xc, yc)
+	plotter.emit("CI" + strconv.Itoa(int(math.Round(float64(r)*plotter.scaleX))) + ";\n")
+}
+
+// the arc of the circle (xc, yc, radius) goes between the rays through the ends of the track center line,
+// the sweep is taken from the exact angles of the ends, the rounded angles fi0, fi1 are used for the full circle only
+func (plotter *HPGLPlotter) Arc(x0, y0, x1, y1, xc, yc, radius, fi0, fi1 int, ipm IPmode) {
+	xs, ys := arcEnd(x0, y0, xc, yc, radius)
+	xe, ye := arcEnd(x1, y1, xc, yc, radius)
+	if (plotter.currentPosX != xs) || (plotter.currentPosY != ys) {
+		plotter.MoveTo(xs, ys)
+	}
+	_, sweep := arcSweep(x0, y0, x1, y1, xc, yc, fi0, fi1, ipm)
+	plotter.emit("PD;AA" + plotter.point(xc, yc) + "," + strconv.FormatFloat(math.Round(sweep*100)/100, 'f', -1, 64) + ";\n")
+	plotter.MoveTo(xe, ye)
+}
+
+// SP0 puts the pen away
+func (plotter *HPGLPlotter) TakePen(penNumber int) {
+	if err := checkPen(penNumber); err != nil {
+		plotter.fail(err)
+		return
+	}
+	plotter.emit("SP" + strconv.Itoa(penNumber) + ";\n")
+}
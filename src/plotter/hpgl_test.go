@@ -0,0 +1,51 @@
+package plotter
+
+import (
+	"bytes"
+	"configurator"
+	. "gerberbasetypes"
+	"github.com/spf13/viper"
+	"testing"
+)
+
+func TestHPGLPlotter(t *testing.T) {
+	v := viper.New()
+	configurator.SetDefaults(v)
+	// 0.05 mm steps are 2 HP-GL units
+	v.Set(configurator.CfgPlotterXRes, 0.05)
+	v.Set(configurator.CfgPlotterYRes, 0.05)
+	out := new(bytes.Buffer)
+	plt, err := New(HPGLBackend, out, v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := plt.Start(); err != nil {
+		t.Fatal(err)
+	}
+	plt.TakePen(1)
+	plt.MoveTo(5, 5)
+	plt.DrawLine(10, 10, 20, 10)
+	plt.DrawLine(20, 10, 20, 20)
+	plt.Circle(50, 50, 10)
+	// quarter of the circle of radius 10 around (20, 30)
+	plt.Arc(30, 30, 20, 40, 20, 30, 10, 0, 90, IPModeCCwC)
+	plt.Arc(20, 40, 30, 30, 20, 30, 10, 90, 0, IPModeCwC)
+	// the inner track of the same arc
+	plt.Arc(30, 30, 20, 40, 20, 30, 5, 0, 90, IPModeCCwC)
+	// the sweep of 53.13 degrees is not rounded to the whole degrees
+	plt.Arc(30, 30, 26, 38, 20, 30, 10, 0, 53, IPModeCCwC)
+	if err := plt.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	expected := "IN;\nSP1;\nPU20,20;\nPD40,20;\nPD40,40;\nPU100,100;\nCI20;\n" +
+		"PU60,60;\nPD;AA40,60,90;\nPU40,80;\nPD;AA40,60,-90;\nPU50,60;\nPD;AA40,60,90;\nPU60,60;\nPD;AA40,60,53.13;\nPU52,76;\nSP0;\n"
+	if out.String() != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, out.String())
+	}
+
+	plt, _ = New(HPGLBackend, out, v)
+	plt.TakePen(9)
+	if plt.Stop() == nil {
+		t.Error("the bad pen number must be reported")
+	}
+}
@@ -0,0 +1,378 @@
+/*
+Reorders the drawing units to shorten the pen-up travel
+*/
+package plotter
+
+import (
+	. "gerberbasetypes"
+	"math"
+)
+
+// the blocks up to this number of units are tried to be reversed by 2-opt
+const twoOptWindow = 100
+
+// the number of 2-opt passes over the units
+const twoOptPasses = 8
+
+// the drawing command kept by the optimizer, the moves are not kept
+type drawCmd struct {
+	kind           byte // 'L' line, 'C' circle, 'A' arc
+	x0, y0, x1, y1 int
+	xc, yc, r      int
+	fi0, fi1       int
+	ipm            IPmode
+}
+
+// the point where the command starts
+func (cmd *drawCmd) start() (int, int) {
+	if cmd.kind == 'C' {
+		return cmd.xc + cmd.r, cmd.yc
+	}
+	return cmd.x0, cmd.y0
+}
+
+// the point where the command ends, the circle is closed at its start
+func (cmd *drawCmd) end() (int, int) {
+	if cmd.kind == 'C' {
+		return cmd.xc + cmd.r, cmd.yc
+	}
+	return cmd.x1, cmd.y1
+}
+
+// the same command drawn backwards
+func (cmd drawCmd) reverse() drawCmd {
+	if cmd.kind == 'C' {
+		return cmd
+	}
+	cmd.x0, cmd.y0, cmd.x1, cmd.y1 = cmd.x1, cmd.y1, cmd.x0, cmd.y0
+	if cmd.kind == 'A' {
+		cmd.fi0, cmd.fi1 = cmd.fi1, cmd.fi0
+		if cmd.ipm == IPModeCwC {
+			cmd.ipm = IPModeCCwC
+		} else {
+			cmd.ipm = IPModeCwC
+		}
+	}
+	return cmd
+}
+
+// the commands drawn together, the unit may be drawn backwards
+type drawUnit struct {
+	cmds       []drawCmd
+	inX, inY   int
+	outX, outY int
+}
+
+// the entry and the exit of the unit drawn forward or backwards
+func (u *drawUnit) ends(reversed bool) (int, int, int, int) {
+	if reversed == true {
+		return u.outX, u.outY, u.inX, u.inY
+	}
+	return u.inX, u.inY, u.outX, u.outY
+}
+
+func distance(x0, y0, x1, y1 int) float64 {
+	return math.Hypot(float64(x1-x0), float64(y1-y0))
+}
+
+/*
+Optimizer keeps the drawing commands of the same pen grouped to the units
+and sends them to the plotter in the order of the short pen-up travel.
+The units are ordered by nearest neighbour and improved by 2-opt, the unit is drawn backwards if it is cheaper.
+The units are flushed when the pen is changed and when the plotter is stopped,
+so all the units of a pen are kept in memory and the errors of out are seen after the flush only.
+*/
+type Optimizer struct {
+	out   Plotter
+	units []drawUnit
+	// the unit is started by the next drawing command
+	newUnit bool
+	// the position of the plotter
+	x, y int
+	// pen-up travel between the units in the plotter steps, in the original order and after the optimization
+	TravelBefore float64
+	TravelAfter  float64
+}
+
+// creates the optimizer which sends the commands to out
+func NewOptimizer(out Plotter) *Optimizer {
+	retVal := new(Optimizer)
+	retVal.out = out
+	retVal.newUnit = true
+	return retVal
+}
+
+// the commands up to the next BeginUnit are drawn together
+func (opt *Optimizer) BeginUnit() {
+	opt.newUnit = true
+}
+
+func (opt *Optimizer) SetExtents(width, height int) {
+	if sizer, ok := opt.out.(Sizer); ok == true {
+		sizer.SetExtents(width, height)
+	}
+}
+
+func (opt *Optimizer) Start() error {
+	opt.units = opt.units[:0]
+	opt.newUnit = true
+	opt.x = 0
+	opt.y = 0
+	return opt.out.Start()
+}
+
+func (opt *Optimizer) Stop() error {
+	opt.flush()
+	return opt.out.Stop()
+}
+
+func (opt *Optimizer) Err() error {
+	return opt.out.Err()
+}
+
+// the moves are made by the drawing commands
+func (opt *Optimizer) MoveTo(x, y int) {
+}
+
+func (opt *Optimizer) add(cmd drawCmd) {
+	if opt.newUnit == true || len(opt.units) == 0 {
+		opt.units = append(opt.units, drawUnit{})
+		opt.newUnit = false
+	}
+	u := &opt.units[len(opt.units)-1]
+	if len(u.cmds) == 0 {
+		u.inX, u.inY = cmd.start()
+	}
+	u.cmds = append(u.cmds, cmd)
+	u.outX, u.outY = cmd.end()
+}
+
+func (opt *Optimizer) DrawLine(x0, y0, x1, y1 int) {
+	opt.add(drawCmd{kind: 'L', x0: x0, y0: y0, x1: x1, y1: y1})
+}
+
+func (opt *Optimizer) Circle(xc, yc, r int) {
+	opt.add(drawCmd{kind: 'C', xc: xc, yc: yc, r: r})
+}
+
+func (opt *Optimizer) Arc(x0, y0, x1, y1, xc, yc, radius, fi0, fi1 int, ipm IPmode) {
+	opt.add(drawCmd{kind: 'A', x0: x0, y0: y0, x1: x1, y1: y1, xc: xc, yc: yc, r: radius, fi0: fi0, fi1: fi1, ipm: ipm})
+}
+
+func (opt *Optimizer) TakePen(penNumber int) {
+	opt.flush()
+	opt.out.TakePen(penNumber)
+}
+
+// returns the pen-up travel between the units drawn in the order
+func (opt *Optimizer) travel(order []int, reversed []bool) float64 {
+	retVal := 0.0
+	x, y := opt.x, opt.y
+	for k, i := range order {
+		inX, inY, outX, outY := opt.units[i].ends(reversed[k])
+		retVal += distance(x, y, inX, inY)
+		x, y = outX, outY
+	}
+	return retVal
+}
+
+// sends the kept units to the plotter in the optimized order
+func (opt *Optimizer) flush() {
+	if len(opt.units) == 0 {
+		return
+	}
+	original := make([]int, len(opt.units))
+	for i := range original {
+		original[i] = i
+	}
+	opt.TravelBefore += opt.travel(original, make([]bool, len(original)))
+
+	order, reversed := opt.nearestNeighbour()
+	opt.twoOpt(order, reversed)
+	opt.TravelAfter += opt.travel(order, reversed)
+
+	for k, i := range order {
+		cmds := opt.units[i].cmds
+		for j := range cmds {
+			cmd := cmds[j]
+			if reversed[k] == true {
+				cmd = cmds[len(cmds)-1-j].reverse()
+			}
+			opt.draw(&cmd)
+		}
+	}
+	opt.units = opt.units[:0]
+	opt.newUnit = true
+}
+
+// draws the command, the plotter is moved to its start explicitly
+func (opt *Optimizer) draw(cmd *drawCmd) {
+	switch cmd.kind {
+	case 'L':
+		if opt.x != cmd.x0 || opt.y != cmd.y0 {
+			opt.out.MoveTo(cmd.x0, cmd.y0)
+		}
+		opt.out.DrawLine(cmd.x0, cmd.y0, cmd.x1, cmd.y1)
+		opt.x, opt.y = cmd.x1, cmd.y1
+	case 'C':
+		opt.out.Circle(cmd.xc, cmd.yc, cmd.r)
+		opt.x, opt.y = cmd.xc, cmd.yc
+	case 'A':
+		if opt.x != cmd.x0 || opt.y != cmd.y0 {
+			opt.out.MoveTo(cmd.x0, cmd.y0)
+		}
+		opt.out.Arc(cmd.x0, cmd.y0, cmd.x1, cmd.y1, cmd.xc, cmd.yc, cmd.r, cmd.fi0, cmd.fi1, cmd.ipm)
+		opt.x, opt.y = cmd.x1, cmd.y1
+	}
+}
+
+/*
+Orders the units by nearest neighbour starting from the plotter position.
+The unit ends are kept in the grid of cells to find the nearest one quickly.
+*/
+func (opt *Optimizer) nearestNeighbour() ([]int, []bool) {
+	n := len(opt.units)
+	minX, minY, maxX, maxY := opt.x, opt.y, opt.x, opt.y
+	for i := range opt.units {
+		u := &opt.units[i]
+		minX = minInt(minX, minInt(u.inX, u.outX))
+		minY = minInt(minY, minInt(u.inY, u.outY))
+		maxX = maxInt(maxX, maxInt(u.inX, u.outX))
+		maxY = maxInt(maxY, maxInt(u.inY, u.outY))
+	}
+	side := int(math.Ceil(math.Sqrt(float64(n))))
+	cellSize := maxInt((maxX-minX)/side, (maxY-minY)/side) + 1
+	cols := (maxX-minX)/cellSize + 1
+	rows := (maxY-minY)/cellSize + 1
+	cells := make([][]int, cols*rows)
+	cellOf := func(x, y int) (int, int) {
+		return (x - minX) / cellSize, (y - minY) / cellSize
+	}
+	// the unit end e of the unit i is kept as 2*i+e, e = 1 is the exit
+	for i := range opt.units {
+		u := &opt.units[i]
+		cx, cy := cellOf(u.inX, u.inY)
+		cells[cy*cols+cx] = append(cells[cy*cols+cx], 2*i)
+		cx, cy = cellOf(u.outX, u.outY)
+		cells[cy*cols+cx] = append(cells[cy*cols+cx], 2*i+1)
+	}
+	remove := func(x, y, end int) {
+		cx, cy := cellOf(x, y)
+		cell := cells[cy*cols+cx]
+		for k := range cell {
+			if cell[k] == end {
+				cell[k] = cell[len(cell)-1]
+				cells[cy*cols+cx] = cell[:len(cell)-1]
+				return
+			}
+		}
+	}
+
+	order := make([]int, 0, n)
+	reversed := make([]bool, 0, n)
+	x, y := opt.x, opt.y
+	for len(order) < n {
+		qx, qy := cellOf(x, y)
+		best := -1
+		bestDist := math.Inf(1)
+		for ring := 0; ring < cols || ring < rows; ring++ {
+			// the cells of the ring are not closer than (ring - 1) cells
+			if best >= 0 && bestDist <= float64((ring-1)*cellSize) {
+				break
+			}
+			for cy := qy - ring; cy <= qy+ring; cy++ {
+				if cy < 0 || cy >= rows {
+					continue
+				}
+				for cx := qx - ring; cx <= qx+ring; cx++ {
+					if cx < 0 || cx >= cols {
+						continue
+					}
+					if cy != qy-ring && cy != qy+ring && cx != qx-ring && cx != qx+ring {
+						continue
+					}
+					for _, end := range cells[cy*cols+cx] {
+						u := &opt.units[end/2]
+						ex, ey := u.inX, u.inY
+						if end%2 == 1 {
+							ex, ey = u.outX, u.outY
+						}
+						if d := distance(x, y, ex, ey); d < bestDist {
+							bestDist = d
+							best = end
+						}
+					}
+				}
+			}
+		}
+		i := best / 2
+		u := &opt.units[i]
+		remove(u.inX, u.inY, 2*i)
+		remove(u.outX, u.outY, 2*i+1)
+		order = append(order, i)
+		// the unit entered at the exit is drawn backwards
+		reversed = append(reversed, best%2 == 1)
+		_, _, x, y = u.ends(best%2 == 1)
+	}
+	return order, reversed
+}
+
+/*
+Improves the order by reversing the blocks of the units, the block of one unit reverses the unit itself.
+The travel inside the block is not changed by reversing it.
+*/
+func (opt *Optimizer) twoOpt(order []int, reversed []bool) {
+	n := len(order)
+	entry := func(k int) (int, int) {
+		x, y, _, _ := opt.units[order[k]].ends(reversed[k])
+		return x, y
+	}
+	exit := func(k int) (int, int) {
+		if k < 0 {
+			return opt.x, opt.y
+		}
+		_, _, x, y := opt.units[order[k]].ends(reversed[k])
+		return x, y
+	}
+	for pass := 0; pass < twoOptPasses; pass++ {
+		improved := false
+		for i := 0; i < n; i++ {
+			ax, ay := exit(i - 1)
+			for j := i; j < n && j < i+twoOptWindow; j++ {
+				bx, by := entry(i)
+				cx, cy := exit(j)
+				before := distance(ax, ay, bx, by)
+				after := distance(ax, ay, cx, cy)
+				if j+1 < n {
+					dx, dy := entry(j + 1)
+					before += distance(cx, cy, dx, dy)
+					after += distance(bx, by, dx, dy)
+				}
+				if after < before-0.5 {
+					for l, r := i, j; l <= r; l, r = l+1, r-1 {
+						order[l], order[r] = order[r], order[l]
+						reversed[l], reversed[r] = !reversed[r], !reversed[l]
+					}
+					improved = true
+				}
+			}
+		}
+		if improved == false {
+			break
+		}
+	}
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
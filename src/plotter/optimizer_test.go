@@ -0,0 +1,105 @@
+package plotter
+
+import (
+	"bytes"
+	. "gerberbasetypes"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// returns the drawing commands of the EM-7052 stream with their start points, the lines are not directed
+func drawnSegments(stream string) []string {
+	retVal := make([]string, 0)
+	pos := "0 , 0"
+	for _, cmd := range strings.Split(stream, "\n") {
+		switch {
+		case strings.HasPrefix(cmd, "MA "):
+			pos = cmd[3:]
+		case strings.HasPrefix(cmd, "DA "):
+			ends := []string{pos, cmd[3:]}
+			sort.Strings(ends)
+			retVal = append(retVal, ends[0]+" - "+ends[1])
+			pos = cmd[3:]
+		case strings.HasPrefix(cmd, "D"):
+			retVal = append(retVal, pos+" "+cmd)
+		}
+	}
+	sort.Strings(retVal)
+	return retVal
+}
+
+func TestOptimizer(t *testing.T) {
+	draw := func(plt Plotter, opt *Optimizer) {
+		plt.Start()
+		plt.TakePen(1)
+		// far and near lines, the second one is cheaper backwards
+		opt.BeginUnit()
+		plt.MoveTo(1000, 1000)
+		plt.DrawLine(1000, 1000, 1100, 1000)
+		opt.BeginUnit()
+		plt.DrawLine(200, 10, 10, 10)
+		opt.BeginUnit()
+		plt.Circle(500, 500, 20)
+		// the polyline is kept together
+		opt.BeginUnit()
+		plt.DrawLine(900, 900, 950, 900)
+		plt.DrawLine(950, 900, 950, 950)
+		opt.BeginUnit()
+		plt.Arc(300, 200, 200, 300, 200, 200, 100, 0, 90, IPModeCCwC)
+		plt.TakePen(2)
+		opt.BeginUnit()
+		plt.DrawLine(0, 0, 10, 0)
+		plt.Stop()
+	}
+	original := new(bytes.Buffer)
+	draw(NewPlotter(original), NewOptimizer(nil))
+
+	out := new(bytes.Buffer)
+	opt := NewOptimizer(NewPlotter(out))
+	draw(opt, opt)
+	if err := opt.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(drawnSegments(out.String()), "\n") != strings.Join(drawnSegments(original.String()), "\n") {
+		t.Errorf("the optimized stream draws other objects\n%s\nexpected\n%s", out.String(), original.String())
+	}
+	if opt.TravelAfter >= opt.TravelBefore || opt.TravelAfter <= 0 {
+		t.Error("the travel is not shortened", opt.TravelBefore, opt.TravelAfter)
+	}
+	if strings.HasPrefix(out.String(), "J\nP1\nMA 10 , 10\nDA 200 , 10\n") == false {
+		t.Error("the nearest line must be drawn first and backwards\n", out.String())
+	}
+	if strings.Contains(out.String(), "DA 950 , 900\nDA 950 , 950\n") == false &&
+		strings.Contains(out.String(), "DA 950 , 900\nDA 900 , 900\n") == false {
+		t.Error("the polyline is split\n", out.String())
+	}
+	// the pens are not mixed, the last line is nearer backwards
+	if strings.HasSuffix(out.String(), "P2\nMA 10 , 0\nDA 0 , 0\nP0\n") == false {
+		t.Error("the units of the pen 2 are mixed\n", out.String())
+	}
+}
+
+func TestOptimizerOrder(t *testing.T) {
+	// the grid of the short lines given in the random order
+	const n = 40
+	out := new(bytes.Buffer)
+	opt := NewOptimizer(NewPlotter(out))
+	opt.Start()
+	opt.TakePen(1)
+	for i := 0; i < n*n; i++ {
+		k := (i * 769) % (n * n)
+		x, y := (k%n)*100, (k/n)*100
+		opt.BeginUnit()
+		opt.DrawLine(x, y, x+10, y)
+	}
+	if err := opt.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if opt.TravelAfter > opt.TravelBefore/10 {
+		t.Error("the travel is not shortened enough", opt.TravelBefore, opt.TravelAfter)
+	}
+	if len(drawnSegments(out.String())) != n*n {
+		t.Error("the lines are lost")
+	}
+}
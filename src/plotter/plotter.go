@@ -5,132 +5,91 @@ package plotter
 
 import (
 	. "gerberbasetypes"
+	"github.com/spf13/viper"
 	glog "glog_t"
-	"os"
+	"io"
 	"strconv"
-	"strings"
 )
 
 /*
 	Plotter current status and statistic
 */
 type PlotterParams struct {
-	selectPenCmds   int
-	dropPenCmds     int
-	raisePenCmds    int
-	moveCmds        int
-	currentPosX     int
-	currentPosY     int
-	outFileName     string
-	outputFile      *os.File
-	err             error
-	outStringBuffer []string
+	selectPenCmds int
+	dropPenCmds   int
+	raisePenCmds  int
+	moveCmds      int
+	currentPosX   int
+	currentPosY   int
+	// the command stream, the MA commands are squeezed
+	stream
 }
 
-func NewPlotter() *PlotterParams {
+// creates the EM-7052 plotter which writes the command stream to w
+func NewPlotter(w io.Writer) *PlotterParams {
 	retVal := new(PlotterParams)
-	retVal.Init()
+	retVal.init(w)
 	return retVal
 }
 
+// the EM-7052 plotter is the default backend
+func init() {
+	Register(DefaultBackend, func(w io.Writer, _ *viper.Viper) (Plotter, error) {
+		return NewPlotter(w), nil
+	})
+}
+
+// the output device driven by the renderer, all the coordinates are in the plotter steps
 type Plotter interface {
 
-	// Initializes plotter by setting up the commands
-	InitCommands() error
+	// starts the command stream
+	Start() error
 
-	//
-	Start() string
+	// finalizes the command stream, returns the first error occured
+	Stop() error
 
-	// Stops the plotter
-	Stop() string
+	// returns the first error occured, the command stream is not written after it
+	Err() error
 
 	// moves the tool to position
-	MoveTo(x, y int) string
+	MoveTo(x, y int)
 
 	// draws a line
-	DrawLine(x0, y0, x1, y1 int) string
+	DrawLine(x0, y0, x1, y1 int)
 
 	// draws a circle
-	Circle(xc, yc, r int) string
+	Circle(xc, yc, r int)
 
-	// draws an arc
-	Arc(x0, y0, x1, y1, radius, fi0, fi1 int, ipm IPmode) string
+	// draws an arc of the circle (xc, yc, radius) from the angle fi0 to fi1, the angles are in degrees
+	// (x0, y0) and (x1, y1) are the end points of the track center line
+	Arc(x0, y0, x1, y1, xc, yc, radius, fi0, fi1 int, ipm IPmode)
 
 	// takes a pen
-	TakePen(penNumber int) string
+	TakePen(penNumber int)
 }
 
 /*
 	Initializes Plotter object and generates plotter reset command
 */
-func (plotter *PlotterParams) Init() string {
+func (plotter *PlotterParams) Start() error {
 	plotter.currentPosX = 0
 	plotter.currentPosY = 0
-	plotter.outStringBuffer = make([]string, 0)
-	retVal := "J\n"
-	plotter.outStringBuffer = append(plotter.outStringBuffer, retVal)
-	return retVal
-}
-
-func (plotter *PlotterParams) SetOutFileName(outFileName string) {
-	plotter.outFileName = outFileName
+	plotter.emit("J\n")
+	return plotter.err
 }
 
 /*
-	Deletes unnecessary MA commands
+	Finalizes command stream and flushes the output
+	the trailing MA command is dropped
 */
-func (plotter *PlotterParams) squeeze() {
-	tmpString := make([]string, 0)
-	var lastMA string
-	for a := range plotter.outStringBuffer {
-		if strings.HasPrefix(plotter.outStringBuffer[a], "MA ") {
-			lastMA = plotter.outStringBuffer[a]
-		} else {
-			if len(lastMA) > 0 {
-				tmpString = append(tmpString, lastMA)
-			}
-			tmpString = append(tmpString, plotter.outStringBuffer[a])
-			lastMA = ""
-		}
-	}
-	plotter.outStringBuffer = tmpString
-}
-
-/*
-	Finalizes command stream and writes file to disk
-*/
-func (plotter *PlotterParams) Stop() {
-	_ = plotter.TakePen(0)
-	_ = plotter.MoveTo(0, 0)
-	plotter.squeeze()
-	plotter.outputFile, plotter.err = os.OpenFile(plotter.outFileName, os.O_WRONLY|os.O_CREATE, 0600)
-	if plotter.err != nil {
-		glog.Fatal(plotter.err)
-	}
-	defer plotter.outputFile.Close()
-	plotter.err = plotter.outputFile.Truncate(0)
-	if plotter.err != nil {
-		glog.Fatal(plotter.err)
-	}
-	for _, s := range plotter.outStringBuffer {
-		_, plotter.err = plotter.outputFile.WriteString(s)
-		if plotter.err != nil {
-			glog.Fatal(plotter.err)
-		}
-	}
-	plotter.outputFile.Sync()
-	plotter.err = plotter.outputFile.Close()
-	if plotter.err != nil {
-		glog.Fatal(plotter.err)
-	}
-	plotter.outStringBuffer = nil
-	return
+func (plotter *PlotterParams) Stop() error {
+	plotter.TakePen(0)
+	plotter.MoveTo(0, 0)
+	return plotter.finish()
 }
 
-func (plotter *PlotterParams) MoveTo(x, y int) string {
-	retVal := plotter.moveTo(x, y)
-	plotter.outStringBuffer = append(plotter.outStringBuffer, retVal)
-	return retVal
+func (plotter *PlotterParams) MoveTo(x, y int) {
+	plotter.move(plotter.moveTo(x, y))
 }
 
 func (plotter *PlotterParams) moveTo(x, y int) string {
@@ -141,56 +100,43 @@ func (plotter *PlotterParams) moveTo(x, y int) string {
 	return retVal
 }
 
-func (plotter *PlotterParams) DrawLine(x0, y0, x1, y1 int) string {
-	var retVal string
+func (plotter *PlotterParams) DrawLine(x0, y0, x1, y1 int) {
 	if (plotter.currentPosX != x0) || (plotter.currentPosY != y0) {
-		retVal = plotter.moveTo(x0, y0)
-		plotter.outStringBuffer = append(plotter.outStringBuffer, retVal)
+		plotter.move(plotter.moveTo(x0, y0))
 	}
-	retVal = "DA " + strconv.Itoa(x1) + " , " + strconv.Itoa(y1) + "\n"
 	plotter.currentPosX = x1
 	plotter.currentPosY = y1
-	plotter.outStringBuffer = append(plotter.outStringBuffer, retVal)
-	return retVal
+	plotter.emit("DA " + strconv.Itoa(x1) + " , " + strconv.Itoa(y1) + "\n")
 }
 
-func (plotter *PlotterParams) Circle(xc, yc, r int) string {
-	retVal := plotter.moveTo(xc+r, yc) // move to the rightmost circle point
-	plotter.outStringBuffer = append(plotter.outStringBuffer, retVal)
-	retVal = "D C" + strconv.Itoa(r) + " , 0 , 360\n"
-	plotter.outStringBuffer = append(plotter.outStringBuffer, retVal)
-	retVal = plotter.moveTo(xc, yc)
-	plotter.outStringBuffer = append(plotter.outStringBuffer, retVal)
-	return retVal
+func (plotter *PlotterParams) Circle(xc, yc, r int) {
+	plotter.move(plotter.moveTo(xc+r, yc)) // move to the rightmost circle point
+	plotter.emit("D C" + strconv.Itoa(r) + " , 0 , 360\n")
+	plotter.move(plotter.moveTo(xc, yc))
 }
 
-func (plotter *PlotterParams) Arc(x0, y0, x1, y1, radius, fi0, fi1 int, ipm IPmode) string {
-	var retVal string
+// the plotter finds the center itself
+func (plotter *PlotterParams) Arc(x0, y0, x1, y1, _, _, radius, fi0, fi1 int, ipm IPmode) {
 	if (plotter.currentPosX != x0) || (plotter.currentPosY != y0) {
 		glog.Error("Arc position discrepance: (currX, currY) (x0, y0) (" +
 			strconv.Itoa(plotter.currentPosX) + "," + strconv.Itoa(plotter.currentPosY) + ") (" +
 			strconv.Itoa(x0) + "," + strconv.Itoa(y0) + ")")
-		retVal = plotter.moveTo(x0, y0)
-		plotter.outStringBuffer = append(plotter.outStringBuffer, retVal)
+		plotter.move(plotter.moveTo(x0, y0))
 	}
 	if ipm == IPModeCwC {
 		radius = -radius
 	} else {
 		radius = radius
 	}
-	retVal = "DC " + strconv.Itoa(radius) + " , " + strconv.Itoa(fi0) + " , " + strconv.Itoa(fi1) + "\n"
-	plotter.outStringBuffer = append(plotter.outStringBuffer, retVal)
-	retVal = plotter.moveTo(x1, y1)
-	plotter.outStringBuffer = append(plotter.outStringBuffer, retVal)
-	return retVal
-
+	plotter.emit("DC " + strconv.Itoa(radius) + " , " + strconv.Itoa(fi0) + " , " + strconv.Itoa(fi1) + "\n")
+	plotter.move(plotter.moveTo(x1, y1))
 }
 
-func (plotter *PlotterParams) TakePen(penNumber int) string {
-	if penNumber < 0 || penNumber > 4 {
-		glog.Fatal("Bad pen number specified!")
+func (plotter *PlotterParams) TakePen(penNumber int) {
+	if err := checkPen(penNumber); err != nil {
+		// the first error is kept and returned when the stream is finalized
+		plotter.fail(err)
+		return
 	}
-	retVal := "P" + strconv.Itoa(penNumber) + "\n"
-	plotter.outStringBuffer = append(plotter.outStringBuffer, retVal)
-	return retVal
+	plotter.emit("P" + strconv.Itoa(penNumber) + "\n")
 }
@@ -0,0 +1,61 @@
+package plotter
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestStreamSqueeze(t *testing.T) {
+	out := new(bytes.Buffer)
+	plt := NewPlotter(out)
+	if err := plt.Start(); err != nil {
+		t.Fatal(err)
+	}
+	plt.TakePen(1)
+	plt.MoveTo(10, 10)
+	plt.MoveTo(20, 20)
+	plt.DrawLine(30, 30, 40, 40)
+	plt.DrawLine(40, 40, 50, 40)
+	if err := plt.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	expected := "J\nP1\nMA 30 , 30\nDA 40 , 40\nDA 50 , 40\nP0\n"
+	if out.String() != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, out.String())
+	}
+}
+
+// fails after the limit is reached
+type limitedWriter struct {
+	limit int
+}
+
+func (w *limitedWriter) Write(p []byte) (int, error) {
+	if len(p) > w.limit {
+		n := w.limit
+		w.limit = 0
+		return n, errors.New("no space left")
+	}
+	w.limit -= len(p)
+	return len(p), nil
+}
+
+func TestStreamErrors(t *testing.T) {
+	plt := NewPlotter(new(bytes.Buffer))
+	plt.TakePen(7)
+	if plt.Stop() == nil {
+		t.Error("the bad pen number must be reported")
+	}
+
+	plt = NewPlotter(&limitedWriter{100})
+	for i := 0; i < 10000; i++ {
+		plt.DrawLine(i, 0, i, 100)
+	}
+	if plt.Err() == nil {
+		t.Error("the write error must be reported before the stream is finished")
+	}
+	if plt.Stop() == nil {
+		t.Error("the write error must be returned by Finish")
+	}
+}
@@ -0,0 +1,122 @@
+/*
+Command stream shared by the plotter backends
+*/
+package plotter
+
+import (
+	"bufio"
+	. "gerberbasetypes"
+	"io"
+	"math"
+	"strconv"
+)
+
+// the highest pen number, pen 0 puts the pen away
+const maxPenNumber = 4
+
+// returns an error if the pen can not be selected
+func checkPen(penNumber int) error {
+	if penNumber < 0 || penNumber > maxPenNumber {
+		return NewUnsupportedFeatureError("pen number " + strconv.Itoa(penNumber))
+	}
+	return nil
+}
+
+// returns the point of the circle at the angle fi (degrees)
+func arcPoint(xc, yc, radius, fi int) (int, int) {
+	phi := float64(fi) * math.Pi / 180.0
+	return xc + int(math.Round(float64(radius)*math.Cos(phi))),
+		yc + int(math.Round(float64(radius)*math.Sin(phi)))
+}
+
+// returns the start angle and the sweep (degrees, positive counterclockwise) of the arc from the ray
+// through (x0, y0) to the ray through (x1, y1), the sweep of the rounded angles fi0, fi1 is taken
+// if the ends are the same (the full circle)
+func arcSweep(x0, y0, x1, y1, xc, yc, fi0, fi1 int, ipm IPmode) (float64, float64) {
+	phi0 := float64(fi0)
+	if x0 != xc || y0 != yc {
+		phi0 = math.Atan2(float64(y0-yc), float64(x0-xc)) * 180.0 / math.Pi
+	}
+	sweep := float64(fi1 - fi0)
+	if x0 != x1 || y0 != y1 {
+		sweep = math.Atan2(float64(y1-yc), float64(x1-xc))*180.0/math.Pi - phi0
+	}
+	if ipm == IPModeCwC && sweep > 0 {
+		sweep -= 360
+	}
+	if ipm == IPModeCCwC && sweep < 0 {
+		sweep += 360
+	}
+	return phi0, sweep
+}
+
+// returns the point of the circle (xc, yc, radius) on the ray from the center through (x, y),
+// the point itself if it is on the circle (the track center line)
+func arcEnd(x, y, xc, yc, radius int) (int, int) {
+	d := math.Hypot(float64(x-xc), float64(y-yc))
+	if d == 0 || int(math.Round(d)) == radius {
+		return x, y
+	}
+	k := float64(radius) / d
+	return xc + int(math.Round(float64(x-xc)*k)), yc + int(math.Round(float64(y-yc)*k))
+}
+
+/*
+Buffered command stream which deletes unnecessary pen moves:
+a move is kept until the next command comes, only the last of the consecutive moves is written
+*/
+type stream struct {
+	// the commands are written to out as they are generated
+	out *bufio.Writer
+	// the last move command which is not written yet
+	pendingMove string
+	// the first error occured
+	err error
+}
+
+func (s *stream) init(w io.Writer) {
+	s.out = bufio.NewWriter(w)
+	s.pendingMove = ""
+	s.err = nil
+}
+
+// keeps the move command until the next drawing command
+func (s *stream) move(cmd string) {
+	s.pendingMove = cmd
+}
+
+// writes the command preceded by the pending move
+func (s *stream) emit(cmd string) {
+	if s.err != nil {
+		return
+	}
+	if len(s.pendingMove) > 0 {
+		_, s.err = s.out.WriteString(s.pendingMove)
+		s.pendingMove = ""
+	}
+	if s.err == nil {
+		_, s.err = s.out.WriteString(cmd)
+	}
+}
+
+// keeps the first error, the command stream is not written after it
+func (s *stream) fail(err error) {
+	if s.err == nil {
+		s.err = err
+	}
+}
+
+// returns the first error occured, the command stream is not written after it
+func (s *stream) Err() error {
+	return s.err
+}
+
+// drops the trailing move and flushes the output
+func (s *stream) finish() error {
+	s.pendingMove = ""
+	if s.err != nil {
+		return s.err
+	}
+	s.err = s.out.Flush()
+	return s.err
+}
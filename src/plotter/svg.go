@@ -0,0 +1,223 @@
+/*
+Records the plotter toolpath to SVG
+*/
+package plotter
+
+import (
+	"bytes"
+	"configurator"
+	"errors"
+	. "gerberbasetypes"
+	"github.com/spf13/viper"
+	"io"
+	"math"
+	"strconv"
+)
+
+const SVGBackend = "svg"
+
+func init() {
+	Register(SVGBackend, func(w io.Writer, v *viper.Viper) (Plotter, error) {
+		return NewSVGPlotter(w, v)
+	})
+}
+
+/*
+SVG toolpath, the coordinates are in the plotter steps, the Y axis points up.
+The strokes are drawn by the pen width and written as they come,
+the pen-up travel moves are collected to the separate "travel" layer written at the end.
+*/
+type SVGPlotter struct {
+	// plotter step size, mm
+	resX, resY float64
+	// the pen widths in the plotter steps
+	penWidths []float64
+	// the size of the drawing in the plotter steps
+	width, height int
+	pen           int
+	// the path element is opened and continues at the current position
+	pathOpened  bool
+	currentPosX int
+	currentPosY int
+	// the pen is moved without drawing from travelX, travelY to the current position
+	moving           bool
+	travelX, travelY int
+	travel           bytes.Buffer
+	stream
+}
+
+// creates the SVG plotter which writes the toolpath to w
+// the drawing size is the plotter canvas (renderer.CanvasWidth, renderer.CanvasHeight) unless SetExtents is called
+func NewSVGPlotter(w io.Writer, v *viper.Viper) (*SVGPlotter, error) {
+	retVal := new(SVGPlotter)
+	retVal.resX = v.GetFloat64(configurator.CfgPlotterXRes)
+	retVal.resY = v.GetFloat64(configurator.CfgPlotterYRes)
+	if retVal.resX <= 0 || retVal.resY <= 0 {
+		return nil, errors.New("bad SVG plotter resolution")
+	}
+	penSizes, err := configurator.PenSizes(v)
+	if err != nil {
+		return nil, err
+	}
+	for _, size := range penSizes {
+		retVal.penWidths = append(retVal.penWidths, size/retVal.resX)
+	}
+	retVal.width = int(v.GetFloat64(configurator.CfgRenderCanvasWidth) / retVal.resX)
+	retVal.height = int(v.GetFloat64(configurator.CfgRenderCanvasHeight) / retVal.resY)
+	retVal.init(w)
+	return retVal, nil
+}
+
+func (plotter *SVGPlotter) SetExtents(width, height int) {
+	plotter.width = width
+	plotter.height = height
+}
+
+// the sizes are rounded to 0.0001 step
+func svgNumber(f float64) string {
+	return strconv.FormatFloat(math.Round(f*10000)/10000, 'f', -1, 64)
+}
+
+func svgPoint(x, y int) string {
+	return strconv.Itoa(x) + " " + strconv.Itoa(y)
+}
+
+// writes the svg header, the drawing is flipped to make the Y axis point up
+func (plotter *SVGPlotter) Start() error {
+	plotter.currentPosX = 0
+	plotter.currentPosY = 0
+	plotter.pen = 0
+	plotter.emit("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n" +
+		"<svg xmlns=\"http://www.w3.org/2000/svg\" xmlns:inkscape=\"http://www.inkscape.org/namespaces/inkscape\"" +
+		" width=\"" + svgNumber(float64(plotter.width)*plotter.resX) + "mm\"" +
+		" height=\"" + svgNumber(float64(plotter.height)*plotter.resY) + "mm\"" +
+		" viewBox=\"0 0 " + svgPoint(plotter.width, plotter.height) + "\">\n" +
+		"<g transform=\"matrix(1 0 0 -1 0 " + strconv.Itoa(plotter.height) + ")\"" +
+		" fill=\"none\" stroke-linecap=\"round\" stroke-linejoin=\"round\">\n" +
+		"<g id=\"toolpath\" inkscape:groupmode=\"layer\" inkscape:label=\"toolpath\" stroke=\"#000000\">\n")
+	return plotter.err
+}
+
+// writes the travel layer and closes the svg
+func (plotter *SVGPlotter) Stop() error {
+	plotter.TakePen(0)
+	plotter.emit("</g>\n" +
+		"<g id=\"travel\" inkscape:groupmode=\"layer\" inkscape:label=\"travel\" stroke=\"#ff0000\"" +
+		" stroke-width=\"" + svgNumber(1/plotter.resX*0.05) + "\" stroke-dasharray=\"" + svgNumber(1/plotter.resX*0.5) + "\">\n")
+	if plotter.travel.Len() > 0 {
+		plotter.emit("<path d=\"")
+		plotter.emit(plotter.travel.String())
+		plotter.emit("\"/>\n")
+	}
+	plotter.emit("</g>\n</g>\n</svg>\n")
+	return plotter.finish()
+}
+
+func (plotter *SVGPlotter) closePath() {
+	if plotter.pathOpened == true {
+		plotter.emit("\"/>\n")
+		plotter.pathOpened = false
+	}
+}
+
+// records the travel move finished by the drawing command
+func (plotter *SVGPlotter) endMove() {
+	if plotter.moving == false {
+		return
+	}
+	plotter.moving = false
+	if plotter.travelX == plotter.currentPosX && plotter.travelY == plotter.currentPosY {
+		return
+	}
+	plotter.travel.WriteString("M" + svgPoint(plotter.travelX, plotter.travelY) +
+		" L" + svgPoint(plotter.currentPosX, plotter.currentPosY) + " ")
+}
+
+// the consecutive moves are recorded as one travel move
+func (plotter *SVGPlotter) MoveTo(x, y int) {
+	if x == plotter.currentPosX && y == plotter.currentPosY {
+		return
+	}
+	plotter.closePath()
+	if plotter.moving == false {
+		plotter.moving = true
+		plotter.travelX = plotter.currentPosX
+		plotter.travelY = plotter.currentPosY
+	}
+	plotter.currentPosX = x
+	plotter.currentPosY = y
+}
+
+// continues the opened path or starts the new one at the current position
+func (plotter *SVGPlotter) pathTo(segment string, x, y int) {
+	plotter.endMove()
+	if plotter.pathOpened == false {
+		plotter.emit("<path d=\"M" + svgPoint(plotter.currentPosX, plotter.currentPosY))
+		plotter.pathOpened = true
+	}
+	plotter.emit(" " + segment)
+	plotter.currentPosX = x
+	plotter.currentPosY = y
+}
+
+func (plotter *SVGPlotter) DrawLine(x0, y0, x1, y1 int) {
+	plotter.MoveTo(x0, y0)
+	plotter.pathTo("L"+svgPoint(x1, y1), x1, y1)
+}
+
+// the plotters return to the center after the circle is drawn
+func (plotter *SVGPlotter) Circle(xc, yc, r int) {
+	plotter.MoveTo(xc+r, yc)
+	plotter.closePath()
+	plotter.endMove()
+	plotter.emit("<circle cx=\"" + strconv.Itoa(xc) + "\" cy=\"" + strconv.Itoa(yc) + "\" r=\"" + strconv.Itoa(r) + "\"/>\n")
+	plotter.MoveTo(xc, yc)
+}
+
+// the arc is drawn on the circle (xc, yc, radius) between the rays through the ends of the track center line,
+// the full circle is split to two halves
+func (plotter *SVGPlotter) Arc(x0, y0, x1, y1, xc, yc, radius, fi0, fi1 int, ipm IPmode) {
+	xs, ys := arcEnd(x0, y0, xc, yc, radius)
+	xe, ye := arcEnd(x1, y1, xc, yc, radius)
+	phi0, sweep := arcSweep(x0, y0, x1, y1, xc, yc, fi0, fi1, ipm)
+	plotter.MoveTo(xs, ys)
+	// the Y axis points up, so the positive angle direction is counterclockwise
+	flags := " 0 0 1 "
+	if sweep < 0 {
+		flags = " 0 0 0 "
+	}
+	r := strconv.Itoa(radius)
+	if sweep >= 360 || sweep <= -360 {
+		phi := (phi0 + sweep/2) * math.Pi / 180.0
+		xm := xc + int(math.Round(float64(radius)*math.Cos(phi)))
+		ym := yc + int(math.Round(float64(radius)*math.Sin(phi)))
+		plotter.pathTo("A"+r+" "+r+flags+svgPoint(xm, ym), xm, ym)
+	} else if sweep > 180 || sweep < -180 {
+		flags = flags[:3] + "1" + flags[4:]
+	}
+	plotter.pathTo("A"+r+" "+r+flags+svgPoint(xe, ye), xe, ye)
+}
+
+// each pen has its own group with the stroke width of the pen
+func (plotter *SVGPlotter) TakePen(penNumber int) {
+	if err := checkPen(penNumber); err != nil {
+		plotter.fail(err)
+		return
+	}
+	if penNumber == plotter.pen {
+		return
+	}
+	plotter.closePath()
+	if plotter.pen != 0 {
+		plotter.emit("</g>\n")
+	}
+	plotter.pen = penNumber
+	if penNumber == 0 {
+		return
+	}
+	width := 1.0
+	if penNumber <= len(plotter.penWidths) {
+		width = plotter.penWidths[penNumber-1]
+	}
+	plotter.emit("<g id=\"pen" + strconv.Itoa(penNumber) + "\" stroke-width=\"" + svgNumber(width) + "\">\n")
+}
@@ -0,0 +1,121 @@
+package plotter
+
+import (
+	"bytes"
+	"configurator"
+	"encoding/xml"
+	. "gerberbasetypes"
+	"github.com/spf13/viper"
+	"strings"
+	"testing"
+)
+
+func TestSVGPlotter(t *testing.T) {
+	v := viper.New()
+	configurator.SetDefaults(v)
+	v.Set(configurator.CfgPlotterXRes, 0.05)
+	v.Set(configurator.CfgPlotterYRes, 0.05)
+	v.Set(configurator.CfgPlotterPenSizes, []float64{0.1, 0.5})
+	out := new(bytes.Buffer)
+	plt, err := New(SVGBackend, out, v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plt.(Sizer).SetExtents(100, 80)
+	if err := plt.Start(); err != nil {
+		t.Fatal(err)
+	}
+	plt.TakePen(1)
+	plt.MoveTo(3, 3)
+	plt.MoveTo(5, 5)
+	plt.DrawLine(5, 5, 20, 5)
+	plt.DrawLine(20, 5, 20, 20)
+	plt.Circle(50, 50, 10)
+	plt.Arc(30, 30, 20, 40, 20, 30, 10, 0, 90, IPModeCCwC)
+	plt.TakePen(2)
+	plt.Arc(30, 30, 30, 30, 20, 30, 10, 0, -360, IPModeCwC)
+	if err := plt.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	svg := out.String()
+	for _, expected := range []string{
+		`width="5mm" height="4mm" viewBox="0 0 100 80"`,
+		`matrix(1 0 0 -1 0 80)`,
+		`<g id="pen1" stroke-width="2">`,
+		`<path d="M5 5 L20 5 L20 20"/>`,
+		`<circle cx="50" cy="50" r="10"/>`,
+		`<path d="M30 30 A10 10 0 0 1 20 40"/>`,
+		`<g id="pen2" stroke-width="10">`,
+		// the full circle is drawn by two halves
+		`<path d="M30 30 A10 10 0 0 0 10 30 A10 10 0 0 0 30 30"/>`,
+		// the consecutive moves are squeezed
+		`<path d="M0 0 L5 5 M20 20 L60 50 M60 50 L30 30 M20 40 L30 30 "/>`,
+	} {
+		if strings.Contains(svg, expected) == false {
+			t.Errorf("%s is not found in\n%s", expected, svg)
+		}
+	}
+	if strings.Index(svg, `id="toolpath"`) > strings.Index(svg, `id="travel"`) {
+		t.Error("the travel layer must follow the toolpath")
+	}
+	// the document is well-formed
+	decoder := xml.NewDecoder(strings.NewReader(svg))
+	for {
+		if _, err := decoder.Token(); err != nil {
+			if err.Error() != "EOF" {
+				t.Error(err)
+			}
+			break
+		}
+	}
+
+	// the arc ending at 53.13 degrees joins the next line without a travel move
+	out.Reset()
+	plt, _ = New(SVGBackend, out, v)
+	plt.Start()
+	plt.TakePen(1)
+	plt.DrawLine(1000, 100, 1000, 0)
+	plt.Arc(1000, 0, 600, 800, 0, 0, 1000, 0, 53, IPModeCCwC)
+	plt.DrawLine(600, 800, 600, 900)
+	plt.Stop()
+	if strings.Contains(out.String(), `<path d="M1000 100 L1000 0 A1000 1000 0 0 1 600 800 L600 900"/>`) == false ||
+		strings.Contains(out.String(), `<path d="M0 0 L1000 100 "/>`) == false {
+		t.Error("the arc is not joined to the lines\n", out.String())
+	}
+
+	plt, _ = New(SVGBackend, out, v)
+	plt.TakePen(9)
+	if plt.Stop() == nil {
+		t.Error("the bad pen number must be reported")
+	}
+}
+
+func TestTee(t *testing.T) {
+	v := viper.New()
+	configurator.SetDefaults(v)
+	em, svg := new(bytes.Buffer), new(bytes.Buffer)
+	svgPlotter, err := NewSVGPlotter(svg, v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plt := NewTee(NewPlotter(em), svgPlotter)
+	plt.(Sizer).SetExtents(10, 10)
+	plt.Start()
+	plt.TakePen(1)
+	plt.DrawLine(1, 1, 5, 5)
+	if err := plt.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if em.String() != "J\nP1\nMA 1 , 1\nDA 5 , 5\nP0\n" {
+		t.Error("unexpected plotter stream", em.String())
+	}
+	if strings.Contains(svg.String(), `viewBox="0 0 10 10"`) == false ||
+		strings.Contains(svg.String(), `<path d="M1 1 L5 5"/>`) == false {
+		t.Error("unexpected toolpath", svg.String())
+	}
+	plt = NewTee(NewPlotter(em), svgPlotter)
+	plt.TakePen(5)
+	if plt.Err() == nil || plt.Stop() == nil {
+		t.Error("the error must be reported")
+	}
+}
@@ -0,0 +1,94 @@
+/*
+Drives several plotters by the same command sequence
+*/
+package plotter
+
+import (
+	. "gerberbasetypes"
+)
+
+// the plotters which need the size of the drawing before Start() implement Sizer
+type Sizer interface {
+	// sets the size of the drawing area in the plotter steps
+	SetExtents(width, height int)
+}
+
+type tee []Plotter
+
+// returns the plotter which passes each command to all the plotters
+func NewTee(plotters ...Plotter) Plotter {
+	return tee(plotters)
+}
+
+func (t tee) SetExtents(width, height int) {
+	for _, p := range t {
+		if s, ok := p.(Sizer); ok == true {
+			s.SetExtents(width, height)
+		}
+	}
+}
+
+// returns the first non-nil error
+func firstError(errs []error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t tee) Start() error {
+	errs := make([]error, len(t))
+	for i, p := range t {
+		errs[i] = p.Start()
+	}
+	return firstError(errs)
+}
+
+// all the plotters are stopped even if some of them fail
+func (t tee) Stop() error {
+	errs := make([]error, len(t))
+	for i, p := range t {
+		errs[i] = p.Stop()
+	}
+	return firstError(errs)
+}
+
+func (t tee) Err() error {
+	errs := make([]error, len(t))
+	for i, p := range t {
+		errs[i] = p.Err()
+	}
+	return firstError(errs)
+}
+
+func (t tee) MoveTo(x, y int) {
+	for _, p := range t {
+		p.MoveTo(x, y)
+	}
+}
+
+func (t tee) DrawLine(x0, y0, x1, y1 int) {
+	for _, p := range t {
+		p.DrawLine(x0, y0, x1, y1)
+	}
+}
+
+func (t tee) Circle(xc, yc, r int) {
+	for _, p := range t {
+		p.Circle(xc, yc, r)
+	}
+}
+
+func (t tee) Arc(x0, y0, x1, y1, xc, yc, radius, fi0, fi1 int, ipm IPmode) {
+	for _, p := range t {
+		p.Arc(x0, y0, x1, y1, xc, yc, radius, fi0, fi1, ipm)
+	}
+}
+
+func (t tee) TakePen(penNumber int) {
+	for _, p := range t {
+		p.TakePen(penNumber)
+	}
+}
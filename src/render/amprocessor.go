@@ -5,6 +5,7 @@ import (
 	"calculator"
 	"errors"
 	"fmt"
+	"github.com/akavel/polyclip-go"
 	. "gerberbasetypes"
 	glog "glog_t"
 	"math"
@@ -13,23 +14,20 @@ import (
 	stor "strings_storage"
 )
 
-// aperture macro dictionary
-var AMacroDict []*ApertureMacro
-
 type AMPrimitive interface {
 	// takes the state with the FLASH opcode, where aperture code is macro
 	// returns the sequence of steps which allow to draw this aperture
 	//	Render(int, int, color.RGBA)
-	Render(int, int, *Render)
+	Render(int, int, *Render) error
 
-	// draws a line or an arc using aperture as "brush"
-	Draw(int, int, int, int, *Render)
+	// returns the shape of the primitive flashed at x, y and its exposure
+	Contours(float64, float64, *Render) (polyclip.Polygon, PolType)
 
 	// returns a string representation of thr primitive
 	String() string
 
 	// instantiates an macro primitive using parameters, scale factor and macro variables
-	Init(float64, []float64) AMPrimitive
+	Init(float64, []float64) (AMPrimitive, error)
 
 	// returns a copy of object
 	Copy() AMPrimitive
@@ -56,7 +54,6 @@ func NewAMPrimitive(amp AMPrimitiveType, modifStrings []interface{}) AMPrimitive
 		return &AMPrimitiveThermal{AMPrimitive_Thermal, modifStrings}
 	default:
 		//		panic("unknown aperture macro primitive type")
-		glog.Fatalln("unknown aperture macro primitive type")
 		return nil
 	}
 
@@ -112,17 +109,17 @@ func (amp *AMPrimitiveComment) String() string {
 	return retVal
 }
 
-func (amp *AMPrimitiveComment) Render(x0, y0 int, context *Render) {
-	return
+func (amp *AMPrimitiveComment) Render(x0, y0 int, context *Render) error {
+	return nil
 }
 
-func (amp *AMPrimitiveComment) Draw(x0, y0 int, x1, y1 int, context *Render) {
-	return
+func (amp *AMPrimitiveComment) Contours(x0, y0 float64, context *Render) (polyclip.Polygon, PolType) {
+	return nil, PolTypeDark
 }
 
-func (amp *AMPrimitiveComment) Init(scale float64, params []float64) AMPrimitive {
+func (amp *AMPrimitiveComment) Init(scale float64, params []float64) (AMPrimitive, error) {
 
-	return NewAMPrimitive(AMPrimitive_Comment, []interface{}{})
+	return NewAMPrimitive(AMPrimitive_Comment, []interface{}{}), nil
 }
 
 func (amp *AMPrimitiveComment) Copy() AMPrimitive {
@@ -151,7 +148,7 @@ func (amp *AMPrimitiveCircle) String() string {
 	return retVal
 }
 
-func (amp *AMPrimitiveCircle) Render(x0, y0 int, context *Render) {
+func (amp *AMPrimitiveCircle) Render(x0, y0 int, context *Render) error {
 	// coordinates of the circle center after rotation
 	xd, yd, _ := RotatePoint(amp.AMModifiers[2].(float64), amp.AMModifiers[3].(float64), amp.AMModifiers[4].(float64))
 	xC := x0 + transformCoord(xd, context.XRes)
@@ -169,12 +166,16 @@ func (amp *AMPrimitiveCircle) Render(x0, y0 int, context *Render) {
 	context.DrawDonut(xC, yC, d, hd, colr)
 	// go back
 	context.MovePen(xC, yC, x0, y0, context.MovePenColor)
-	return
+	return nil
 }
 
-func (amp *AMPrimitiveCircle) Draw(x0, y0 int, x1, y1 int, context *Render) {
-	BadMethod()
-	return
+func (amp *AMPrimitiveCircle) Contours(x0, y0 float64, context *Render) (polyclip.Polygon, PolType) {
+	xd, yd, _ := RotatePoint(amp.AMModifiers[2].(float64), amp.AMModifiers[3].(float64), amp.AMModifiers[4].(float64))
+	xC := x0 + transformFloatCoord(xd, context.XRes)
+	yC := y0 + transformFloatCoord(yd, context.YRes)
+	r := transformFloatCoord(amp.AMModifiers[1].(float64), context.XRes) / 2
+	hr := transformFloatCoord(amp.AMModifiers[5].(float64), context.XRes) / 2
+	return circlePolygon(xC, yC, r, hr), exposure(amp.AMModifiers[0])
 }
 
 // Instantiates circle primitive
@@ -189,11 +190,11 @@ func (amp *AMPrimitiveCircle) Draw(x0, y0 int, x1, y1 int, context *Render) {
 	The rotation modifier is optional. The default is no rotation.
 5	Hole diameter (optional)
 */
-func (amp *AMPrimitiveCircle) Init(scale float64, params []float64) AMPrimitive {
+func (amp *AMPrimitiveCircle) Init(scale float64, params []float64) (AMPrimitive, error) {
 	if len(amp.AMModifiers) < 4 {
 		//panic("unable to create aperture macro primitive circle - not enough parameters, have " +
 		//	strconv.Itoa(len(amp.AMModifiers)) + ", need 4 or 5")
-		glog.Fatalln("unable to create aperture macro primitive circle - not enough parameters, " +
+		return nil, NewParseError("unable to create aperture macro primitive circle - not enough parameters, " +
 			strconv.Itoa(len(amp.AMModifiers)) + " given, need 4 or 5")
 	}
 	if len(amp.AMModifiers) == 4 {
@@ -205,7 +206,11 @@ func (amp *AMPrimitiveCircle) Init(scale float64, params []float64) AMPrimitive
 	}
 
 	for i := range amp.AMModifiers {
-		amp.AMModifiers[i] = convertToFloat(amp.AMModifiers[i], params)
+		f, err := convertToFloat(amp.AMModifiers[i], params)
+		if err != nil {
+			return nil, err
+		}
+		amp.AMModifiers[i] = f
 		if (i > 0 && i < 4) || i == 5 {
 			//switch amp.AMModifiers[i].(type) {
 			//case float64:
@@ -221,7 +226,7 @@ func (amp *AMPrimitiveCircle) Init(scale float64, params []float64) AMPrimitive
 	//amp.cirD = transformCoord(amp.AMModifiers[1].(float64), context.XRes)
 	//amp.cirHD = transformCoord(amp.AMModifiers[5].(float64), context.XRes)
 	//
-	return amp
+	return amp, nil
 }
 
 func (amp *AMPrimitiveCircle) Copy() AMPrimitive {
@@ -246,7 +251,7 @@ func (amp *AMPrimitiveVectLine) String() string {
 	return retVal
 }
 
-func (amp *AMPrimitiveVectLine) Render(x0, y0 int, context *Render) {
+func (amp *AMPrimitiveVectLine) Render(x0, y0 int, context *Render) error {
 	// if rotation = 0 use rectangle algorithm, polygon otherwise
 	rot := amp.AMModifiers[6].(float64)
 	width := transformCoord(amp.AMModifiers[1].(float64), context.XRes)
@@ -283,7 +288,9 @@ func (amp *AMPrimitiveVectLine) Render(x0, y0 int, context *Render) {
 		if amp.AMModifiers[0].(float64) == 0.0 {
 			colr = context.ClearColor
 		}
-		context.DrawFilledRectangle(x0+dx, y0+dy, width, height, colr)
+		if err := context.DrawFilledRectangle(x0+dx, y0+dy, width, height, colr); err != nil {
+			return err
+		}
 		context.MovePen(x0+dx, y0+dy, x0, y0, context.MovePenColor)
 	} else {
 		phi, _ := GetAngle(xer-xsr, yer-ysr)
@@ -314,23 +321,42 @@ func (amp *AMPrimitiveVectLine) Render(x0, y0 int, context *Render) {
 			colr = context.ClearColor
 		}
 
-		context.RenderOutline(&verticesX, &verticesY, colr)
+		if err := context.RenderOutline(&verticesX, &verticesY, colr); err != nil {
+			return err
+		}
 		context.MovePen(int(verticesX[0]), int(verticesY[0]), x0, y0, context.MovePenColor)
 	}
-	return
+	return nil
 }
 
-func (amp *AMPrimitiveVectLine) Draw(x0, y0 int, x1, y1 int, context *Render) {
-	BadMethod()
+func (amp *AMPrimitiveVectLine) Contours(x0, y0 float64, context *Render) (polyclip.Polygon, PolType) {
+	xs := amp.AMModifiers[2].(float64)
+	ys := amp.AMModifiers[3].(float64)
+	xe := amp.AMModifiers[4].(float64)
+	ye := amp.AMModifiers[5].(float64)
+	if xs == xe && ys == ye {
+		return nil, exposure(amp.AMModifiers[0])
+	}
+	phi := math.Atan2(ye-ys, xe-xs)
+	xd := (amp.AMModifiers[1].(float64) / 2) * math.Sin(phi)
+	yd := (amp.AMModifiers[1].(float64) / 2) * math.Cos(phi)
+	verticesX := []float64{xs + xd, xs - xd, xe - xd, xe + xd}
+	verticesY := []float64{ys - yd, ys + yd, ye + yd, ye - yd}
+	return polyclip.Polygon{macroContour(x0, y0, verticesX, verticesY, amp.AMModifiers[6].(float64), context)},
+		exposure(amp.AMModifiers[0])
 }
 
-func (amp *AMPrimitiveVectLine) Init(scale float64, params []float64) AMPrimitive {
+func (amp *AMPrimitiveVectLine) Init(scale float64, params []float64) (AMPrimitive, error) {
 	if len(amp.AMModifiers) < 7 {
-		glog.Fatalln("unable to create aperture macro primitive vector line - not enough parameters, " +
+		return nil, NewParseError("unable to create aperture macro primitive vector line - not enough parameters, " +
 			strconv.Itoa(len(amp.AMModifiers)) + " given, need 7")
 	}
 	for i := range amp.AMModifiers {
-		amp.AMModifiers[i] = convertToFloat(amp.AMModifiers[i], params)
+		f, err := convertToFloat(amp.AMModifiers[i], params)
+		if err != nil {
+			return nil, err
+		}
+		amp.AMModifiers[i] = f
 		if i > 0 && i < 6 {
 			switch amp.AMModifiers[i].(type) {
 			case float64:
@@ -339,7 +365,7 @@ func (amp *AMPrimitiveVectLine) Init(scale float64, params []float64) AMPrimitiv
 			}
 		}
 	}
-	return amp
+	return amp, nil
 }
 
 func (amp *AMPrimitiveVectLine) Copy() AMPrimitive {
@@ -364,7 +390,7 @@ func (amp *AMPrimitiveCenterLine) String() string {
 	return retVal
 }
 
-func (amp *AMPrimitiveCenterLine) Render(x0, y0 int, context *Render) {
+func (amp *AMPrimitiveCenterLine) Render(x0, y0 int, context *Render) error {
 	// if rotation = 0 use rectangle algorithm, polygon otherwise
 	// make VectorLine and use it
 
@@ -379,20 +405,31 @@ func (amp *AMPrimitiveCenterLine) Render(x0, y0 int, context *Render) {
 	}
 
 	var vLine = AMPrimitiveVectLine{AMPrimitive_VectLine, vLineModifs}
-	vLine.Render(x0, y0, context)
-	return
+	return vLine.Render(x0, y0, context)
 }
-func (amp *AMPrimitiveCenterLine) Draw(x0, y0 int, x1, y1 int, context *Render) {
-	BadMethod()
+
+func (amp *AMPrimitiveCenterLine) Contours(x0, y0 float64, context *Render) (polyclip.Polygon, PolType) {
+	w := amp.AMModifiers[1].(float64)
+	h := amp.AMModifiers[2].(float64)
+	xc := amp.AMModifiers[3].(float64)
+	yc := amp.AMModifiers[4].(float64)
+	verticesX := []float64{xc - w/2, xc + w/2, xc + w/2, xc - w/2}
+	verticesY := []float64{yc - h/2, yc - h/2, yc + h/2, yc + h/2}
+	return polyclip.Polygon{macroContour(x0, y0, verticesX, verticesY, amp.AMModifiers[5].(float64), context)},
+		exposure(amp.AMModifiers[0])
 }
 
-func (amp *AMPrimitiveCenterLine) Init(scale float64, params []float64) AMPrimitive {
+func (amp *AMPrimitiveCenterLine) Init(scale float64, params []float64) (AMPrimitive, error) {
 	if len(amp.AMModifiers) < 6 {
-		glog.Fatalln("unable to create aperture macro primitive center line - not enough parameters, " +
+		return nil, NewParseError("unable to create aperture macro primitive center line - not enough parameters, " +
 			strconv.Itoa(len(amp.AMModifiers)) + " given, need 6")
 	}
 	for i := range amp.AMModifiers {
-		amp.AMModifiers[i] = convertToFloat(amp.AMModifiers[i], params)
+		f, err := convertToFloat(amp.AMModifiers[i], params)
+		if err != nil {
+			return nil, err
+		}
+		amp.AMModifiers[i] = f
 		if i > 0 && i < 5 {
 			switch amp.AMModifiers[i].(type) {
 			case float64:
@@ -401,7 +438,7 @@ func (amp *AMPrimitiveCenterLine) Init(scale float64, params []float64) AMPrimit
 			}
 		}
 	}
-	return amp
+	return amp, nil
 }
 
 func (amp *AMPrimitiveCenterLine) Copy() AMPrimitive {
@@ -432,7 +469,7 @@ func (amp *AMPrimitiveOutLine) String() string {
 	return retVal
 }
 
-func (amp *AMPrimitiveOutLine) Render(x0, y0 int, context *Render) {
+func (amp *AMPrimitiveOutLine) Render(x0, y0 int, context *Render) error {
 	//	numCoordPairs := int(convertToFloat(amp.AMModifiers[1])) + 1
 	numCoordPairs := int(amp.AMModifiers[1].(float64)) + 1
 	rot := amp.AMModifiers[len(amp.AMModifiers)-1].(float64)
@@ -456,14 +493,24 @@ func (amp *AMPrimitiveOutLine) Render(x0, y0 int, context *Render) {
 		colr = context.ClearColor
 	}
 
-	context.RenderOutline(&verticesX, &verticesY, colr)
+	if err := context.RenderOutline(&verticesX, &verticesY, colr); err != nil {
+		return err
+	}
 	context.MovePen(int(verticesX[0]), int(verticesY[0]), x0, y0, context.MovePenColor)
-	return
+	return nil
 }
 
-func (amp *AMPrimitiveOutLine) Draw(x0, y0 int, x1, y1 int, context *Render) {
-	BadMethod()
-
+func (amp *AMPrimitiveOutLine) Contours(x0, y0 float64, context *Render) (polyclip.Polygon, PolType) {
+	numCoordPairs := int(amp.AMModifiers[1].(float64)) + 1
+	rot := amp.AMModifiers[len(amp.AMModifiers)-1].(float64)
+	verticesX := make([]float64, 0)
+	verticesY := make([]float64, 0)
+	for i := 2; i < 2+numCoordPairs*2; i += 2 {
+		verticesX = append(verticesX, amp.AMModifiers[i].(float64))
+		verticesY = append(verticesY, amp.AMModifiers[i+1].(float64))
+	}
+	return polyclip.Polygon{macroContour(x0, y0, verticesX, verticesY, rot, context)},
+		exposure(amp.AMModifiers[0])
 }
 
 /*
@@ -482,21 +529,29 @@ func (amp *AMPrimitiveOutLine) Draw(x0, y0 int, x1, y1 int, context *Render) {
 		The primitive is rotated around the origin of the macro definition, i.e. the
 		(0, 0) point of macro coordinates.
 */
-func (amp *AMPrimitiveOutLine) Init(scale float64, params []float64) AMPrimitive {
-	numCoordPairs := int(convertToFloat(amp.AMModifiers[1], params))
+func (amp *AMPrimitiveOutLine) Init(scale float64, params []float64) (AMPrimitive, error) {
+	numCoordPairsF, err := convertToFloat(amp.AMModifiers[1], params)
+	if err != nil {
+		return nil, err
+	}
+	numCoordPairs := int(numCoordPairsF)
 	if numCoordPairs < 3 {
-		glog.Fatalln("unable to create aperture macro primitive outline - not enough coordinate pairs, " +
+		return nil, NewParseError("unable to create aperture macro primitive outline - not enough coordinate pairs, " +
 			strconv.Itoa(numCoordPairs) + " given, need at least 3")
 	}
 	correctLength := 2 + numCoordPairs*2 + 1
 	if len(amp.AMModifiers) < correctLength {
-		glog.Fatalln("unable to create aperture macro primitive outline - not enough parameters, " +
+		return nil, NewParseError("unable to create aperture macro primitive outline - not enough parameters, " +
 			strconv.Itoa(len(amp.AMModifiers)) + " given, need " + strconv.Itoa(correctLength))
 	}
 	numCoordPairs++
 
 	for i := range amp.AMModifiers {
-		amp.AMModifiers[i] = convertToFloat(amp.AMModifiers[i], params)
+		f, err := convertToFloat(amp.AMModifiers[i], params)
+		if err != nil {
+			return nil, err
+		}
+		amp.AMModifiers[i] = f
 		if i > 2 && i < len(amp.AMModifiers)-2 {
 			switch amp.AMModifiers[i].(type) {
 			case float64:
@@ -505,7 +560,7 @@ func (amp *AMPrimitiveOutLine) Init(scale float64, params []float64) AMPrimitive
 			}
 		}
 	}
-	return amp
+	return amp, nil
 }
 
 func (amp *AMPrimitiveOutLine) Copy() AMPrimitive {
@@ -530,7 +585,7 @@ func (amp *AMPrimitivePolygon) String() string {
 	return retVal
 }
 
-func (amp *AMPrimitivePolygon) Render(x0, y0 int, context *Render) {
+func (amp *AMPrimitivePolygon) Render(x0, y0 int, context *Render) error {
 	rot := amp.AMModifiers[5].(float64)
 	numVertices := amp.AMModifiers[1].(float64)
 	centerX := amp.AMModifiers[2].(float64)
@@ -557,21 +612,40 @@ func (amp *AMPrimitivePolygon) Render(x0, y0 int, context *Render) {
 		colr = context.ClearColor
 	}
 
-	context.RenderOutline(&verticesX, &verticesY, context.RegionColor)
+	if err := context.RenderOutline(&verticesX, &verticesY, context.RegionColor); err != nil {
+		return err
+	}
 	context.MovePen(int(verticesX[0]), int(verticesY[0]), x0, y0, colr)
+	return nil
 }
 
-func (amp *AMPrimitivePolygon) Draw(x0, y0 int, x1, y1 int, context *Render) {
-	BadMethod()
+func (amp *AMPrimitivePolygon) Contours(x0, y0 float64, context *Render) (polyclip.Polygon, PolType) {
+	numVertices := int(amp.AMModifiers[1].(float64))
+	centerX := amp.AMModifiers[2].(float64)
+	centerY := amp.AMModifiers[3].(float64)
+	dia := amp.AMModifiers[4].(float64)
+	verticesX := make([]float64, 0)
+	verticesY := make([]float64, 0)
+	for i := 0; i < numVertices; i++ {
+		phi := float64(i) * 2 * math.Pi / float64(numVertices)
+		verticesX = append(verticesX, centerX+(dia/2)*math.Cos(phi))
+		verticesY = append(verticesY, centerY+(dia/2)*math.Sin(phi))
+	}
+	return polyclip.Polygon{macroContour(x0, y0, verticesX, verticesY, amp.AMModifiers[5].(float64), context)},
+		exposure(amp.AMModifiers[0])
 }
 
-func (amp *AMPrimitivePolygon) Init(scale float64, params []float64) AMPrimitive {
+func (amp *AMPrimitivePolygon) Init(scale float64, params []float64) (AMPrimitive, error) {
 	if len(amp.AMModifiers) < 6 {
-		glog.Fatalln("unable to create aperture macro primitive polygon - not enough parameters, " +
+		return nil, NewParseError("unable to create aperture macro primitive polygon - not enough parameters, " +
 			strconv.Itoa(len(amp.AMModifiers)) + " given, need 6")
 	}
 	for i := range amp.AMModifiers {
-		amp.AMModifiers[i] = convertToFloat(amp.AMModifiers[i], params)
+		f, err := convertToFloat(amp.AMModifiers[i], params)
+		if err != nil {
+			return nil, err
+		}
+		amp.AMModifiers[i] = f
 		if i > 1 && i < 5 {
 			switch amp.AMModifiers[i].(type) {
 			case float64:
@@ -580,7 +654,7 @@ func (amp *AMPrimitivePolygon) Init(scale float64, params []float64) AMPrimitive
 			}
 		}
 	}
-	return amp
+	return amp, nil
 }
 
 func (amp *AMPrimitivePolygon) Copy() AMPrimitive {
@@ -606,7 +680,7 @@ func (amp *AMPrimitiveMoire) String() string {
 	return retVal
 }
 
-func (amp *AMPrimitiveMoire) Render(x0, y0 int, context *Render) {
+func (amp *AMPrimitiveMoire) Render(x0, y0 int, context *Render) error {
 	outerDia := amp.AMModifiers[2].(float64)
 	rThickness := amp.AMModifiers[3].(float64)
 	gap := amp.AMModifiers[4].(float64)
@@ -620,7 +694,9 @@ func (amp *AMPrimitiveMoire) Render(x0, y0 int, context *Render) {
 		ring.AMModifiers = append(ring.AMModifiers, amp.AMModifiers[1].(float64)) // center Y
 		ring.AMModifiers = append(ring.AMModifiers, amp.AMModifiers[8].(float64)) // rot
 		ring.AMModifiers = append(ring.AMModifiers, outerDia-2*rThickness)        // thickness of the donut
-		ring.Render(x0, y0, context)
+		if err := ring.Render(x0, y0, context); err != nil {
+			return err
+		}
 		ringsCount++
 		ring.AMModifiers = []interface{}{}
 		outerDia = outerDia - 2*(rThickness+gap)
@@ -640,18 +716,43 @@ func (amp *AMPrimitiveMoire) Render(x0, y0 int, context *Render) {
 		vectLine.AMModifiers = append(vectLine.AMModifiers, amp.AMModifiers[0].(float64)+xHairLen/2) // end x
 		vectLine.AMModifiers = append(vectLine.AMModifiers, amp.AMModifiers[1].(float64))            // end Y
 		vectLine.AMModifiers = append(vectLine.AMModifiers, amp.AMModifiers[8].(float64))            // rot
-		vectLine.Render(x0, y0, context)
+		if err := vectLine.Render(x0, y0, context); err != nil {
+			return err
+		}
 		vectLine.AMModifiers[2] = amp.AMModifiers[0].(float64)
 		vectLine.AMModifiers[3] = amp.AMModifiers[1].(float64) - xHairLen/2
 		vectLine.AMModifiers[4] = amp.AMModifiers[0].(float64)
 		vectLine.AMModifiers[5] = amp.AMModifiers[1].(float64) + xHairLen/2
-		vectLine.Render(x0, y0, context)
+		return vectLine.Render(x0, y0, context)
 	}
-	return
+	return nil
 }
 
-func (amp *AMPrimitiveMoire) Draw(x0, y0 int, x1, y1 int, context *Render) {
-	BadMethod()
+func (amp *AMPrimitiveMoire) Contours(x0, y0 float64, context *Render) (polyclip.Polygon, PolType) {
+	outerDia := amp.AMModifiers[2].(float64)
+	rThickness := amp.AMModifiers[3].(float64)
+	gap := amp.AMModifiers[4].(float64)
+	maxNumRings := int(amp.AMModifiers[5].(float64))
+	parts := make([]polyclip.Polygon, 0)
+	for ringsCount := 0; ringsCount < maxNumRings && outerDia > 0; ringsCount++ {
+		ring := AMPrimitiveCircle{AMPrimitive_Circle, []interface{}{1.0, outerDia,
+			amp.AMModifiers[0].(float64), amp.AMModifiers[1].(float64), amp.AMModifiers[8].(float64),
+			math.Max(outerDia-2*rThickness, 0)}}
+		p, _ := ring.Contours(x0, y0, context)
+		parts = append(parts, p)
+		outerDia = outerDia - 2*(rThickness+gap)
+	}
+	xHairThickness := amp.AMModifiers[6].(float64)
+	xHairLen := amp.AMModifiers[7].(float64)
+	if (xHairThickness != 0) && (xHairLen != 0) {
+		for _, wh := range [2][2]float64{{xHairLen, xHairThickness}, {xHairThickness, xHairLen}} {
+			xHair := AMPrimitiveCenterLine{AMPrimitive_CenterLine, []interface{}{1.0, wh[0], wh[1],
+				amp.AMModifiers[0].(float64), amp.AMModifiers[1].(float64), amp.AMModifiers[8].(float64)}}
+			p, _ := xHair.Contours(x0, y0, context)
+			parts = append(parts, p)
+		}
+	}
+	return unionAll(parts), PolTypeDark
 }
 
 /*
@@ -672,13 +773,17 @@ func (amp *AMPrimitiveMoire) Draw(x0, y0 int, x1, y1 int, context *Render) {
 	(0, 0) point of macro coordinates.
 */
 
-func (amp *AMPrimitiveMoire) Init(scale float64, params []float64) AMPrimitive {
+func (amp *AMPrimitiveMoire) Init(scale float64, params []float64) (AMPrimitive, error) {
 	if len(amp.AMModifiers) < 7 {
-		glog.Fatalln("unable to create aperture macro primitive moire - not enough parameters, " +
+		return nil, NewParseError("unable to create aperture macro primitive moire - not enough parameters, " +
 			strconv.Itoa(len(amp.AMModifiers)) + " given, need 7")
 	}
 	for i := range amp.AMModifiers {
-		amp.AMModifiers[i] = convertToFloat(amp.AMModifiers[i], params)
+		f, err := convertToFloat(amp.AMModifiers[i], params)
+		if err != nil {
+			return nil, err
+		}
+		amp.AMModifiers[i] = f
 		if i < 5 || (i > 5 && i < 8) {
 			switch amp.AMModifiers[i].(type) {
 			case float64:
@@ -687,7 +792,7 @@ func (amp *AMPrimitiveMoire) Init(scale float64, params []float64) AMPrimitive {
 			}
 		}
 	}
-	return amp
+	return amp, nil
 }
 
 func (amp *AMPrimitiveMoire) Copy() AMPrimitive {
@@ -712,7 +817,7 @@ func (amp *AMPrimitiveThermal) String() string {
 	return retVal
 }
 
-func (amp *AMPrimitiveThermal) Render(x0, y0 int, context *Render) {
+func (amp *AMPrimitiveThermal) Render(x0, y0 int, context *Render) error {
 
 	rot := amp.AMModifiers[5].(float64)
 	innerRadius := amp.AMModifiers[3].(float64) / 2
@@ -765,7 +870,9 @@ func (amp *AMPrimitiveThermal) Render(x0, y0 int, context *Render) {
 		verticesYI[i] = float64(y0) + transformFloatCoord(verticesYI[i], context.YRes)
 	}
 	context.MovePen(x0, y0, int(verticesXI[0]), int(verticesYI[0]), context.MovePenColor)
-	context.RenderOutline(&verticesXI, &verticesYI, context.RegionColor)
+	if err := context.RenderOutline(&verticesXI, &verticesYI, context.RegionColor); err != nil {
+		return err
+	}
 	context.MovePen(int(verticesXI[0]), int(verticesYI[0]), x0, y0, context.MovePenColor)
 
 	for i := range verticesXII {
@@ -776,7 +883,9 @@ func (amp *AMPrimitiveThermal) Render(x0, y0 int, context *Render) {
 		verticesYII[i] = float64(y0) + transformFloatCoord(verticesYII[i], context.YRes)
 	}
 	context.MovePen(x0, y0, int(verticesXII[0]), int(verticesYII[0]), context.MovePenColor)
-	context.RenderOutline(&verticesXII, &verticesYII, context.RegionColor)
+	if err := context.RenderOutline(&verticesXII, &verticesYII, context.RegionColor); err != nil {
+		return err
+	}
 	context.MovePen(int(verticesXII[0]), int(verticesYII[0]), x0, y0, context.MovePenColor)
 
 	for i := range verticesXIII {
@@ -787,7 +896,9 @@ func (amp *AMPrimitiveThermal) Render(x0, y0 int, context *Render) {
 		verticesYIII[i] = float64(y0) + transformFloatCoord(verticesYIII[i], context.YRes)
 	}
 	context.MovePen(x0, y0, int(verticesXIII[0]), int(verticesYIII[0]), context.MovePenColor)
-	context.RenderOutline(&verticesXIII, &verticesYIII, context.RegionColor)
+	if err := context.RenderOutline(&verticesXIII, &verticesYIII, context.RegionColor); err != nil {
+		return err
+	}
 	context.MovePen(int(verticesXIII[0]), int(verticesYIII[0]), x0, y0, context.MovePenColor)
 
 	for i := range verticesXIV {
@@ -798,15 +909,55 @@ func (amp *AMPrimitiveThermal) Render(x0, y0 int, context *Render) {
 		verticesYIV[i] = float64(y0) + transformFloatCoord(verticesYIV[i], context.YRes)
 	}
 	context.MovePen(x0, y0, int(verticesXIV[0]), int(verticesYIV[0]), context.MovePenColor)
-	context.RenderOutline(&verticesXIV, &verticesYIV, context.RegionColor)
+	if err := context.RenderOutline(&verticesXIV, &verticesYIV, context.RegionColor); err != nil {
+		return err
+	}
 	context.MovePen(int(verticesXIV[0]), int(verticesYIV[0]), x0, y0, context.MovePenColor)
 
-	return
+	return nil
 }
 
-func (amp *AMPrimitiveThermal) Draw(x0, y0 int, x1, y1 int, context *Render) {
-	BadMethod()
-
+func (amp *AMPrimitiveThermal) Contours(x0, y0 float64, context *Render) (polyclip.Polygon, PolType) {
+	cx := amp.AMModifiers[0].(float64)
+	cy := amp.AMModifiers[1].(float64)
+	outerRadius := amp.AMModifiers[2].(float64) / 2
+	innerRadius := amp.AMModifiers[3].(float64) / 2
+	gap := amp.AMModifiers[4].(float64)
+	rot := amp.AMModifiers[5].(float64)
+	if gap/2 >= outerRadius {
+		return nil, PolTypeDark
+	}
+	// 1st quadrant part in the macro coordinates
+	verticesX := make([]float64, 0)
+	verticesY := make([]float64, 0)
+	if gap/2 < innerRadius {
+		phi0 := math.Asin((gap / 2) / innerRadius)
+		for _, p := range arcPoints(0, 0, innerRadius, phi0, math.Pi/2-2*phi0) {
+			verticesX = append(verticesX, p.X)
+			verticesY = append(verticesY, p.Y)
+		}
+	} else {
+		verticesX = append(verticesX, gap/2)
+		verticesY = append(verticesY, gap/2)
+	}
+	phi0 := math.Asin((gap / 2) / outerRadius)
+	for _, p := range arcPoints(0, 0, outerRadius, math.Pi/2-phi0, -(math.Pi/2 - 2*phi0)) {
+		verticesX = append(verticesX, p.X)
+		verticesY = append(verticesY, p.Y)
+	}
+	// the other quadrants are the 1st one rotated by 90, 180 and 270 degrees
+	retVal := make(polyclip.Polygon, 0, 4)
+	for q := 0; q < 4; q++ {
+		qX := make([]float64, len(verticesX))
+		qY := make([]float64, len(verticesY))
+		for i := range verticesX {
+			qX[i], qY[i], _ = RotatePoint(verticesX[i], verticesY[i], float64(q)*90.0)
+			qX[i] += cx
+			qY[i] += cy
+		}
+		retVal = append(retVal, macroContour(x0, y0, qX, qY, rot, context))
+	}
+	return retVal, PolTypeDark
 }
 
 /*
@@ -823,13 +974,17 @@ func (amp *AMPrimitiveThermal) Draw(x0, y0 int, x1, y1 int, context *Render) {
 	The primitive is rotated around the origin of the macro definition, i.e.
 	(0, 0) point of macro coordinates.
 */
-func (amp *AMPrimitiveThermal) Init(scale float64, params []float64) AMPrimitive {
+func (amp *AMPrimitiveThermal) Init(scale float64, params []float64) (AMPrimitive, error) {
 	if len(amp.AMModifiers) < 6 {
-		glog.Fatalln("unable to create aperture macro primitive thermal - not enough parameters, " +
+		return nil, NewParseError("unable to create aperture macro primitive thermal - not enough parameters, " +
 			strconv.Itoa(len(amp.AMModifiers)) + " given, need 6")
 	}
 	for i := range amp.AMModifiers {
-		amp.AMModifiers[i] = convertToFloat(amp.AMModifiers[i], params)
+		f, err := convertToFloat(amp.AMModifiers[i], params)
+		if err != nil {
+			return nil, err
+		}
+		amp.AMModifiers[i] = f
 		if i < 5 {
 			switch amp.AMModifiers[i].(type) {
 			case float64:
@@ -838,7 +993,7 @@ func (amp *AMPrimitiveThermal) Init(scale float64, params []float64) AMPrimitive
 			}
 		}
 	}
-	return amp
+	return amp, nil
 }
 
 func (amp *AMPrimitiveThermal) Copy() AMPrimitive {
@@ -957,26 +1112,39 @@ func NewApertureMacro(src string) (*ApertureMacro, error) {
 			for i := range modifiersArr {
 				modifInterfaceArr[i] = strings.TrimSpace(modifiersArr[i])
 			}
-			retVal.Primitives = append(retVal.Primitives, NewAMPrimitive(primType, modifInterfaceArr))
+			primitive := NewAMPrimitive(primType, modifInterfaceArr)
+			if primitive == nil {
+				return retVal, NewUnsupportedFeatureError("aperture macro primitive type " + strconv.Itoa(int(primType)))
+			}
+			retVal.Primitives = append(retVal.Primitives, primitive)
 		}
 	}
 	return retVal, nil
 }
 
-func (am *ApertureMacro) Render(x0, y0 int, context *Render) {
+func (am *ApertureMacro) Render(x0, y0 int, context *Render) error {
 
 	for i := range am.Primitives {
-		am.Primitives[i].Render(x0, y0, context)
+		if err := am.Primitives[i].Render(x0, y0, context); err != nil {
+			return err
+		}
 	}
-	return
+	return nil
 }
 
-func (am *ApertureMacro) Draw(x0, y0 int, x1, y1 int, context *Render) {
-
+// returns the shape of the macro flashed at x0, y0
+// the primitives with exposure off are subtracted from the shape
+func (am *ApertureMacro) Contours(x0, y0 float64, context *Render) polyclip.Polygon {
+	var retVal polyclip.Polygon
 	for i := range am.Primitives {
-		am.Primitives[i].Draw(x0, y0, x1, y1, context)
+		p, pol := am.Primitives[i].Contours(x0, y0, context)
+		if pol == PolTypeClear {
+			retVal = clip(retVal, p, polyclip.DIFFERENCE)
+		} else {
+			retVal = clip(retVal, p, polyclip.UNION)
+		}
 	}
-	return
+	return retVal
 }
 
 func (am *ApertureMacro) Init(scale float64, params []float64) ApertureMacro {
@@ -1025,7 +1193,8 @@ func ArrayInfo(inArray []interface{}, itemNames []string) string {
 }
 
 /* Aperture macro definitions extractor */
-func ExtractAMDefinitions(inStrings *stor.Storage) ([]*ApertureMacro, *stor.Storage) {
+// the source lines of the strings are kept in the returned storage
+func ExtractAMDefinitions(inStrings *stor.Storage) ([]*ApertureMacro, *stor.Storage, error) {
 	aMacroDict := make([]*ApertureMacro, 0)
 	retStorage := stor.NewStorage()
 	apMacroString := ""
@@ -1035,31 +1204,37 @@ func ExtractAMDefinitions(inStrings *stor.Storage) ([]*ApertureMacro, *stor.Stor
 		if len(gerberString) == 0 {
 			break
 		}
+		src := SourceRef{Line: inStrings.Line(), Command: gerberString}
 		/*------------------- aperture macro processing start ---------------- */
 		if strings.HasPrefix(gerberString, GerberApertureMacroDef) &&
 			strings.HasSuffix(gerberString, "%") {
 			apMacroString = gerberString
-			var err error
 			apMacroPtr, err := NewApertureMacro(apMacroString)
 			if err != nil {
-				checkError(err)
+				if _, ok := err.(Locator); ok == false {
+					err = NewParseError(err.Error())
+				}
+				return nil, nil, sourceError(err, &src)
 			}
 			aMacroDict = append(aMacroDict, apMacroPtr) // store correct aperture
 			apMacroString = ""
 			continue
 		}
 		// all unprocessed above goes here
-		retStorage.Accept(gerberString)
+		retStorage.AcceptLine(gerberString, src.Line)
 	}
-	return aMacroDict, retStorage
+	return aMacroDict, retStorage, nil
 }
 
 // Instantiates an aperture using definition and parameters
+// the macro apertures are searched in the aperture macro dictionary
 //
 // %ADD11CIRCLE,.5*%
 //     ^---------^
 //func NewApertureInstance(code int, name string, def string, scale float64) *Aperture {
-func NewApertureInstance(gerberString string, scale float64) *Aperture {
+// the error carries the offending aperture definition
+func NewApertureInstance(gerberString string, scale float64, aMacroDict []*ApertureMacro) (*Aperture, error) {
+	src := SourceRef{Command: gerberString}
 
 	apString := gerberString[4 : len(gerberString)-2]
 	var i int
@@ -1080,14 +1255,14 @@ func NewApertureInstance(gerberString string, scale float64) *Aperture {
 
 	retVal := new(Aperture)
 	if len(name) == 0 {
-		glog.Fatalln("bad aperture " + strconv.Itoa(code) + " name")
+		return nil, sourceError(NewParseError("bad aperture "+strconv.Itoa(code)+" name"), &src)
 	}
 	if len(name) == 1 && (name[0] == 'C' || name[0] == 'R' || name[0] == 'O' || name[0] == 'P') {
 		// it's ordinary aperture
 		err := retVal.Init2(code, name, def, scale)
 		if err != nil {
 			glog.Errorln(name + def)
-			glog.Fatalln(err)
+			return nil, sourceError(NewParseError(err.Error()), &src)
 		}
 
 	} else { // it's macro aperture
@@ -1105,15 +1280,15 @@ func NewApertureInstance(gerberString string, scale float64) *Aperture {
 		for i := range params {
 			flP, err := strconv.ParseFloat(params[i], 64)
 			if err != nil {
-				glog.Fatalln("non-number value found in macro parameters")
+				return nil, sourceError(NewParseError("non-number value found in macro parameters"), &src)
 			}
 			ParamsF = append(ParamsF, flP)
 		}
 
-		for j := range AMacroDict {
-			if strings.Compare(AMacroDict[j].Name, name) == 0 {
+		for j := range aMacroDict {
+			if strings.Compare(aMacroDict[j].Name, name) == 0 {
 
-				instance = AMacroDict[j].Copy()
+				instance = aMacroDict[j].Copy()
 
 				for k := 0; k < len(instance.Primitives); k++ {
 					for n := range instance.Variables {
@@ -1125,27 +1300,34 @@ func NewApertureInstance(gerberString string, scale float64) *Aperture {
 							}
 							varIndex, err := strconv.Atoi(instance.Variables[n].Name[1:])
 							if err != nil {
-								glog.Fatalln("bad variable name: " + instance.Variables[n].Name)
+								return nil, sourceError(NewParseError("bad variable name: "+instance.Variables[n].Name), &src)
 							}
 							addParamsF := varIndex - len(ParamsF)
 							for addParamsF > 0 {
 								ParamsF = append(ParamsF, 0.0)
 								addParamsF--
 							}
-							ParamsF[varIndex-1] = calculator.CalcExpression(instance.Variables[n].Value, &varStorage)
+							ParamsF[varIndex-1], err = calculator.CalcExpression(instance.Variables[n].Value, &varStorage)
+							if err != nil {
+								return nil, sourceError(NewParseError(err.Error()), &src)
+							}
 						}
 					}
-					instance.Primitives[k] = instance.Primitives[k].Init(scale, ParamsF)
+					primitive, err := instance.Primitives[k].Init(scale, ParamsF)
+					if err != nil {
+						return nil, sourceError(err, &src)
+					}
+					instance.Primitives[k] = primitive
 				}
 				break
 			}
 		}
 		if len(instance.Name) == 0 {
-			glog.Fatalln("unable to instantiate aperture macro " + strconv.Itoa(code) + name)
+			return nil, sourceError(NewParseError("unable to instantiate aperture macro "+strconv.Itoa(code)+name), &src)
 		}
 		retVal.MacroPtr = &instance
 	}
-	return retVal
+	return retVal, nil
 }
 
 // %ADD10C,0.0650*%
@@ -1258,13 +1440,13 @@ func (apert *Aperture) Init2(code int, name string, def string, scale float64) e
 	return err
 }
 
-func convertToFloat(arg interface{}, params []float64) float64 {
+func convertToFloat(arg interface{}, params []float64) (float64, error) {
 	panicString1 := "convertToFloat(arg interface{}) float64 - variables not implemented"
 	panicString2 := "convertToFloat(arg interface{}) float64 - not supported interface{}"
 	panicString3 := "convertToFloat(arg interface{}) float64 - variable has bad name: "
 	switch arg.(type) {
 	case float64:
-		return arg.(float64)
+		return arg.(float64), nil
 	case string:
 		if strings.Contains(arg.(string), "$") == true {
 			// detect expression
@@ -1275,34 +1457,54 @@ func convertToFloat(arg interface{}, params []float64) float64 {
 					varStorage["$"+strconv.Itoa(i+1)] = f
 				}
 				// calculate
-				retVal := calculator.CalcExpression(arg.(string), &varStorage)
-				//
-				return retVal
+				retVal, err := calculator.CalcExpression(arg.(string), &varStorage)
+				if err != nil {
+					return 0, NewParseError(err.Error())
+				}
+				return retVal, nil
 			}
 
 			varNum, err := strconv.Atoi(arg.(string)[1:])
 			if err != nil {
 				//				panic(panicString3 + arg.(string))
-				glog.Fatal(panicString3 + arg.(string))
+				return 0, NewParseError(panicString3 + arg.(string))
 			}
 			if len(params) >= varNum {
-				return params[varNum-1]
+				return params[varNum-1], nil
 			} else {
-				return 0
+				return 0, nil
 			}
 		} else {
 			retVal, err := strconv.ParseFloat(arg.(string), 64)
 			if err != nil {
-				glog.Fatal(panicString1)
+				return 0, NewParseError(panicString1)
 			}
-			return retVal
+			return retVal, nil
 		}
 	case int:
-		return float64(arg.(int))
+		return float64(arg.(int)), nil
 	default:
-		glog.Fatal(panicString2)
+		return 0, NewParseError(panicString2)
+	}
+}
+
+// returns the polarity of the primitive from its exposure modifier
+func exposure(arg interface{}) PolType {
+	if arg.(float64) == 0.0 {
+		return PolTypeClear
 	}
-	return 0
+	return PolTypeDark
+}
+
+// rotates the vertices given in the macro coordinates and converts them to the pixels
+func macroContour(x0, y0 float64, verticesX, verticesY []float64, rot float64, context *Render) polyclip.Contour {
+	retVal := make(polyclip.Contour, 0, len(verticesX))
+	for i := range verticesX {
+		x, y, _ := RotatePoint(verticesX[i], verticesY[i], rot)
+		retVal = append(retVal, polyclip.Point{X: x0 + transformFloatCoord(x, context.XRes),
+			Y: y0 + transformFloatCoord(y, context.YRes)})
+	}
+	return retVal
 }
 
 // limits arg by bandVal with respect of sign arg
@@ -1364,7 +1566,3 @@ func GetFirstQuadrantArc(r, phi0, phi1, arcStep float64) (vertX *[]float64, vert
 	return &pointsX, &pointsY
 
 }
-
-func BadMethod() {
-	glog.Fatal("the macro aperture can not be used to DRAW (D01*)")
-}
@@ -33,7 +33,7 @@ func TestAMPrimitiveType_String(t *testing.T) {
 
 func TestAMPrimitive_String(t *testing.T) {
 	aMPrimitive := AMPrimitivePolygon{AMPrimitive_Polygon, []interface{}{"0zzz", "1xxxxxx", "", "MODIFIER"}}
-	t.Logf(aMPrimitive.String())
+	t.Log(aMPrimitive.String())
 }
 
 func TestApertureMacro_String(t *testing.T) {
@@ -50,7 +50,7 @@ func TestApertureMacro_String(t *testing.T) {
 		[]string{"1st comment string", "2nd comment string", "3rd comment string"},
 		[]AMVariable{AMVariable{"AM VAR Name1", "val1", 0},
 			AMVariable{"AM VAR Name2", "val2", 2}, AMVariable{"AM VAR Name2", "", 0}},
-		[]AMPrimitive{aMPrimitive1, aMPrimitive2, aMPrimitive3, aMPrimitive4}}
+		[]AMPrimitive{&aMPrimitive1, &aMPrimitive2, &aMPrimitive3, &aMPrimitive4}}
 
 	t.Log(testApertureMacro.String())
 
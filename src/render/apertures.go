@@ -4,7 +4,7 @@
 package render
 
 import (
-	"errors"
+	"attributes"
 	"fmt"
 	. "gerberbasetypes"
 	glog "glog_t"
@@ -15,7 +15,9 @@ type BlockAperture struct {
 	StartStringNum int
 	Code           int
 	BodyStrings    []string
+	BodyLines      []int // source line numbers of the body strings
 	StepsPtr       []*State
+	Attributes     *attributes.Dictionary // aperture attributes in effect when the block was opened
 }
 
 //Print info
@@ -44,6 +46,7 @@ type Aperture struct {
 	RotAngle     float64
 	BlockPtr     *BlockAperture
 	MacroPtr     *ApertureMacro
+	Attributes   *attributes.Dictionary // aperture attributes in effect when the aperture was defined
 }
 
 func (apert *Aperture) GetCode() int {
@@ -69,12 +72,18 @@ func (apert *Aperture) String() string {
 	} else {
 		retVal = retVal + ArrayInfo([]interface{}{"<empty>"}, []string{"Macro"})
 	}
+	retVal = retVal + ArrayInfo([]interface{}{apert.Attributes.String()}, []string{"Attributes"})
 	return retVal
 }
 
-func (apert *Aperture) Render(xC int, yC int, render *Render) {
+func (apert *Aperture) Render(xC int, yC int, render *Render) error {
+	if render.ApTrans != nil && render.ApTrans.IsIdentity() == false {
+		// mirrored, rotated or scaled aperture is rendered as a polygon
+		render.FillPolygon(apert.TransformedContours(float64(xC), float64(yC), render.ApTrans, render), render.ApColor)
+		return nil
+	}
 	if apert.Type == AptypeMacro {
-		apert.MacroPtr.Render(xC, yC, render)
+		return apert.MacroPtr.Render(xC, yC, render)
 	} else {
 		w := transformCoord(apert.XSize, render.XRes)
 		h := transformCoord(apert.YSize, render.YRes)
@@ -82,7 +91,7 @@ func (apert *Aperture) Render(xC int, yC int, render *Render) {
 		hd := transformCoord(apert.HoleDiameter, render.XRes)
 		switch apert.Type {
 		case AptypeRectangle:
-			render.DrawFilledRectangle(xC, yC, w, h, render.ApColor)
+			return render.DrawFilledRectangle(xC, yC, w, h, render.ApColor)
 		case AptypeCircle:
 			render.DrawDonut(xC, yC, d, hd, render.ApColor)
 		case AptypeObround:
@@ -92,7 +101,7 @@ func (apert *Aperture) Render(xC int, yC int, render *Render) {
 				if hd != 0 {
 					glog.Error("Obround apertures with holes ain't supported.\n" + apert.String())
 				}
-				render.DrawObRound(xC, yC, w, h, 0, render.ObRoundColor)
+				return render.DrawObRound(xC, yC, w, h, 0, render.ObRoundColor)
 			}
 		case AptypePoly:
 			//			render.DrawDonut(xC, yC, d, hd, render.MissedColor)
@@ -110,15 +119,11 @@ func (apert *Aperture) Render(xC int, yC int, render *Render) {
 						float64(apert.RotAngle),
 						float64(apert.HoleDiameter)}},
 				}}
-			polyAperture.Render(xC, yC, render)
+			return polyAperture.Render(xC, yC, render)
 
 		default:
-			checkError(errors.New("bad aperture type found"))
-			break
+			return NewUnsupportedFeatureError("aperture type " + apert.Type.String())
 		}
 	}
-}
-
-func (apert *Aperture) Draw(x0, y0 int, x1, y1 int, context *Render) {
-
+	return nil
 }
@@ -0,0 +1,556 @@
+/*
+################################## Contours ######################################
+converts the apertures, draws and regions to the polygons
+all the coordinates are pixels of rc.Img but in float64
+*/
+package render
+
+import (
+	. "gerberbasetypes"
+	"github.com/akavel/polyclip-go"
+	glog "glog_t"
+	"math"
+	"sort"
+)
+
+// max. distance between an arc and its chord, pixels
+const arcTolerance = 0.25
+
+// returns the number of the segments to approximate a circle of radius r
+func circleSegments(r float64) int {
+	if r <= arcTolerance*2 {
+		return 8
+	}
+	n := int(math.Ceil(math.Pi / math.Acos(1-arcTolerance/r)))
+	if n < 8 {
+		n = 8
+	}
+	return n
+}
+
+// returns the points of an arc, both ends included
+// phi0 - start angle, sweep - signed arc angle, radians
+func arcPoints(xc, yc, r, phi0, sweep float64) []polyclip.Point {
+	n := int(math.Ceil(math.Abs(sweep) / (2 * math.Pi) * float64(circleSegments(r))))
+	if n < 1 {
+		n = 1
+	}
+	retVal := make([]polyclip.Point, 0, n+1)
+	for i := 0; i <= n; i++ {
+		phi := phi0 + sweep*float64(i)/float64(n)
+		retVal = append(retVal, polyclip.Point{X: xc + r*math.Cos(phi), Y: yc + r*math.Sin(phi)})
+	}
+	return retVal
+}
+
+func circleContour(xc, yc, r float64) polyclip.Contour {
+	pts := arcPoints(xc, yc, r, 0, 2*math.Pi)
+	return polyclip.Contour(pts[:len(pts)-1])
+}
+
+// returns a circle or a donut
+func circlePolygon(xc, yc, r, holeR float64) polyclip.Polygon {
+	if r <= 0 {
+		return nil
+	}
+	retVal := polyclip.Polygon{circleContour(xc, yc, r)}
+	return addHole(retVal, xc, yc, holeR)
+}
+
+// adds the round hole to the polygon
+func addHole(p polyclip.Polygon, xc, yc, holeR float64) polyclip.Polygon {
+	if holeR > 0 && len(p) > 0 {
+		p = append(p, circleContour(xc, yc, holeR))
+	}
+	return p
+}
+
+func rectangleContour(xc, yc, w, h float64) polyclip.Contour {
+	return polyclip.Contour{
+		{X: xc - w/2, Y: yc - h/2},
+		{X: xc + w/2, Y: yc - h/2},
+		{X: xc + w/2, Y: yc + h/2},
+		{X: xc - w/2, Y: yc + h/2},
+	}
+}
+
+// returns the shape of a line drawn by a round brush of radius r from x0,y0 to x1,y1
+func stadiumContour(x0, y0, x1, y1, r float64) polyclip.Contour {
+	if x0 == x1 && y0 == y1 {
+		return circleContour(x0, y0, r)
+	}
+	theta := math.Atan2(y1-y0, x1-x0)
+	retVal := polyclip.Contour(arcPoints(x1, y1, r, theta-math.Pi/2, math.Pi))
+	return append(retVal, arcPoints(x0, y0, r, theta+math.Pi/2, math.Pi)...)
+}
+
+// returns the convex hull of the points (monotone chain)
+func convexHull(pts []polyclip.Point) polyclip.Contour {
+	p := make([]polyclip.Point, len(pts))
+	copy(p, pts)
+	sort.Slice(p, func(i, j int) bool {
+		if p[i].X == p[j].X {
+			return p[i].Y < p[j].Y
+		}
+		return p[i].X < p[j].X
+	})
+	if len(p) < 3 {
+		return polyclip.Contour(p)
+	}
+	cross := func(o, a, b polyclip.Point) float64 {
+		return (a.X-o.X)*(b.Y-o.Y) - (a.Y-o.Y)*(b.X-o.X)
+	}
+	hull := make([]polyclip.Point, 0, 2*len(p))
+	for _, pt := range p {
+		for len(hull) >= 2 && cross(hull[len(hull)-2], hull[len(hull)-1], pt) <= 0 {
+			hull = hull[:len(hull)-1]
+		}
+		hull = append(hull, pt)
+	}
+	lower := len(hull) + 1
+	for i := len(p) - 2; i >= 0; i-- {
+		for len(hull) >= lower && cross(hull[len(hull)-2], hull[len(hull)-1], p[i]) <= 0 {
+			hull = hull[:len(hull)-1]
+		}
+		hull = append(hull, p[i])
+	}
+	return polyclip.Contour(hull[:len(hull)-1])
+}
+
+// returns the shape of an arc drawn by a round brush of radius a
+// xc, yc - center, r - radius, phi0 - start angle, sweep - signed arc angle
+func arcDrawPolygon(xc, yc, r, phi0, sweep, a float64) polyclip.Polygon {
+	ri := r - a
+	ro := r + a
+	if math.Abs(sweep) >= 2*math.Pi {
+		// full circle
+		return circlePolygon(xc, yc, ro, ri)
+	}
+	if ri <= 0 {
+		// the brush is bigger than the arc radius, the shape is the union of the lines
+		pts := arcPoints(xc, yc, r, phi0, sweep)
+		lines := make([]polyclip.Polygon, 0, len(pts))
+		for i := 1; i < len(pts); i++ {
+			lines = append(lines, polyclip.Polygon{stadiumContour(pts[i-1].X, pts[i-1].Y, pts[i].X, pts[i].Y, a)})
+		}
+		return unionAll(lines)
+	}
+	if math.Abs(sweep) > math.Pi {
+		// the caps of a long arc may overlap, so the arc is split into two halves,
+		// the halves overlap, polyclip breaks the union of the halves sharing the cap in the middle
+		return checkedUnion(arcDrawPolygon(xc, yc, r, phi0, sweep*9/16, a),
+			arcDrawPolygon(xc, yc, r, phi0+sweep*7/16, sweep*9/16, a))
+	}
+	phi1 := phi0 + sweep
+	capSweep := math.Copysign(math.Pi, sweep)
+	retVal := polyclip.Contour(arcPoints(xc, yc, ro, phi0, sweep))
+	retVal = append(retVal, arcPoints(xc+r*math.Cos(phi1), yc+r*math.Sin(phi1), a, phi1, capSweep)...)
+	retVal = append(retVal, arcPoints(xc, yc, ri, phi1, -sweep)...)
+	retVal = append(retVal, arcPoints(xc+r*math.Cos(phi0), yc+r*math.Sin(phi0), a, phi0+math.Pi, capSweep)...)
+	return polyclip.Polygon{retVal}
+}
+
+// grid step of the swept shapes, pixels
+const snapGrid = 1e-6
+
+// returns the copy of the polygon moved by dx, dy
+// the coordinates are snapped to the grid, otherwise the union of the pieces
+// sharing the vertices is broken by the rounding errors
+func translatePolygon(p polyclip.Polygon, dx, dy float64) polyclip.Polygon {
+	snap := func(v float64) float64 {
+		return math.Round(v/snapGrid) * snapGrid
+	}
+	retVal := make(polyclip.Polygon, len(p))
+	for i, c := range p {
+		retVal[i] = make(polyclip.Contour, len(c))
+		for j := range c {
+			retVal[i][j] = polyclip.Point{X: snap(c[j].X + dx), Y: snap(c[j].Y + dy)}
+		}
+	}
+	return retVal
+}
+
+// returns the pieces of the shape swept along the straight line by dx, dy
+// the union of the pieces is the Minkowski sum of the shape and the line:
+// the shape at both ends and the band swept by every edge of the shape
+func sweepPieces(shape polyclip.Polygon, dx, dy float64) []polyclip.Polygon {
+	start := translatePolygon(shape, 0, 0)
+	retVal := []polyclip.Polygon{start}
+	if dx == 0 && dy == 0 {
+		return retVal
+	}
+	end := translatePolygon(shape, dx, dy)
+	retVal = append(retVal, end)
+	for k, c := range start {
+		for i := range c {
+			i1 := (i + 1) % len(c)
+			// the edge parallel to the line sweeps no area
+			if math.Abs((c[i1].X-c[i].X)*dy-(c[i1].Y-c[i].Y)*dx) < 1e-9 {
+				continue
+			}
+			retVal = append(retVal, polyclip.Polygon{{c[i], c[i1], end[k][i1], end[k][i]}})
+		}
+	}
+	return retVal
+}
+
+// returns the shape of a path drawn by an arbitrary brush
+// the brush shape is placed at the first point of the path
+// the holes of the brush are swept apart: the part of a hole left is the hole at all the points of the path
+func sweepPolygon(shape polyclip.Polygon, path []polyclip.Point) polyclip.Polygon {
+	if len(path) == 0 {
+		return nil
+	}
+	outers, holes := splitHoles(shape)
+	pieces := make([]polyclip.Polygon, 0)
+	for i := 1; i < len(path); i++ {
+		dx, dy := path[i-1].X-path[0].X, path[i-1].Y-path[0].Y
+		for _, c := range outers {
+			s := translatePolygon(polyclip.Polygon{c}, dx, dy)
+			if isConvex(c) == true {
+				// the hulls of the brush at three points of the path overlap by the area,
+				// the union of them is more reliable than the union of the pieces sharing the edges
+				pts := append([]polyclip.Point{}, s[0]...)
+				pts = append(pts, translatePolygon(s, path[i].X-path[i-1].X, path[i].Y-path[i-1].Y)[0]...)
+				pieces = append(pieces, polyclip.Polygon{convexHull(pts)})
+				continue
+			}
+			pieces = append(pieces, sweepPieces(s, path[i].X-path[i-1].X, path[i].Y-path[i-1].Y)...)
+		}
+	}
+	if len(pieces) == 0 {
+		return shape
+	}
+	// the neighbour pieces share the edges, so the odd and the even ones are merged apart
+	even := make([]polyclip.Polygon, 0)
+	odd := make([]polyclip.Polygon, 0)
+	for k := range pieces {
+		if k%2 == 0 {
+			even = append(even, pieces[k])
+		} else {
+			odd = append(odd, pieces[k])
+		}
+	}
+	retVal := checkedUnion(checkedUnionAll(even), checkedUnionAll(odd))
+	for _, h := range holes {
+		left := polyclip.Polygon{h}
+		for i := 1; i < len(path) && len(left) > 0; i++ {
+			left = clip(left, translatePolygon(polyclip.Polygon{h}, path[i].X-path[0].X, path[i].Y-path[0].Y), polyclip.INTERSECTION)
+		}
+		retVal = clip(retVal, left, polyclip.DIFFERENCE)
+	}
+	return retVal
+}
+
+// returns the union of the polygons checking each merge
+func checkedUnionAll(polys []polyclip.Polygon) polyclip.Polygon {
+	switch len(polys) {
+	case 0:
+		return nil
+	case 1:
+		return polys[0]
+	default:
+	}
+	half := len(polys) / 2
+	return checkedUnion(checkedUnionAll(polys[:half]), checkedUnionAll(polys[half:]))
+}
+
+// returns the union of two polygons
+// the union is never smaller than its parts, polyclip fails on the edges lying close to each other sometimes,
+// then the union is repeated with one of the polygons moved by a fraction of the plotter step
+func checkedUnion(a, b polyclip.Polygon) polyclip.Polygon {
+	least := math.Max(polygonArea(a), polygonArea(b))
+	for _, shift := range []float64{0, 1e-3, -1e-3, 1e-2} {
+		retVal := clip(a, translatePolygon(b, shift, shift/2), polyclip.UNION)
+		if polygonArea(retVal) >= least*(1-1e-6) {
+			return retVal
+		}
+	}
+	glog.Warningln("unable to merge the polygons, the bigger one is used")
+	if polygonArea(a) >= polygonArea(b) {
+		return a
+	}
+	return b
+}
+
+// returns the area of the polygon, the holes are subtracted
+func polygonArea(p polyclip.Polygon) float64 {
+	outers, holes := splitHoles(p)
+	area := func(c polyclip.Contour) float64 {
+		retVal := 0.0
+		for i := range c {
+			j := (i + 1) % len(c)
+			retVal += c[i].X*c[j].Y - c[j].X*c[i].Y
+		}
+		return math.Abs(retVal) / 2
+	}
+	retVal := 0.0
+	for _, c := range outers {
+		retVal += area(c)
+	}
+	for _, c := range holes {
+		retVal -= area(c)
+	}
+	return retVal
+}
+
+// splits the polygon to the outer contours and the holes, the hole is inside an odd number of the other contours
+func splitHoles(p polyclip.Polygon) (outers, holes []polyclip.Contour) {
+	for i, c := range p {
+		if len(c) == 0 {
+			continue
+		}
+		depth := 0
+		for j, other := range p {
+			if j != i && pointInContour(other, c[0]) == true {
+				depth++
+			}
+		}
+		if depth%2 == 1 {
+			holes = append(holes, c)
+		} else {
+			outers = append(outers, c)
+		}
+	}
+	return outers, holes
+}
+
+// even-odd test of the point
+func pointInContour(c polyclip.Contour, pt polyclip.Point) bool {
+	retVal := false
+	for i := range c {
+		a, b := c[i], c[(i+1)%len(c)]
+		if (a.Y > pt.Y) != (b.Y > pt.Y) && pt.X < a.X+(pt.Y-a.Y)/(b.Y-a.Y)*(b.X-a.X) {
+			retVal = !retVal
+		}
+	}
+	return retVal
+}
+
+// returns true if the contour turns in one direction
+func isConvex(c polyclip.Contour) bool {
+	sign := 0.0
+	for i := range c {
+		a, b, d := c[i], c[(i+1)%len(c)], c[(i+2)%len(c)]
+		cross := (b.X-a.X)*(d.Y-b.Y) - (b.Y-a.Y)*(d.X-b.X)
+		if math.Abs(cross) < 1e-9 {
+			continue
+		}
+		if sign == 0 {
+			sign = cross
+		} else if (sign > 0) != (cross > 0) {
+			return false
+		}
+	}
+	return true
+}
+
+/* ### polygon operations ### */
+
+// performs the boolean operation, empty polygons are allowed
+func clip(a, b polyclip.Polygon, op polyclip.Op) polyclip.Polygon {
+	if len(a) == 0 {
+		if op == polyclip.UNION || op == polyclip.XOR {
+			return b
+		}
+		return nil
+	}
+	if len(b) == 0 {
+		if op == polyclip.INTERSECTION {
+			return nil
+		}
+		return a
+	}
+	return a.Construct(op, b)
+}
+
+// returns the union of the polygons, merges them pairwise to keep the polygons small
+func unionAll(polys []polyclip.Polygon) polyclip.Polygon {
+	switch len(polys) {
+	case 0:
+		return nil
+	case 1:
+		return polys[0]
+	default:
+	}
+	half := len(polys) / 2
+	return clip(unionAll(polys[:half]), unionAll(polys[half:]), polyclip.UNION)
+}
+
+/* ### apertures ### */
+
+// returns the shape of the aperture flashed at xC, yC
+func (apert *Aperture) Contours(xC, yC float64, render *Render) polyclip.Polygon {
+	if apert.Type == AptypeMacro {
+		return apert.MacroPtr.Contours(xC, yC, render)
+	}
+	w := transformFloatCoord(apert.XSize, render.XRes)
+	h := transformFloatCoord(apert.YSize, render.YRes)
+	d := transformFloatCoord(apert.Diameter, render.XRes)
+	hd := transformFloatCoord(apert.HoleDiameter, render.XRes)
+	switch apert.Type {
+	case AptypeRectangle:
+		return addHole(polyclip.Polygon{rectangleContour(xC, yC, w, h)}, xC, yC, hd/2)
+	case AptypeCircle:
+		return circlePolygon(xC, yC, d/2, hd/2)
+	case AptypeObround:
+		var retVal polyclip.Contour
+		if w > h {
+			retVal = stadiumContour(xC-(w-h)/2, yC, xC+(w-h)/2, yC, h/2)
+		} else {
+			retVal = stadiumContour(xC, yC-(h-w)/2, xC, yC+(h-w)/2, w/2)
+		}
+		return addHole(polyclip.Polygon{retVal}, xC, yC, hd/2)
+	case AptypePoly:
+		polyPrimitive := AMPrimitivePolygon{AMPrimitive_Polygon,
+			[]interface{}{1.0, float64(apert.Vertices), 0.0, 0.0, apert.Diameter, apert.RotAngle}}
+		retVal, _ := polyPrimitive.Contours(xC, yC, render)
+		return addHole(retVal, xC, yC, hd/2)
+	default:
+		glog.Errorln("unable to get the contours of the aperture", apert.Code, apert.Type.String())
+	}
+	return nil
+}
+
+// returns the shape of the aperture flashed at xC, yC with the transformation parameters
+func (apert *Aperture) TransformedContours(xC, yC float64, atp *ApTransParameters, render *Render) polyclip.Polygon {
+	retVal := apert.Contours(xC, yC, render)
+	if atp == nil || atp.IsIdentity() {
+		return retVal
+	}
+	for _, c := range retVal {
+		for i := range c {
+			// the transformation is done in mm around the aperture origin
+			x, y := atp.Apply((c[i].X-xC)*render.XRes, (c[i].Y-yC)*render.YRes)
+			c[i].X = xC + transformFloatCoord(x, render.XRes)
+			c[i].Y = yC + transformFloatCoord(y, render.YRes)
+		}
+	}
+	return retVal
+}
+
+// returns the shape of the aperture used as a brush at xC, yC
+// the holes of the standard apertures do not affect the drawn shape
+func (apert *Aperture) brushContours(xC, yC float64, atp *ApTransParameters, render *Render) polyclip.Polygon {
+	retVal := apert.TransformedContours(xC, yC, atp, render)
+	if apert.Type != AptypeMacro && len(retVal) > 1 {
+		retVal = retVal[:1]
+	}
+	return retVal
+}
+
+/* ### steps ### */
+
+// returns the shape of the object created by the step, nil if there is no object
+// regions are processed by regionPolygon
+func (step *State) Contours(rc *Render) polyclip.Polygon {
+	if step.Action == OpcodeD02_MOVE || step.CurrentAp == nil {
+		return nil
+	}
+	xc := transformFloatCoord(step.Coord.GetX()-rc.MinX, rc.XRes)
+	yc := transformFloatCoord(step.Coord.GetY()-rc.MinY, rc.YRes)
+	if step.Action == OpcodeD03_FLASH {
+		return step.CurrentAp.TransformedContours(xc, yc, &step.ApTransParams, rc)
+	}
+	if step.Action != OpcodeD01_DRAW {
+		return nil
+	}
+	var prevX, prevY float64
+	if step.PrevCoord != nil {
+		prevX = step.PrevCoord.GetX()
+		prevY = step.PrevCoord.GetY()
+	}
+	xp := transformFloatCoord(prevX-rc.MinX, rc.XRes)
+	yp := transformFloatCoord(prevY-rc.MinY, rc.YRes)
+
+	if step.IpMode == IPModeLinear {
+		switch step.CurrentAp.Type {
+		case AptypeCircle:
+			a := transformFloatCoord(step.CurrentAp.Diameter*step.ApTransParams.Scale, rc.XRes) / 2
+			return polyclip.Polygon{stadiumContour(xp, yp, xc, yc, a)}
+		case AptypeRectangle:
+			corners := make([]polyclip.Point, 0, 8)
+			for _, c := range rectangleContour(0, 0, step.CurrentAp.XSize, step.CurrentAp.YSize) {
+				x, y := step.ApTransParams.Apply(c.X, c.Y)
+				x = transformFloatCoord(x, rc.XRes)
+				y = transformFloatCoord(y, rc.YRes)
+				corners = append(corners, polyclip.Point{X: xp + x, Y: yp + y}, polyclip.Point{X: xc + x, Y: yc + y})
+			}
+			return polyclip.Polygon{convexHull(corners)}
+		default:
+			// any other aperture is swept along the line
+			shape := step.CurrentAp.brushContours(xp, yp, &step.ApTransParams, rc)
+			return sweepPolygon(shape, []polyclip.Point{{X: xp, Y: yp}, {X: xc, Y: yc}})
+		}
+	}
+
+	// circular interpolation
+	cx, cy, r, phi0, sweep, ok := step.arcCircle(rc, xp, yp, xc, yc)
+	if ok == false {
+		// zero length single quadrant arc
+		return step.CurrentAp.brushContours(xc, yc, &step.ApTransParams, rc)
+	}
+	if step.CurrentAp.Type == AptypeCircle {
+		a := transformFloatCoord(step.CurrentAp.Diameter*step.ApTransParams.Scale, rc.XRes) / 2
+		return arcDrawPolygon(cx, cy, r, phi0, sweep, a)
+	}
+	// the aperture is swept along the chords of the arc
+	path := arcPoints(cx, cy, r, phi0, sweep)
+	shape := step.CurrentAp.brushContours(path[0].X, path[0].Y, &step.ApTransParams, rc)
+	return sweepPolygon(shape, path)
+}
+
+// returns the circle of the arc drawn by the step from xp, yp to xc, yc (pixels):
+// the center, the radius, the start angle and the signed sweep,
+// false if the single quadrant arc has zero length
+func (step *State) arcCircle(rc *Render, xp, yp, xc, yc float64) (float64, float64, float64, float64, float64, bool) {
+	var prevX, prevY float64
+	if step.PrevCoord != nil {
+		prevX = step.PrevCoord.GetX()
+		prevY = step.PrevCoord.GetY()
+	}
+	i := step.Coord.GetI()
+	j := step.Coord.GetJ()
+	if step.QMode == QuadModeSingle {
+		if prevX == step.Coord.GetX() && prevY == step.Coord.GetY() {
+			return 0, 0, 0, 0, 0, false
+		}
+		i, j = singleQuadrantOffsets(prevX, prevY, step.Coord.GetX(), step.Coord.GetY(), i, j, step.IpMode)
+	}
+	cx := xp + transformFloatCoord(i, rc.XRes)
+	cy := yp + transformFloatCoord(j, rc.YRes)
+	r := (math.Hypot(xp-cx, yp-cy) + math.Hypot(xc-cx, yc-cy)) / 2
+	phi0 := math.Atan2(yp-cy, xp-cx)
+	sweep := math.Atan2(yc-cy, xc-cx) - phi0
+	if step.IpMode == IPModeCCwC {
+		if sweep <= 0 {
+			sweep += 2 * math.Pi
+		}
+	} else {
+		if sweep >= 0 {
+			sweep -= 2 * math.Pi
+		}
+	}
+	return cx, cy, r, phi0, sweep, true
+}
+
+// returns the shape of the region built from the steps
+func (rc *Render) regionPolygon(steps []*State) (polyclip.Polygon, error) {
+	savedPolygon := rc.PolygonPtr
+	rc.PolygonPtr = NewPolygon(steps[0].Region.G36StringNumber)
+	*rc.PolygonPtr.steps = append(*rc.PolygonPtr.steps, steps...)
+	contours := make([]polyclip.Polygon, 0)
+	err := rc.processContours(func(verticesX *[]float64, verticesY *[]float64) error {
+		c := make(polyclip.Contour, len(*verticesX))
+		for i := range *verticesX {
+			c[i] = polyclip.Point{X: (*verticesX)[i], Y: (*verticesY)[i]}
+		}
+		contours = append(contours, polyclip.Polygon{c})
+		return nil
+	})
+	rc.PolygonPtr = savedPolygon
+	if err != nil {
+		return nil, err
+	}
+	return unionAll(contours), nil
+}
@@ -0,0 +1,80 @@
+package render
+
+import (
+	"github.com/akavel/polyclip-go"
+	"math"
+	"testing"
+)
+
+// even-odd point in polygon test
+func insidePolygon(p polyclip.Polygon, x, y float64) bool {
+	retVal := false
+	for _, c := range p {
+		for i := range c {
+			p0 := c[i]
+			p1 := c[(i+1)%len(c)]
+			if (p0.Y > y) != (p1.Y > y) && x < p0.X+(y-p0.Y)/(p1.Y-p0.Y)*(p1.X-p0.X) {
+				retVal = !retVal
+			}
+		}
+	}
+	return retVal
+}
+
+func TestSweepPolygon(t *testing.T) {
+	square := polyclip.Polygon{rectangleContour(0, 0, 10, 10)}
+	line := sweepPolygon(square, []polyclip.Point{{X: 0, Y: 0}, {X: 50, Y: 0}})
+	in := [][2]float64{{-4, -4}, {25, 4}, {54, 4}}
+	out := [][2]float64{{-6, 0}, {25, 6}, {56, 0}}
+	for _, p := range in {
+		if !insidePolygon(line, p[0], p[1]) {
+			t.Error("the point", p, "must be inside the line")
+		}
+	}
+	for _, p := range out {
+		if insidePolygon(line, p[0], p[1]) {
+			t.Error("the point", p, "must be outside the line")
+		}
+	}
+
+	// the square swept along the upper half of the circle of radius 20
+	square = polyclip.Polygon{rectangleContour(20, 0, 4, 4)}
+	arc := sweepPolygon(square, arcPoints(0, 0, 20, 0, math.Pi))
+	in = [][2]float64{{0, 21.5}, {21.5, -1.5}, {-21.5, -1.5}, {14.1, 14.1}}
+	out = [][2]float64{{0, 23}, {0, 0}, {0, -5}, {0, 17}}
+	for _, p := range in {
+		if !insidePolygon(arc, p[0], p[1]) {
+			t.Error("the point", p, "must be inside the arc")
+		}
+	}
+	for _, p := range out {
+		if insidePolygon(arc, p[0], p[1]) {
+			t.Error("the point", p, "must be outside the arc")
+		}
+	}
+}
+
+// the shape drawn by the rotated brush along the rotated path has the same area at any angle
+func TestSweepPolygonRotated(t *testing.T) {
+	ring := clip(circlePolygon(0, 0, 24, 0), circlePolygon(0, 0, 10, 0), polyclip.DIFFERENCE)
+	for name, brush := range map[string]polyclip.Polygon{"rectangle": {rectangleContour(0, 0, 32, 16)}, "ring": ring} {
+		if _, holes := splitHoles(brush); name == "ring" && len(holes) != 1 {
+			t.Fatal("the hole of the ring is not found")
+		}
+		first := 0.0
+		for deg := 0.0; deg < 360; deg += 15 {
+			for _, sweep := range []float64{-2.5, 2.5} {
+				sin, cos := math.Sincos(deg2Rad(deg))
+				shape := rotatePolygon(brush, sin, cos)
+				path := arcPoints(500, 500, 120, deg2Rad(deg), sweep)
+				area := polygonArea(sweepPolygon(translatePolygon(shape, path[0].X, path[0].Y), path))
+				if first == 0 {
+					first = area
+				}
+				if math.Abs(area-first) > first*1e-3 {
+					t.Error(name, "swept at", deg, "degrees along", sweep, "radians has the area", area, "expected", first)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,647 @@
+/*
+Fills the areas of the flashes, the regions and the draws by the pen strokes
+*/
+package render
+
+import (
+	"errors"
+	"github.com/akavel/polyclip-go"
+	"github.com/spf13/viper"
+	glog "glog_t"
+	"image/color"
+	"math"
+	"sort"
+	"strings"
+)
+
+type FillStrategy int
+
+const (
+	// horizontal or vertical strokes drawn back and forth
+	FillZigZag FillStrategy = iota
+	// contour-parallel strokes, each inset of the outline is drawn inside the previous one
+	FillConcentric
+	// the strokes at the angle drawn back and forth
+	FillHatch
+	// the strokes at the angle drawn in the same direction, the pen is lifted to return
+	FillUnidirectional
+)
+
+var fillStrategyNames = []string{"zigzag", "concentric", "hatch", "unidirectional"}
+
+func (fs FillStrategy) String() string {
+	if fs < 0 || int(fs) >= len(fillStrategyNames) {
+		return "unknown"
+	}
+	return fillStrategyNames[fs]
+}
+
+// returns the strategy by its name
+func ParseFillStrategy(name string) (FillStrategy, error) {
+	for i, s := range fillStrategyNames {
+		if strings.EqualFold(name, s) == true {
+			return FillStrategy(i), nil
+		}
+	}
+	return FillZigZag, errors.New("unknown fill strategy \"" + name + "\", expected one of: " +
+		strings.Join(fillStrategyNames, ", "))
+}
+
+/*
+The fill of a feature type.
+Angle is the direction of the hatch strokes in degrees, it is used by FillHatch and FillUnidirectional.
+Overlap is the part of the pen width which the adjacent strokes overlap by, 0 <= Overlap < 1.
+The zero value is the zig-zag fill without the overlap.
+*/
+type FillParams struct {
+	Strategy FillStrategy
+	Angle    float64
+	Overlap  float64
+}
+
+// reads the fill of the feature type from the configuration keys
+func readFillParams(v *viper.Viper, strategyKey, angleKey, overlapKey string) (FillParams, error) {
+	var retVal FillParams
+	var err error
+	retVal.Strategy, err = ParseFillStrategy(v.GetString(strategyKey))
+	if err != nil {
+		return retVal, errors.New(strategyKey + ": " + err.Error())
+	}
+	retVal.Angle = v.GetFloat64(angleKey)
+	retVal.Overlap = v.GetFloat64(overlapKey)
+	if retVal.Overlap < 0 || retVal.Overlap >= 1 {
+		return retVal, errors.New(overlapKey + " must be in the range [0, 1)")
+	}
+	return retVal, nil
+}
+
+// returns the fill of the feature being rendered, the flash fill is used outside of the steps
+func (rc *Render) fillParams() *FillParams {
+	if rc.fill == nil {
+		return &rc.FlashFill
+	}
+	return rc.fill
+}
+
+// returns the distance between the adjacent strokes in the plotter steps
+func (rc *Render) fillSpacing() int {
+	retVal := int(math.Round(float64(rc.PointSizeI) * (1 - rc.fillParams().Overlap)))
+	if retVal < 1 {
+		retVal = 1
+	}
+	return retVal
+}
+
+// fills the polygon (even-odd rule) by the strategy of the feature being rendered
+// the pen is kept inside the polygon entirely, so the areas outside the polygon are never inked
+func (rc *Render) FillPolygon(poly polyclip.Polygon, colr color.Color) {
+	fill := rc.fillParams()
+	switch fill.Strategy {
+	case FillConcentric:
+		rc.fillConcentric(poly, colr)
+	case FillHatch:
+		rc.fillHatch(poly, fill.Angle, false, colr)
+	case FillUnidirectional:
+		rc.fillHatch(poly, fill.Angle, true, colr)
+	default:
+		rc.fillHatch(poly, 0, false, colr)
+	}
+}
+
+// returns the polygon rotated around the origin
+func rotatePolygon(poly polyclip.Polygon, sin, cos float64) polyclip.Polygon {
+	retVal := make(polyclip.Polygon, len(poly))
+	for i, c := range poly {
+		retVal[i] = make(polyclip.Contour, len(c))
+		for k, p := range c {
+			retVal[i][k] = polyclip.Point{X: p.X*cos - p.Y*sin, Y: p.X*sin + p.Y*cos}
+		}
+	}
+	return retVal
+}
+
+// fills the polygon by the parallel strokes at the angle (degrees)
+// the strokes are drawn back and forth unless unidirectional is true
+func (rc *Render) fillHatch(poly polyclip.Polygon, angle float64, unidirectional bool, colr color.Color) {
+	// the unidirectional strokes are drawn in the direction of the angle
+	angle = math.Mod(angle, 360)
+	if angle < 0 {
+		angle += 360
+	}
+	// the polygon is turned so the strokes are horizontal, the strokes are turned back
+	sin, cos := math.Sincos(deg2Rad(angle))
+	if angle != 0 {
+		poly = rotatePolygon(poly, -sin, cos)
+	}
+	turnBack := func(x, y int) (int, int) {
+		if angle == 0 {
+			return x, y
+		}
+		fx, fy := float64(x), float64(y)
+		return int(math.Round(fx*cos - fy*sin)), int(math.Round(fx*sin + fy*cos))
+	}
+
+	edges := make([]edge, 0)
+	minY := math.Inf(1)
+	maxY := math.Inf(-1)
+	vertY := make([]float64, 0)
+	for _, c := range poly {
+		for i := range c {
+			p0 := c[i]
+			p1 := c[(i+1)%len(c)]
+			minY = math.Min(minY, p0.Y)
+			maxY = math.Max(maxY, p0.Y)
+			vertY = append(vertY, p0.Y)
+			if p0.Y == p1.Y {
+				continue
+			}
+			if p0.Y > p1.Y {
+				p0, p1 = p1, p0
+			}
+			edges = append(edges, edge{p0.X, p0.Y, p1.X, p1.Y})
+		}
+	}
+	if len(edges) == 0 {
+		return
+	}
+	sort.Slice(edges, func(i, j int) bool { return edges[i].y0 < edges[j].y0 })
+	sort.Float64s(vertY)
+
+	penR := rc.PointSize / 2
+	spacing := rc.fillSpacing()
+	if math.Mod(angle, 90) != 0 && spacing > 1 {
+		// the ends of the turned strokes are rounded to the plotter steps, the strokes are closer to hide the gaps
+		spacing--
+	}
+	nextEdge := 0
+	active := make([]edge, 0)
+	lostSpans := 0
+	leftToRight := true
+	for pixelY := int(math.Ceil(minY + penR)); float64(pixelY) <= maxY-penR; pixelY += spacing {
+		fPixelY := float64(pixelY)
+		bandMin := fPixelY - penR
+		bandMax := fPixelY + penR
+		// update the list of the edges crossing the band
+		for nextEdge < len(edges) && edges[nextEdge].y0 <= bandMax {
+			active = append(active, edges[nextEdge])
+			nextEdge++
+		}
+		k := 0
+		for _, e := range active {
+			if e.y1 >= bandMin {
+				active[k] = e
+				k++
+			}
+		}
+		active = active[:k]
+
+		// the pen covers the band, the stroke is allowed where every line of the band is inside
+		spans := scanSpans(active, fPixelY)
+		for y := bandMin; y <= bandMax && len(spans) > 0; y++ {
+			spans = intersectSpans(spans, scanSpans(active, y))
+		}
+		vi := sort.SearchFloat64s(vertY, bandMin)
+		for ; vi < len(vertY) && vertY[vi] <= bandMax && len(spans) > 0; vi++ {
+			spans = intersectSpans(spans, scanSpans(active, vertY[vi]))
+		}
+		if len(spans) > 0 {
+			spans = intersectSpans(spans, scanSpans(active, bandMax))
+		}
+
+		strokes := make([][2]int, 0, len(spans))
+		for _, s := range spans {
+			x0 := int(math.Ceil(s[0] + penR))
+			x1 := int(math.Floor(s[1] - penR))
+			if x0 > x1 {
+				lostSpans++
+				continue
+			}
+			strokes = append(strokes, [2]int{x0, x1})
+		}
+		// zig-zag to reduce pen moves
+		if leftToRight {
+			for _, s := range strokes {
+				x0, y0 := turnBack(s[0], pixelY)
+				x1, y1 := turnBack(s[1], pixelY)
+				rc.drawByBrezenham(x0, y0, x1, y1, rc.PointSizeI, colr)
+			}
+		} else {
+			for i := len(strokes) - 1; i >= 0; i-- {
+				x0, y0 := turnBack(strokes[i][1], pixelY)
+				x1, y1 := turnBack(strokes[i][0], pixelY)
+				rc.drawByBrezenham(x0, y0, x1, y1, rc.PointSizeI, colr)
+			}
+		}
+		if unidirectional == false {
+			leftToRight = !leftToRight
+		}
+	}
+	if lostSpans > 0 {
+		glog.Warningln(lostSpans, "fill strokes are narrower than the pen and were skipped")
+	}
+}
+
+/*
+Fills the polygon by its insets.
+The insets are the isolines of the distance to the outside of the polygon, polyclip is not reliable enough to offset the polygons.
+The nearest contour of the insets is drawn next, the pen goes to it without lifting if it is close enough.
+*/
+func (rc *Render) fillConcentric(poly polyclip.Polygon, colr color.Color) {
+	if len(poly) == 0 {
+		return
+	}
+	grid := newDistanceGrid(poly)
+	if grid == nil {
+		bb := poly.BoundingBox()
+		glog.Warningf("the polygon of %.0f x %.0f plotter steps is too large for the concentric fill (max. %d grid nodes), "+
+			"it is filled by zig-zag\n", bb.Max.X-bb.Min.X, bb.Max.Y-bb.Min.Y, maxGridNodes)
+		rc.fillHatch(poly, 0, false, colr)
+		return
+	}
+	// the neighbour insets overlap by a step to hide the rounding of the vertices
+	spacing := float64(rc.fillSpacing() - 1)
+	if spacing < 1 {
+		spacing = 1
+	}
+	maxJump := 1.5*spacing + 1
+	// the distance is measured to the nearest node outside, the outline is up to half a step closer
+	reach := rc.PointSize/2 + 0.5
+	penR := rc.PointSize / 2
+	covered := make([]bool, len(grid.d))
+	insets := make(polyclip.Polygon, 0)
+	boxes := make([]polyclip.Rectangle, 0)
+	for level := reach; ; level += spacing {
+		inset := grid.isolines(level)
+		if len(inset) == 0 {
+			break
+		}
+		for _, c := range inset {
+			insets = append(insets, c)
+			boxes = append(boxes, c.BoundingBox())
+		}
+	}
+	x, y := -1, -1
+	if len(insets) > 0 {
+		x, y = int(math.Round(insets[0][0].X)), int(math.Round(insets[0][0].Y))
+	}
+	drawn := make([]bool, len(insets))
+	for range insets {
+		// the nearest contour is drawn next, the contours farther than the nearest vertex found are skipped by their boxes
+		best, bestK := -1, 0
+		bestDist := math.Inf(1)
+		for c := range insets {
+			if drawn[c] == true {
+				continue
+			}
+			dx := math.Max(0, math.Max(boxes[c].Min.X-float64(x), float64(x)-boxes[c].Max.X))
+			dy := math.Max(0, math.Max(boxes[c].Min.Y-float64(y), float64(y)-boxes[c].Max.Y))
+			if math.Hypot(dx, dy) >= bestDist {
+				continue
+			}
+			for k := range insets[c] {
+				d := math.Hypot(insets[c][k].X-float64(x), insets[c][k].Y-float64(y))
+				if d < bestDist {
+					best, bestK, bestDist = c, k, d
+				}
+			}
+		}
+		drawn[best] = true
+		x, y = rc.drawClosedContour(x, y, insets[best], bestK, bestDist <= maxJump, colr)
+		for k := range insets[best] {
+			grid.cover(covered, insets[best][k], insets[best][(k+1)%len(insets[best])], penR)
+		}
+	}
+	// the ridges between the insets where the next inset does not reach are drawn by the strokes along the rows
+	ridges := make([][2]polyclip.Point, 0)
+	for j := 0; j < grid.h; j++ {
+		for i := 0; i < grid.w; i++ {
+			n := j*grid.w + i
+			if covered[n] == true || grid.d[n] < reach {
+				continue
+			}
+			k := i
+			for k+1 < grid.w && covered[n+k+1-i] == false && grid.d[n+k+1-i] >= reach {
+				k++
+			}
+			p0 := polyclip.Point{X: float64(grid.x0 + i), Y: float64(grid.y0 + j)}
+			p1 := polyclip.Point{X: float64(grid.x0 + k), Y: float64(grid.y0 + j)}
+			grid.cover(covered, p0, p1, penR)
+			ridges = append(ridges, [2]polyclip.Point{p0, p1})
+			i = k
+		}
+	}
+	if x < 0 && len(ridges) > 0 {
+		x, y = int(ridges[0][0].X), int(ridges[0][0].Y)
+	}
+	done := make([]bool, len(ridges))
+	for range ridges {
+		// the nearest end of the stroke is drawn first
+		best, bestEnd := -1, 0
+		bestDist := math.Inf(1)
+		for r := range ridges {
+			if done[r] == true {
+				continue
+			}
+			for e := 0; e < 2; e++ {
+				if d := math.Hypot(ridges[r][e].X-float64(x), ridges[r][e].Y-float64(y)); d < bestDist {
+					best, bestEnd, bestDist = r, e, d
+				}
+			}
+		}
+		done[best] = true
+		x0, y0 := int(ridges[best][bestEnd].X), int(ridges[best][bestEnd].Y)
+		x1, y1 := int(ridges[best][1-bestEnd].X), int(ridges[best][1-bestEnd].Y)
+		if x0 != x || y0 != y {
+			rc.MovePen(x, y, x0, y0, rc.MovePenColor)
+		}
+		rc.drawByBrezenham(x0, y0, x1, y1, rc.PointSizeI, colr)
+		x, y = x1, y1
+	}
+	if x < 0 {
+		glog.Warningln("the polygon is narrower than the pen and was skipped")
+	}
+}
+
+// the grid of the nodes larger than this is not allocated, it takes 9 bytes per node with the coverage flags,
+// 36 MB at most
+const maxGridNodes = 1 << 22
+
+// the distances from the grid nodes to the nearest node outside of the polygon, the nodes are the plotter steps
+type distanceGrid struct {
+	// the position of the node 0, 0
+	x0, y0 int
+	w, h   int
+	// h rows of w nodes
+	d []float64
+	// the max. distance of the row
+	rowMax []float64
+}
+
+// returns nil if the grid is too large
+func newDistanceGrid(poly polyclip.Polygon) *distanceGrid {
+	bb := poly.BoundingBox()
+	g := new(distanceGrid)
+	// the border nodes are outside, so the isolines are closed
+	g.x0 = int(math.Floor(bb.Min.X)) - 1
+	g.y0 = int(math.Floor(bb.Min.Y)) - 1
+	g.w = int(math.Ceil(bb.Max.X)) + 2 - g.x0
+	g.h = int(math.Ceil(bb.Max.Y)) + 2 - g.y0
+	if g.w*g.h > maxGridNodes {
+		return nil
+	}
+	edges := make([]edge, 0)
+	for _, c := range poly {
+		for i := range c {
+			p0 := c[i]
+			p1 := c[(i+1)%len(c)]
+			if p0.Y == p1.Y {
+				continue
+			}
+			if p0.Y > p1.Y {
+				p0, p1 = p1, p0
+			}
+			edges = append(edges, edge{p0.X, p0.Y, p1.X, p1.Y})
+		}
+	}
+	// the squared distance is 0 outside and "infinite" inside
+	inf := float64(g.w*g.w + g.h*g.h)
+	g.d = make([]float64, g.w*g.h)
+	for j := 0; j < g.h; j++ {
+		row := g.d[j*g.w : (j+1)*g.w]
+		for _, s := range scanSpans(edges, float64(g.y0+j)) {
+			for i := int(math.Ceil(s[0])) - g.x0; i < int(math.Ceil(s[1]))-g.x0; i++ {
+				row[i] = inf
+			}
+		}
+	}
+	// the squared distance transform by the columns, then by the rows
+	n := g.w
+	if g.h > n {
+		n = g.h
+	}
+	f := make([]float64, n)
+	dst := make([]float64, n)
+	v := make([]int, n)
+	z := make([]float64, n+1)
+	for i := 0; i < g.w; i++ {
+		for j := 0; j < g.h; j++ {
+			f[j] = g.d[j*g.w+i]
+		}
+		distance1D(f[:g.h], dst[:g.h], v, z)
+		for j := 0; j < g.h; j++ {
+			g.d[j*g.w+i] = dst[j]
+		}
+	}
+	g.rowMax = make([]float64, g.h)
+	for j := 0; j < g.h; j++ {
+		row := g.d[j*g.w : (j+1)*g.w]
+		copy(f, row)
+		distance1D(f[:g.w], row, v, z)
+		for i := range row {
+			row[i] = math.Sqrt(row[i])
+			g.rowMax[j] = math.Max(g.rowMax[j], row[i])
+		}
+	}
+	return g
+}
+
+// marks the nodes closer than r to the segment a, b
+func (g *distanceGrid) cover(covered []bool, a, b polyclip.Point, r float64) {
+	i0 := maxInt(int(math.Floor(math.Min(a.X, b.X)-r))-g.x0, 0)
+	i1 := minInt(int(math.Ceil(math.Max(a.X, b.X)+r))-g.x0, g.w-1)
+	j0 := maxInt(int(math.Floor(math.Min(a.Y, b.Y)-r))-g.y0, 0)
+	j1 := minInt(int(math.Ceil(math.Max(a.Y, b.Y)+r))-g.y0, g.h-1)
+	dx, dy := b.X-a.X, b.Y-a.Y
+	l2 := dx*dx + dy*dy
+	for j := j0; j <= j1; j++ {
+		for i := i0; i <= i1; i++ {
+			px, py := float64(g.x0+i), float64(g.y0+j)
+			t := 0.0
+			if l2 > 0 {
+				t = math.Max(0, math.Min(1, ((px-a.X)*dx+(py-a.Y)*dy)/l2))
+			}
+			if math.Hypot(a.X+t*dx-px, a.Y+t*dy-py) <= r {
+				covered[j*g.w+i] = true
+			}
+		}
+	}
+}
+
+// the squared distance transform of the sampled function f (P. Felzenszwalb, D. Huttenlocher)
+// v and z are the work arrays of len(f) and len(f)+1 elements
+func distance1D(f, d []float64, v []int, z []float64) {
+	k := 0
+	v[0] = 0
+	z[0] = math.Inf(-1)
+	z[1] = math.Inf(1)
+	for q := 1; q < len(f); q++ {
+		for {
+			p := v[k]
+			s := ((f[q] + float64(q*q)) - (f[p] + float64(p*p))) / float64(2*q-2*p)
+			if s <= z[k] {
+				k--
+				continue
+			}
+			k++
+			v[k] = q
+			z[k] = s
+			z[k+1] = math.Inf(1)
+			break
+		}
+	}
+	k = 0
+	for q := range f {
+		for z[k+1] < float64(q) {
+			k++
+		}
+		d[q] = float64((q-v[k])*(q-v[k])) + f[v[k]]
+	}
+}
+
+// returns the closed isolines of the distance (marching squares)
+func (g *distanceGrid) isolines(level float64) polyclip.Polygon {
+	inside := func(i, j int) bool {
+		return g.d[j*g.w+i] >= level
+	}
+	// the edge of the grid from the node i, j is 2*(j*w+i) to the right and 2*(j*w+i)+1 upwards
+	hEdge := func(i, j int) int { return 2 * (j*g.w + i) }
+	vEdge := func(i, j int) int { return 2*(j*g.w+i) + 1 }
+	links := make(map[int][]int)
+	link := func(a, b int) {
+		links[a] = append(links[a], b)
+		links[b] = append(links[b], a)
+	}
+	for j := 0; j+1 < g.h; j++ {
+		if g.rowMax[j] < level && g.rowMax[j+1] < level {
+			continue
+		}
+		for i := 0; i+1 < g.w; i++ {
+			// the corners and the edges of the cell counterclockwise from the bottom left one
+			corners := [4]bool{inside(i, j), inside(i+1, j), inside(i+1, j+1), inside(i, j+1)}
+			edges := [4]int{hEdge(i, j), vEdge(i+1, j), hEdge(i, j+1), vEdge(i, j)}
+			crossed := make([]int, 0, 4)
+			for k := 0; k < 4; k++ {
+				if corners[k] != corners[(k+1)%4] {
+					crossed = append(crossed, k)
+				}
+			}
+			switch len(crossed) {
+			case 2:
+				link(edges[crossed[0]], edges[crossed[1]])
+			case 4:
+				// the saddle, the corners of the state other than the center one are cut off
+				center := (g.d[j*g.w+i]+g.d[j*g.w+i+1]+g.d[(j+1)*g.w+i+1]+g.d[(j+1)*g.w+i])/4 >= level
+				for k := 0; k < 4; k++ {
+					if corners[k] != center {
+						link(edges[(k+3)%4], edges[k])
+					}
+				}
+			}
+		}
+	}
+	// the point where the isoline crosses the edge
+	crossing := func(e int) polyclip.Point {
+		n := e / 2
+		i0, j0 := n%g.w, n/g.w
+		i1, j1 := i0+1, j0
+		if e%2 == 1 {
+			i1, j1 = i0, j0+1
+		}
+		d0 := g.d[j0*g.w+i0] - level
+		d1 := g.d[j1*g.w+i1] - level
+		t := d0 / (d0 - d1)
+		return polyclip.Point{X: float64(g.x0+i0) + t*float64(i1-i0), Y: float64(g.y0+j0) + t*float64(j1-j0)}
+	}
+	// the contours are walked from the lowest edge to be the same each time
+	starts := make([]int, 0, len(links))
+	for e := range links {
+		starts = append(starts, e)
+	}
+	sort.Ints(starts)
+	retVal := make(polyclip.Polygon, 0)
+	visited := make(map[int]bool)
+	for _, start := range starts {
+		if visited[start] == true {
+			continue
+		}
+		c := make(polyclip.Contour, 0)
+		prev, e := -1, start
+		for visited[e] == false {
+			visited[e] = true
+			c = append(c, crossing(e))
+			next := links[e][0]
+			if next == prev || visited[next] == true {
+				next = links[e][1]
+			}
+			prev, e = e, next
+		}
+		if c = simplifyContour(c, 0.5); len(c) >= 3 {
+			retVal = append(retVal, c)
+		}
+	}
+	sort.Slice(retVal, func(a, b int) bool {
+		if retVal[a][0].Y != retVal[b][0].Y {
+			return retVal[a][0].Y < retVal[b][0].Y
+		}
+		return retVal[a][0].X < retVal[b][0].X
+	})
+	return retVal
+}
+
+// removes the vertices of the closed contour closer than tol to the simplified contour (Douglas-Peucker)
+func simplifyContour(c polyclip.Contour, tol float64) polyclip.Contour {
+	if len(c) < 4 {
+		return c
+	}
+	// the contour is split at the vertex farthest from the first one
+	far := 0
+	for k := range c {
+		if math.Hypot(c[k].X-c[0].X, c[k].Y-c[0].Y) > math.Hypot(c[far].X-c[0].X, c[far].Y-c[0].Y) {
+			far = k
+		}
+	}
+	closed := append(append(polyclip.Contour{}, c...), c[0])
+	retVal := simplifyPolyline(closed[:far+1], tol)
+	retVal = append(retVal[:len(retVal)-1], simplifyPolyline(closed[far:], tol)...)
+	return retVal[:len(retVal)-1]
+}
+
+// the ends of the polyline are kept
+func simplifyPolyline(p []polyclip.Point, tol float64) []polyclip.Point {
+	if len(p) < 3 {
+		return append([]polyclip.Point{}, p...)
+	}
+	a, b := p[0], p[len(p)-1]
+	l := math.Hypot(b.X-a.X, b.Y-a.Y)
+	far, farDist := 0, 0.0
+	for k := 1; k < len(p)-1; k++ {
+		var d float64
+		if l == 0 {
+			d = math.Hypot(p[k].X-a.X, p[k].Y-a.Y)
+		} else {
+			d = math.Abs((b.X-a.X)*(a.Y-p[k].Y)-(a.X-p[k].X)*(b.Y-a.Y)) / l
+		}
+		if d > farDist {
+			far, farDist = k, d
+		}
+	}
+	if farDist <= tol {
+		return []polyclip.Point{a, b}
+	}
+	retVal := simplifyPolyline(p[:far+1], tol)
+	return append(retVal[:len(retVal)-1], simplifyPolyline(p[far:], tol)...)
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,148 @@
+package render
+
+import (
+	"bytes"
+	"emsim"
+	"github.com/akavel/polyclip-go"
+	"image"
+	"math"
+	"plotter"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestParseFillStrategy(t *testing.T) {
+	for _, fs := range []FillStrategy{FillZigZag, FillConcentric, FillHatch, FillUnidirectional} {
+		if parsed, err := ParseFillStrategy(strings.ToUpper(fs.String())); err != nil || parsed != fs {
+			t.Error("the strategy", fs, "is parsed as", parsed, err)
+		}
+	}
+	if _, err := ParseFillStrategy("spiral"); err == nil {
+		t.Error("the unknown strategy is accepted")
+	}
+}
+
+// returns the distance from the point to the outline of the polygon, negative outside of the polygon
+func signedDistance(poly polyclip.Polygon, x, y float64) float64 {
+	d := math.Inf(1)
+	inside := false
+	for _, c := range poly {
+		for i := range c {
+			p0 := c[i]
+			p1 := c[(i+1)%len(c)]
+			dx, dy := p1.X-p0.X, p1.Y-p0.Y
+			k := ((x-p0.X)*dx + (y-p0.Y)*dy) / (dx*dx + dy*dy)
+			k = math.Max(0, math.Min(1, k))
+			d = math.Min(d, math.Hypot(p0.X+k*dx-x, p0.Y+k*dy-y))
+			if (p0.Y > y) != (p1.Y > y) && x < p0.X+(y-p0.Y)/dy*dx {
+				inside = !inside
+			}
+		}
+	}
+	if inside == false {
+		return -d
+	}
+	return d
+}
+
+func TestFillStrategies(t *testing.T) {
+	// the frame with the hole
+	poly := polyclip.Polygon{
+		{{X: 20, Y: 20}, {X: 180, Y: 20}, {X: 180, Y: 120}, {X: 100, Y: 180}, {X: 20, Y: 180}},
+		{{X: 60, Y: 60}, {X: 60, Y: 100}, {X: 120, Y: 100}, {X: 120, Y: 60}},
+	}
+	strokes := make(map[FillStrategy]int)
+	for _, fill := range []FillParams{
+		{Strategy: FillZigZag},
+		{Strategy: FillConcentric},
+		{Strategy: FillHatch, Angle: 30},
+		{Strategy: FillUnidirectional, Angle: -45},
+		{Strategy: FillZigZag, Overlap: 0.5},
+	} {
+		out := new(bytes.Buffer)
+		rc := new(Render)
+		rc.PointSize = 6.0
+		rc.PointSizeI = 6
+		rc.Plt = plotter.NewPlotter(out)
+		rc.Img = image.NewNRGBA(image.Rect(0, 0, 200, 200))
+		rc.RegionFill = fill
+		rc.fill = &rc.RegionFill
+		rc.Plt.Start()
+		rc.Plt.TakePen(1)
+		rc.FillPolygon(poly, rc.RegionColor)
+		rc.Plt.Stop()
+
+		name := fill.Strategy.String()
+		sim := emsim.NewSimulator(200, 200, []int{6})
+		if err := sim.Run(bytes.NewReader(out.Bytes())); err != nil {
+			t.Fatal(name, err)
+		}
+		img := sim.Image()
+		height := img.Bounds().Dy()
+		for x := 0; x < img.Bounds().Dx(); x++ {
+			for y := 0; y < height; y++ {
+				inked := img.NRGBAAt(x, height-1-y).R == 0
+				d := signedDistance(poly, float64(x), float64(y))
+				// the strokes are kept off the edges by the pen radius at least, the round ends of the strokes
+				// at the edges not perpendicular to them leave the gaps up to the pen width more
+				if d > 1.5*rc.PointSize && inked == false {
+					t.Fatal(name, ": the polygon is not filled at", x, y)
+				}
+				if d < -1.5 && inked == true {
+					t.Fatal(name, ": the pen is out of the polygon at", x, y)
+				}
+			}
+		}
+		if fill.Overlap == 0 {
+			strokes[fill.Strategy] = sim.Stat.Lines
+		} else if sim.Stat.Lines <= strokes[FillZigZag]*3/2 {
+			t.Error("the overlapped strokes are not added", sim.Stat.Lines, strokes[FillZigZag])
+		}
+
+		// the hatch strokes go at the angle, the unidirectional ones are drawn in the same direction
+		if fill.Strategy == FillHatch || fill.Strategy == FillUnidirectional {
+			sin, cos := math.Sincos(deg2Rad(fill.Angle))
+			backwards := 0
+			x, y := 0.0, 0.0
+			for _, cmd := range strings.Split(out.String(), "\n") {
+				if strings.HasPrefix(cmd, "MA ") == false && strings.HasPrefix(cmd, "DA ") == false {
+					continue
+				}
+				xy := strings.Split(cmd[3:], " , ")
+				x1, _ := strconv.ParseFloat(xy[0], 64)
+				y1, _ := strconv.ParseFloat(xy[1], 64)
+				if cmd[0] == 'D' {
+					l := math.Hypot(x1-x, y1-y)
+					along := (x1-x)*cos + (y1-y)*sin
+					if l > 10 && math.Abs(along) < l*0.99 {
+						t.Fatal(name, ": the stroke is not at the angle", x, y, x1, y1)
+					}
+					if along < 0 {
+						backwards++
+					}
+				}
+				x, y = x1, y1
+			}
+			if fill.Strategy == FillHatch && backwards == 0 {
+				t.Error("the hatch is not drawn back and forth")
+			}
+			if fill.Strategy == FillUnidirectional && backwards != 0 {
+				t.Error(backwards, "unidirectional strokes are drawn backwards")
+			}
+		}
+	}
+}
+
+func TestDistanceGridLimit(t *testing.T) {
+	square := func(size float64) polyclip.Polygon {
+		return polyclip.Polygon{{{X: 0, Y: 0}, {X: size, Y: 0}, {X: size, Y: size}, {X: 0, Y: size}}}
+	}
+	if newDistanceGrid(square(200)) == nil {
+		t.Error("the grid of the small polygon is not allocated")
+	}
+	// the larger polygons are filled by zig-zag
+	if newDistanceGrid(square(2100)) != nil {
+		t.Error("the grid of", 2103*2103, "nodes is allocated")
+	}
+}
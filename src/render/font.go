@@ -0,0 +1,124 @@
+/*
+################################## Font #######################################
+The single stroke font (Hershey style) drawn by the pen as the lines.
+The glyph is a set of the polylines on the grid glyphWidth x glyphHeight, the origin
+is the lower left corner of the capital letter. A polyline is the string of the points,
+each point is two digits: x and y. The lower case letters are drawn as the capitals,
+the characters without the glyph are drawn as '?'.
+*/
+package render
+
+import (
+	"math"
+	"strings"
+	"unicode"
+)
+
+const (
+	glyphWidth  = 4
+	glyphHeight = 6
+	// the glyph width and the space between the glyphs
+	glyphAdvance = glyphWidth + 2
+)
+
+var glyphs = map[rune]string{
+	' ':  "",
+	'0':  "103041453616050110 0145",
+	'1':  "152620 1030",
+	'2':  "05163645440040",
+	'3':  "05163645443313 334241301001",
+	'4':  "30360242",
+	'5':  "460603344341301001",
+	'6':  "3616050110304142331302",
+	'7':  "064610",
+	'8':  "13040516364544331302011030414233",
+	'9':  "4233130405163645413010",
+	'A':  "0004264440 0343",
+	'B':  "00063645443303 3342413000",
+	'C':  "4536160501103041",
+	'D':  "00062644422000",
+	'E':  "40000646 0333",
+	'F':  "000646 0333",
+	'G':  "45361605011030414323",
+	'H':  "0006 4046 0343",
+	'I':  "1030 2026 1636",
+	'J':  "4641301001",
+	'K':  "0006 4602 1340",
+	'L':  "060040",
+	'M':  "0006234640",
+	'N':  "00064046",
+	'O':  "103041453616050110",
+	'P':  "00063645443303",
+	'Q':  "103041453616050110 2240",
+	'R':  "00063645443303 2340",
+	'S':  "453616050413334241301001",
+	'T':  "0646 2620",
+	'U':  "060110304146",
+	'V':  "062046",
+	'W':  "0610233046",
+	'X':  "0046 0640",
+	'Y':  "062346 2320",
+	'Z':  "06460040",
+	'.':  "2021",
+	',':  "2110",
+	':':  "2021 2425",
+	'-':  "1333",
+	'_':  "0040",
+	'/':  "0046",
+	'(':  "36252130",
+	')':  "16252110",
+	'=':  "0242 0444",
+	'+':  "0343 2125",
+	'\'': "2624",
+	'?':  "0516364544332322 2020",
+}
+
+// returns the polylines of the glyph of the character, the grid units
+func glyphStrokes(c rune) [][][2]int {
+	g, ok := glyphs[unicode.ToUpper(c)]
+	if ok == false {
+		g = glyphs['?']
+	}
+	retVal := make([][][2]int, 0)
+	for _, s := range strings.Fields(g) {
+		stroke := make([][2]int, 0, len(s)/2)
+		for i := 0; i+1 < len(s); i += 2 {
+			stroke = append(stroke, [2]int{int(s[i] - '0'), int(s[i+1] - '0')})
+		}
+		retVal = append(retVal, stroke)
+	}
+	return retVal
+}
+
+// returns the width (mm) of the text of the capitals height (mm)
+func textWidth(text string, height float64) float64 {
+	n := len([]rune(text))
+	if n == 0 {
+		return 0
+	}
+	u := height / glyphHeight
+	return float64(n*glyphAdvance-(glyphAdvance-glyphWidth)) * u
+}
+
+// draws the text from the lower left corner (x, y), plotter steps, the capitals are height (mm) high
+func (rc *Render) DrawText(x, y int, text string, height float64) {
+	u := height / glyphHeight
+	for i, c := range []rune(text) {
+		left := float64(i*glyphAdvance) * u
+		for _, stroke := range glyphStrokes(c) {
+			px, py := 0, 0
+			for j, p := range stroke {
+				nx := x + int(math.Round((left+float64(p[0])*u)/rc.XRes))
+				ny := y + int(math.Round(float64(p[1])*u/rc.YRes))
+				// the single point stroke is the dot
+				if j > 0 || len(stroke) == 1 {
+					if j == 0 {
+						px, py = nx, ny
+					}
+					rc.drawByBrezenham(px, py, nx, ny, rc.PointSizeI, rc.MarkColor)
+				}
+				px, py = nx, ny
+			}
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package render
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"plotter"
+	"strings"
+	"testing"
+)
+
+func TestGlyphs(t *testing.T) {
+	for c, g := range glyphs {
+		for _, s := range strings.Fields(g) {
+			if len(s)%2 != 0 {
+				t.Errorf("the glyph %q has the odd stroke %q", c, s)
+			}
+		}
+		for _, stroke := range glyphStrokes(c) {
+			for _, p := range stroke {
+				if p[0] < 0 || p[0] > glyphWidth || p[1] < 0 || p[1] > glyphHeight {
+					t.Errorf("the glyph %q is out of the grid at %v", c, p)
+				}
+			}
+		}
+	}
+	// the lower case letters are the capitals, the unknown characters are '?'
+	if len(glyphStrokes('a')) != len(glyphStrokes('A')) || len(glyphStrokes('@')) != len(glyphStrokes('?')) {
+		t.Error("bad glyph substitution")
+	}
+	if w := textWidth("AB", 6); w != 10 {
+		t.Error("expected the width 10, got", w)
+	}
+	if w := textWidth("", 6); w != 0 {
+		t.Error("expected the width 0, got", w)
+	}
+}
+
+func TestDrawText(t *testing.T) {
+	out := new(bytes.Buffer)
+	rc := new(Render)
+	rc.XRes = 0.1
+	rc.YRes = 0.1
+	rc.PointSizeI = 1
+	rc.Plt = plotter.NewPlotter(out)
+	rc.Img = image.NewNRGBA(image.Rect(0, 0, 200, 100))
+	rc.MarkColor = color.RGBA{0, 0, 0, 255}
+	// "L" is one polyline of two lines, "T" is two lines, the space is nothing
+	rc.Plt.Start()
+	rc.DrawText(10, 20, "L T", 6)
+	rc.Plt.Stop()
+	if rc.LineBresCounter != 4 {
+		t.Fatal("expected 4 lines, got", rc.LineBresCounter)
+	}
+	// the corner of "L" and the top of the stem of "T" (the third glyph starts at 12 mm)
+	for _, p := range [][2]int{{10, 20}, {10, 80}, {150, 80}} {
+		if rc.Img.NRGBAAt(p[0], p[1]).A == 0 {
+			t.Error("the text is not drawn at", p)
+		}
+	}
+	if strings.Count(out.String(), "DA") != 4 {
+		t.Error("expected 4 plotter lines, got", out.String())
+	}
+}
@@ -4,29 +4,26 @@
 package render
 
 import (
+	"attributes"
 	"container/list"
-	"errors"
 	"fmt"
 	. "gerberbasetypes"
 	glog "glog_t"
 	"image/color"
+	"math"
 	"regions"
 	"srblocks"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	. "xy"
 )
 
-var stateIdSeed int
-
-func init() {
-	stateIdSeed = 0
-}
+// the steps are numbered across all the conversions, the counter is shared by the goroutines
+var stateIdSeed int64
 
 func getNewId() int {
-	retVal := stateIdSeed
-	stateIdSeed += 1
-	return retVal
+	return int(atomic.AddInt64(&stateIdSeed, 1) - 1)
 }
 
 /*
@@ -43,6 +40,73 @@ type ApTransParameters struct {
 	Scale     float64
 }
 
+// returns true if the parameters do not change the aperture
+func (atp *ApTransParameters) IsIdentity() bool {
+	return (atp.Mirroring == NoMirror || atp.Mirroring == 0) &&
+		math.Mod(atp.Rotation, 360.0) == 0 &&
+		atp.Scale == 1.0
+}
+
+// transforms the point given relative to the aperture origin: mirroring, then rotation, then scaling
+func (atp *ApTransParameters) Apply(x, y float64) (float64, float64) {
+	mx, my := mirrorFlags(atp.Mirroring)
+	if mx {
+		x = -x
+	}
+	if my {
+		y = -y
+	}
+	x, y, _ = RotatePoint(x, y, atp.Rotation)
+	return x * atp.Scale, y * atp.Scale
+}
+
+// returns the parameters equal to applying inner first and then atp
+func (atp *ApTransParameters) Compose(inner *ApTransParameters) ApTransParameters {
+	retVal := *inner
+	mx, my := mirrorFlags(atp.Mirroring)
+	imx, imy := mirrorFlags(inner.Mirroring)
+	retVal.Mirroring = mirrorFromFlags(mx != imx, my != imy)
+	if mx != my {
+		// the mirroring by one axis changes the direction of the rotation
+		retVal.Rotation = atp.Rotation - inner.Rotation
+	} else {
+		retVal.Rotation = atp.Rotation + inner.Rotation
+	}
+	retVal.Scale = atp.Scale * inner.Scale
+	if atp.Polarity == PolTypeClear {
+		// the clear flash toggles the polarity of the objects
+		if inner.Polarity == PolTypeClear {
+			retVal.Polarity = PolTypeDark
+		} else {
+			retVal.Polarity = PolTypeClear
+		}
+	}
+	return retVal
+}
+
+// returns true if the mirroring changes the direction of the arcs
+func (atp *ApTransParameters) FlipsArcs() bool {
+	mx, my := mirrorFlags(atp.Mirroring)
+	return mx != my
+}
+
+func mirrorFlags(m Mirror) (mx, my bool) {
+	return m == MirrorX || m == MirrorXY, m == MirrorY || m == MirrorXY
+}
+
+func mirrorFromFlags(mx, my bool) Mirror {
+	switch {
+	case mx && my:
+		return MirrorXY
+	case mx:
+		return MirrorX
+	case my:
+		return MirrorY
+	default:
+	}
+	return NoMirror
+}
+
 func (atp *ApTransParameters) String() string {
 	return atp.Polarity.String() + "; " +
 		atp.Mirroring.String() +
@@ -65,6 +129,9 @@ type State struct {
 	OriginForAB   *XY // origin for aperture block insertion
 	ApTransParams ApTransParameters
 	StateId       int
+	ObjAttributes *attributes.Dictionary // object attributes attached to the object created by the step
+	Notation      Notation               // absolute or incremental coordinates
+	Source        SourceRef              // the command which completed the step and its line in the source
 }
 
 // diagnostic print
@@ -72,6 +139,7 @@ func (step *State) Print() {
 	fmt.Println("Step#", step.StepNumber)
 	fmt.Println("\t" + step.QMode.String())
 	fmt.Println("\t" + step.IpMode.String())
+	fmt.Println("\t" + step.Notation.String())
 	if step.CurrentAp != nil {
 		fmt.Println("\tAperture", step.CurrentAp.Code)
 	} else {
@@ -99,6 +167,7 @@ func (step *State) Print() {
 		fmt.Println("\t<nil>")
 	}
 	fmt.Println(step.ApTransParams.String())
+	fmt.Println("\tObject attributes:", step.ObjAttributes.String())
 }
 
 // creates and initializes step object with default values
@@ -107,6 +176,7 @@ func NewState() *State {
 	state.Coord = NewXY()
 	//	state.Polarity = PolTypeDark
 	state.IpMode = IPModeLinear
+	state.Notation = AbsoluteNotation
 	state.ApTransParams = ApTransParameters{Polarity: PolTypeDark,
 		Mirroring: NoMirror,
 		Rotation:  0.0,
@@ -121,6 +191,7 @@ func (step *State) CopyOfWithOffset(another *State, addX float64, addY float64)
 	step.SRBlock = another.SRBlock
 	step.IpMode = another.IpMode
 	step.QMode = another.QMode
+	step.Notation = another.Notation
 	step.CurrentAp = another.CurrentAp
 	//	step.Polarity = another.Polarity
 	step.StepNumber = another.StepNumber
@@ -133,6 +204,38 @@ func (step *State) CopyOfWithOffset(another *State, addX float64, addY float64)
 	step.ApTransParams.Scale = another.ApTransParams.Scale
 	step.ApTransParams.Rotation = another.ApTransParams.Rotation
 	step.ApTransParams.Mirroring = another.ApTransParams.Mirroring
+	step.ObjAttributes = another.ObjAttributes
+	step.Source = another.Source
+}
+
+// copies the step of an aperture block flashed with the transformation parameters atp at addX, addY
+func (step *State) CopyOfWithTransform(another *State, atp *ApTransParameters, addX float64, addY float64) {
+	step.CopyOfWithOffset(another, 0, 0)
+	if another.QMode == QuadModeSingle && another.PrevCoord != nil &&
+		another.Action == OpcodeD01_DRAW && another.IpMode != IPModeLinear {
+		// the signs of I and J may be lost after the transformation
+		i, j := singleQuadrantOffsets(another.PrevCoord.GetX(), another.PrevCoord.GetY(),
+			another.Coord.GetX(), another.Coord.GetY(), another.Coord.GetI(), another.Coord.GetJ(), another.IpMode)
+		step.Coord.SetI(i)
+		step.Coord.SetJ(j)
+		step.QMode = QuadModeMulti
+	}
+	x, y := atp.Apply(step.Coord.GetX(), step.Coord.GetY())
+	step.Coord.SetX(x + addX)
+	step.Coord.SetY(y + addY)
+	i, j := atp.Apply(step.Coord.GetI(), step.Coord.GetJ())
+	step.Coord.SetI(i)
+	step.Coord.SetJ(j)
+	if atp.FlipsArcs() {
+		switch step.IpMode {
+		case IPModeCwC:
+			step.IpMode = IPModeCCwC
+		case IPModeCCwC:
+			step.IpMode = IPModeCwC
+		default:
+		}
+	}
+	step.ApTransParams = atp.Compose(&another.ApTransParams)
 }
 
 type GerberStringProcessingResult int
@@ -150,21 +253,21 @@ func (step *State) CreateStep(
 	apertList *list.List,
 	regionsList *list.List,
 	i int,
-	fSpec *FormatSpec) GerberStringProcessingResult {
+	fSpec *FormatSpec) (GerberStringProcessingResult, error) {
 
 	// sequentally fill all the fields
 	// after opcode string finalize the step
 	if strings.Compare(*inString, "G01*") == 0 || strings.Compare(*inString, "G1*") == 0 { // +09-Jun-2018
 		step.IpMode = IPModeLinear
-		return SCResultNextString
+		return SCResultNextString, nil
 	}
 	if strings.Compare(*inString, "G02*") == 0 || strings.Compare(*inString, "G2*") == 0 { // +09-Jun-2018
 		step.IpMode = IPModeCwC
-		return SCResultNextString
+		return SCResultNextString, nil
 	}
 	if strings.Compare(*inString, "G03*") == 0 || strings.Compare(*inString, "G3*") == 0 { // +09-Jun-2018
 		step.IpMode = IPModeCCwC
-		return SCResultNextString
+		return SCResultNextString, nil
 	}
 	//if strings.Compare(*inString, "%LPC*%") == 0 {
 	//	step.Polarity = PolTypeClear
@@ -178,71 +281,98 @@ func (step *State) CreateStep(
 	// + 01-Oct-2018
 	if strings.Compare(*inString, "%LPC*%") == 0 {
 		step.ApTransParams.Polarity = PolTypeClear
-		return SCResultNextString
+		return SCResultNextString, nil
 	}
 	if strings.Compare(*inString, "%LPD*%") == 0 {
 		step.ApTransParams.Polarity = PolTypeDark
-		return SCResultNextString
+		return SCResultNextString, nil
 	}
 
 	if strings.Compare(*inString, "%LMN*%") == 0 {
 		step.ApTransParams.Mirroring = NoMirror
-		return SCResultNextString
+		return SCResultNextString, nil
 	}
 
 	if strings.Compare(*inString, "%LMX*%") == 0 {
 		step.ApTransParams.Mirroring = MirrorX
-		return SCResultNextString
+		return SCResultNextString, nil
 	}
 
 	if strings.Compare(*inString, "%LMY*%") == 0 {
 		step.ApTransParams.Mirroring = MirrorY
-		return SCResultNextString
+		return SCResultNextString, nil
 	}
 
 	if strings.Compare(*inString, "%LMXY*%") == 0 {
 		step.ApTransParams.Mirroring = MirrorXY
-		return SCResultNextString
+		return SCResultNextString, nil
 	}
 
 	if strings.HasPrefix(*inString, "%LR") == true {
 		end := strings.Index(*inString, "*")
 		val, err := strconv.ParseFloat((*inString)[3:end], 64)
 		if err != nil {
-			glog.Fatalln(*inString + "unrecoginzed!")
+			return 0, NewParseError("bad rotation angle")
 		}
 		step.ApTransParams.Rotation = val
-		return SCResultNextString
+		return SCResultNextString, nil
 	}
 
 	if strings.HasPrefix(*inString, "%LS") == true {
 		end := strings.Index(*inString, "*")
 		val, err := strconv.ParseFloat((*inString)[3:end], 64)
 		if err != nil {
-			glog.Fatalln(*inString + "unrecoginzed!")
+			return 0, NewParseError("bad scale factor")
 		}
 		step.ApTransParams.Scale = val
-		return SCResultNextString
+		return SCResultNextString, nil
+	}
+
+	// object attributes are attached to all the objects created after %TO until they are deleted by %TD
+	if strings.HasPrefix(*inString, "%TO") || strings.HasPrefix(*inString, "%TD") {
+		attr, err := attributes.Parse(*inString)
+		if err != nil {
+			return 0, NewParseError(err.Error())
+		}
+		if attr.Kind == attributes.KindObject {
+			step.ObjAttributes = step.ObjAttributes.Set(attr)
+		} else {
+			step.ObjAttributes = step.ObjAttributes.Delete(attr.Name)
+		}
+		return SCResultNextString, nil
+	}
+
+	if strings.Compare(*inString, "G90*") == 0 {
+		step.Notation = AbsoluteNotation
+		return SCResultNextString, nil
+	}
+	if strings.Compare(*inString, "G91*") == 0 {
+		step.Notation = IncrementalNotation
+		return SCResultNextString, nil
 	}
 
 	if strings.Compare(*inString, "G74*") == 0 {
 		step.QMode = QuadModeSingle
-		return SCResultNextString
+		return SCResultNextString, nil
 	}
 	if strings.Compare(*inString, "G75*") == 0 {
 		step.QMode = QuadModeMulti
-		return SCResultNextString
+		return SCResultNextString, nil
 	}
 	if strings.Compare("G37*", *inString) == 0 {
 		// G37 command is found
 		regionOpenedState, err := step.Region.IsRegionOpened()
-		checkError(err)
+		if err != nil {
+			return 0, NewParseError(err.Error())
+		}
 		if regionOpenedState == true { // creg is opened
 			err = step.Region.Close(i)
-			checkError(err)
+			if err != nil {
+				return 0, NewParseError(err.Error())
+			}
 			step.Region = nil
 		}
-		return SCResultNextString
+		return SCResultNextString, nil
 	}
 	//
 	if strings.Compare("G36*", *inString) == 0 {
@@ -250,7 +380,7 @@ func (step *State) CreateStep(
 		regionsList.PushBack(creg)
 		step.Region = creg
 		// add coordinates as usual, close creg at G37 command
-		return SCResultNextString
+		return SCResultNextString, nil
 	}
 	switch {
 	case strings.HasSuffix(*inString, "D01*"):
@@ -280,7 +410,10 @@ func (step *State) CreateStep(
 		xy := new(XY)
 		abxy := new(XY)
 		s := *inString
-		if xy.Init(s[:len(s)-3], fSpec, prevStep.Coord) != false { // coordinates are recognized successfully
+		// G90/G91 may override the notation from the format specification
+		fs := *fSpec
+		fs.Notation = step.Notation
+		if xy.Init(s[:len(s)-3], &fs, prevStep.Coord) != false { // coordinates are recognized successfully
 			step.Coord = xy
 			step.OriginForAB = abxy
 			// check if the xy belongs to a region
@@ -297,12 +430,12 @@ func (step *State) CreateStep(
 				}
 			}
 		} else {
-			glog.Fatalln("Error parsing string", i, *inString)
+			return 0, NewParseError("bad coordinates")
 		}
 		if step.SRBlock != nil {
 			step.SRBlock.IncNSteps()
 		}
-		return SCResultStepCompleted
+		return SCResultStepCompleted, nil
 	}
 
 	// switch aperture
@@ -311,7 +444,9 @@ func (step *State) CreateStep(
 		var tc int
 		step.CurrentAp = nil
 		tc, err := strconv.Atoi(s[1 : len(s)-1])
-		checkError(err)
+		if err != nil {
+			return 0, NewParseError("bad aperture code")
+		}
 		for k := apertList.Front(); k != nil; k = k.Next() {
 			if k.Value.(*Aperture).GetCode() == tc {
 				step.CurrentAp = k.Value.(*Aperture)
@@ -319,16 +454,16 @@ func (step *State) CreateStep(
 			}
 		}
 		if step.CurrentAp == nil {
-			checkError(errors.New("the aperture " + strconv.Itoa(tc) + " does not exist"))
+			return 0, NewParseError("the aperture " + strconv.Itoa(tc) + " does not exist")
 		}
-		return SCResultNextString
+		return SCResultNextString, nil
 	}
 
 	// + 28-09-2018
 	if strings.HasPrefix(s, "%SRX1Y1I0") {
 		glog.Infoln(step.SRBlock.String()+"ends at line", i)
 		step.SRBlock = nil
-		return SCResultNextString
+		return SCResultNextString, nil
 	}
 
 	if strings.HasPrefix(*inString, "%SRX") {
@@ -336,33 +471,37 @@ func (step *State) CreateStep(
 		step.SRBlock = new(srblocks.SRBlock)
 		s := *inString
 		srerr := step.SRBlock.Init(s[3:len(s)-2], fSpec)
-		checkError(srerr)
+		if srerr != nil {
+			return 0, NewParseError(srerr.Error())
+		}
 		//		SRBlocks = append(SRBlocks, srblock)
 		//		srb = srblock
-		return SCResultNextString
+		return SCResultNextString, nil
 	}
 
 	if strings.HasPrefix(s, "%SR*%") {
 		glog.Infoln("\n"+step.SRBlock.String()+"ends at line", i)
 		step.SRBlock = nil
-		return SCResultNextString
+		return SCResultNextString, nil
 	}
 
 	if strings.Compare(s, "M02*") == 0 || strings.Compare(s, "M00*") == 0 {
 		glog.Infoln("Stop found at line", i)
 		step.Action = OpcodeStop
 		step.SRBlock = nil // also closes s&r block
-		return SCResultStop
+		return SCResultStop, nil
 	}
 
 	glog.Warningln("skipped: " + *inString)
-	return SCResultSkipString
+	return SCResultSkipString, nil
 }
 
-func checkError(err error) {
-	if err != nil {
-		glog.Fatalln(err)
+// attributes the error to the source if the error does not know its place yet
+func sourceError(err error, src *SourceRef) error {
+	if loc, ok := err.(Locator); ok == true {
+		loc.Locate(src.Line, src.Command)
 	}
+	return err
 }
 
 // the function creates a full step sequence using src *[]string as source
@@ -371,18 +510,22 @@ func checkError(err error) {
 // aperturesList *list.List - pointer to the global aperture list
 // regionsList *list.List - pointer to the global regions list
 // fSpec *gerbparser.FormatSpec - pointer to the format specif. object
+// lines []int - source line numbers of the strings, may be nil
 // NumberOfSteps - number of the created steps started from 1
+// err - the first error found, the error carries the source line and the offending string
 
 func CreateStepSequence(src *[]string,
+	lines []int,
 	resSteps *[]*State,
 	apertl *list.List,
 	regl *list.List,
-	fSpec *FormatSpec) (NumberOfSteps int) {
+	fSpec *FormatSpec) (NumberOfSteps int, err error) {
 
 	stepNumber := 1 // step number
 	stepCompleted := true
 	// create the root step with default properties
 	(*resSteps)[0] = NewState()
+	(*resSteps)[0].Notation = fSpec.ReadNotation()
 	// process string by string
 	var step *State
 	for i, s := range *src {
@@ -394,7 +537,17 @@ func CreateStepSequence(src *[]string,
 			step.Coord = nil
 			step.PrevCoord = nil
 		}
-		createStepResult := step.CreateStep(&s, (*resSteps)[stepNumber-1], apertl, regl, i, fSpec)
+		line := 0
+		if i < len(lines) {
+			line = lines[i]
+		}
+		createStepResult, err := step.CreateStep(&s, (*resSteps)[stepNumber-1], apertl, regl, i, fSpec)
+		if err != nil {
+			if loc, ok := err.(Locator); ok == true {
+				loc.Locate(line, s)
+			}
+			return stepNumber, err
+		}
 		switch createStepResult {
 		case SCResultNextString:
 			fallthrough
@@ -404,12 +557,14 @@ func CreateStepSequence(src *[]string,
 		case SCResultStepCompleted:
 			step.PrevCoord = (*resSteps)[stepNumber-1].Coord
 			step.StepNumber = stepNumber
+			step.Source = SourceRef{Line: line, Command: s}
 			(*resSteps)[stepNumber] = step
 			stepNumber++
 			stepCompleted = true
 			continue
 		case SCResultStop:
 			step.StepNumber = stepNumber
+			step.Source = SourceRef{Line: line, Command: s}
 			(*resSteps)[stepNumber] = step
 			step.Coord = (*resSteps)[stepNumber-1].Coord
 			stepNumber++
@@ -420,7 +575,7 @@ func CreateStepSequence(src *[]string,
 		}
 		//		glog.Warningln("Still unknown command: ", s)
 	} // end of input strings parsing
-	return stepNumber
+	return stepNumber, nil
 }
 
 func UnwindSRBlock(steps *[]*State, k int) (*[]*State, int) {
@@ -452,20 +607,31 @@ func UnwindSRBlock(steps *[]*State, k int) (*[]*State, int) {
 	return &SRBlockSteps, kStop
 }
 
-func (step *State) Render(rc *Render) {
+// renders the step, the error carries the source of the step
+func (step *State) Render(rc *Render) error {
+	if err := step.render(rc); err != nil {
+		return sourceError(err, &step.Source)
+	}
+	return nil
+}
+
+func (step *State) render(rc *Render) error {
+	defer func() { rc.fill = nil }()
 
 	// polygons are not affected by aperture transformation parameters
 	if step.Region != nil {
+		rc.fill = &rc.RegionFill
 		// process region
 		if rc.PolygonPtr == nil {
 			rc.PolygonPtr = NewPolygon(step.Region.G36StringNumber)
 		}
 		if rc.AddStepToPolygon(step) == step.Region.GetNumXY() {
 			// we can process region
-			rc.RenderPolygon()
+			err := rc.RenderPolygon()
 			rc.PolygonPtr = nil
+			return err
 		}
-		return
+		return nil
 	}
 
 	var Xp int
@@ -482,11 +648,17 @@ func (step *State) Render(rc *Render) {
 
 	if step.Action == OpcodeD02_MOVE {
 		rc.MovePen(Xp, Yp, Xc, Yc, rc.MovePenColor)
-		return
+		return nil
 	}
 
 	if rc.DrawOnlyRegionsMode == true {
-		return
+		return nil
+	}
+
+	if step.Action == OpcodeD03_FLASH {
+		rc.fill = &rc.FlashFill
+	} else {
+		rc.fill = &rc.DrawFill
 	}
 
 	var stepColor color.RGBA
@@ -506,19 +678,29 @@ func (step *State) Render(rc *Render) {
 			//						apertureSize = transformCoord(step.CurrentAp.Diameter, renderContext.XRes)
 			apertureSize = transformCoord(step.CurrentAp.Diameter*step.ApTransParams.Scale,
 				rc.XRes)
-			rc.DrawByCircleAperture(Xp, Yp, Xc, Yc, apertureSize, stepColor)
+			return rc.DrawByCircleAperture(Xp, Yp, Xc, Yc, apertureSize, stepColor)
+		} else if step.CurrentAp.Type == AptypeRectangle &&
+			(math.Mod(step.ApTransParams.Rotation, 90.0) != 0 || (Xp != Xc && Yp != Yc)) {
+			// the rotated rectangle aperture or the slanted segment
+			rc.MovePen(Xp, Yp, Xc, Yc, rc.MovePenColor)
+			rc.FillPolygon(step.Contours(rc), stepColor)
 		} else if step.CurrentAp.Type == AptypeRectangle {
 			// draw with rectangle aperture
 			w := transformCoord(step.CurrentAp.XSize*step.ApTransParams.Scale,
 				rc.XRes)
 			h := transformCoord(step.CurrentAp.YSize*step.ApTransParams.Scale,
 				rc.YRes)
-			rc.DrawByRectangleAperture(Xp, Yp, Xc, Yc, w, h, stepColor)
+			if math.Mod(math.Abs(step.ApTransParams.Rotation), 180.0) == 90.0 {
+				w, h = h, w
+			}
+			return rc.DrawByRectangleAperture(Xp, Yp, Xc, Yc, w, h, stepColor)
 		} else {
-			glog.Fatalln("Error. Only solid drawCircle and solid rectangle may be used to draw.")
+			// any other aperture is swept along the line
+			rc.MovePen(Xp, Yp, Xc, Yc, rc.MovePenColor)
+			rc.FillPolygon(step.Contours(rc), stepColor)
 		}
 
-		return
+		return nil
 	}
 
 	// IPModeCwC, IPModeCwCC
@@ -557,31 +739,32 @@ func (step *State) Render(rc *Render) {
 				// TODO
 				rc.RegionColor)
 			if err != nil {
-				step.Print()
-				checkError(err)
+				return NewGeometryError(err.Error())
 			}
 			rc.DrawDonut(Xp, Yp, apertureSize, 0, stepColor)
 			rc.DrawDonut(Xc, Yc, apertureSize, 0, stepColor)
-		} else if step.CurrentAp.Type == AptypeRectangle {
-			glog.Fatalln("Arc drawing by rectangle aperture is not supported now.")
 		} else {
-			glog.Fatalln("Only solid drawCircle and solid rectangle may be used to draw.")
-
+			// any other aperture is swept along the arc
+			rc.MovePen(Xp, Yp, Xc, Yc, rc.MovePenColor)
+			rc.FillPolygon(step.Contours(rc), stepColor)
 		}
-		return
+		return nil
 	}
 
 	if step.Action == OpcodeD03_FLASH { // flash
 		if rc.DrawOnlyRegionsMode != true {
 			rc.MovePen(Xp, Yp, Xc, Yc, rc.MovePenColor)
 			if step.ApTransParams.Polarity == PolTypeDark {
-				step.CurrentAp.Render(Xc, Yc, rc)
+				rc.ApTrans = &step.ApTransParams
+				err := step.CurrentAp.Render(Xc, Yc, rc)
+				rc.ApTrans = nil
+				return err
 			} else {
-				glog.Errorln("Flash by clear polarity is not supported yet.")
+				glog.Errorln("Clear flash must be rendered by RenderComposite.")
 			}
 		}
-		return
+		return nil
 	}
 	// we must not reach this point
-	checkError(errors.New("(renderContext *Render) ProcessStep(step *gerbparser.State) internal error. Bad opcode"))
+	return NewUnsupportedFeatureError("opcode " + step.Action.String())
 }
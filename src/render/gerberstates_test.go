@@ -2,6 +2,7 @@ package render
 
 import (
 	"gerberbasetypes"
+	"math"
 	"testing"
 )
 
@@ -12,3 +13,44 @@ func TestApTransParameters_String(t *testing.T) {
 		Scale:     0.01}
 	t.Log(apt.String())
 }
+
+func TestApTransParameters_Apply(t *testing.T) {
+	apt := ApTransParameters{Polarity: gerberbasetypes.PolTypeDark,
+		Mirroring: gerberbasetypes.MirrorX,
+		Rotation:  90.0,
+		Scale:     2.0}
+	// mirroring first: (1,0) -> (-1,0), rotation: -> (0,-1), scaling: -> (0,-2)
+	x, y := apt.Apply(1.0, 0.0)
+	if math.Abs(x) > 1e-9 || math.Abs(y+2.0) > 1e-9 {
+		t.Error("expected (0,-2), got", x, y)
+	}
+	identity := ApTransParameters{Mirroring: gerberbasetypes.NoMirror, Rotation: 360.0, Scale: 1.0}
+	if identity.IsIdentity() == false || apt.IsIdentity() == true {
+		t.Error("bad identity check")
+	}
+}
+
+func TestApTransParameters_Compose(t *testing.T) {
+	outer := ApTransParameters{Polarity: gerberbasetypes.PolTypeClear,
+		Mirroring: gerberbasetypes.MirrorY,
+		Rotation:  30.0,
+		Scale:     2.0}
+	inner := ApTransParameters{Polarity: gerberbasetypes.PolTypeClear,
+		Mirroring: gerberbasetypes.MirrorXY,
+		Rotation:  45.0,
+		Scale:     0.5}
+	res := outer.Compose(&inner)
+	if res.Polarity != gerberbasetypes.PolTypeDark || res.Mirroring != gerberbasetypes.MirrorX {
+		t.Error("bad polarity or mirroring: " + res.String())
+	}
+	// the composition must be equal to the consecutive transformations
+	pts := [][2]float64{{1, 0}, {0, 1}, {0.3, -2.5}}
+	for _, p := range pts {
+		x1, y1 := inner.Apply(p[0], p[1])
+		x1, y1 = outer.Apply(x1, y1)
+		x2, y2 := res.Apply(p[0], p[1])
+		if math.Abs(x1-x2) > 1e-9 || math.Abs(y1-y2) > 1e-9 {
+			t.Error("expected", x1, y1, "got", x2, y2)
+		}
+	}
+}
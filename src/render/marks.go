@@ -0,0 +1,162 @@
+/*
+################################## Marks ######################################
+The sheet furniture plotted by the pen as the board is: the dashed frame of the board,
+the crop marks at its corners, the fiducials to align the layers of the double sided board
+and the scale bar to check the plotter calibration.
+The marks are placed in the margin around the board.
+*/
+package render
+
+import (
+	"configurator"
+	"errors"
+	"github.com/spf13/viper"
+	glog "glog_t"
+	"math"
+	"strconv"
+)
+
+const (
+	// the dash and the gap of the board frame, mm
+	frameDash  = 2.0
+	frameSpace = 1.0
+	// the gap between the board corner and its crop marks, mm
+	cropMarkGap = 1.0
+	// the distance between the ticks of the scale bar, mm
+	scaleBarTick = 10.0
+)
+
+type Marks struct {
+	Frame bool
+	// the crop marks of CropMarkLength (mm) at the board corners
+	CropMarks      bool
+	CropMarkLength float64
+	// the fiducials of FiducialSize (mm) at the middles of the left, right and top margins
+	Fiducials    bool
+	FiducialSize float64
+	// the scale bar of ScaleBarLength (mm) in the bottom margin, it is not scaled with the board
+	ScaleBar       bool
+	ScaleBarLength float64
+}
+
+// reads the marks, the marks must fit the margin (mm)
+func readMarks(v *viper.Viper, margin float64) (Marks, error) {
+	var retVal Marks
+	marginStr := strconv.FormatFloat(margin, 'f', -1, 64)
+	retVal.Frame = v.GetBool(configurator.CfgRenderMarksFrame)
+	retVal.CropMarks = v.GetBool(configurator.CfgRenderMarksCropMarks)
+	retVal.CropMarkLength = v.GetFloat64(configurator.CfgRenderMarksCropMarkLength)
+	if retVal.CropMarks == true && (retVal.CropMarkLength <= 0 || retVal.CropMarkLength+cropMarkGap > margin) {
+		return retVal, errors.New(configurator.CfgRenderMarksCropMarkLength + " must be from 0 to " +
+			strconv.FormatFloat(margin-cropMarkGap, 'f', -1, 64) + ", the margin " + marginStr + " minus the gap")
+	}
+	retVal.Fiducials = v.GetBool(configurator.CfgRenderMarksFiducials)
+	retVal.FiducialSize = v.GetFloat64(configurator.CfgRenderMarksFiducialSize)
+	if retVal.Fiducials == true && (retVal.FiducialSize <= 0 || retVal.FiducialSize > margin) {
+		return retVal, errors.New(configurator.CfgRenderMarksFiducialSize + " must be from 0 to the margin " + marginStr)
+	}
+	retVal.ScaleBar = v.GetBool(configurator.CfgRenderMarksScaleBar)
+	retVal.ScaleBarLength = v.GetFloat64(configurator.CfgRenderMarksScaleBarLength)
+	if retVal.ScaleBar == true {
+		if retVal.ScaleBarLength <= 0 {
+			return retVal, errors.New(configurator.CfgRenderMarksScaleBarLength + " must be positive")
+		}
+		if margin <= 0 {
+			return retVal, errors.New("the scale bar needs " + configurator.CfgPaperMargin)
+		}
+	}
+	return retVal, nil
+}
+
+// returns true if any of the marks is drawn
+func (m *Marks) Enabled() bool {
+	return m.Frame == true || m.CropMarks == true || m.Fiducials == true || m.ScaleBar == true
+}
+
+// returns the extents of the coordinates in the drawing, plotter steps
+func (rc *Render) boardBounds() (int, int, int, int) {
+	x0, y0, x1, y1 := rc.boardExtents()
+	return transformCoord(x0, rc.XRes), transformCoord(y0, rc.YRes), transformCoord(x1, rc.XRes), transformCoord(y1, rc.YRes)
+}
+
+// draws the enabled marks by the current pen
+func (rc *Render) DrawMarks() {
+	x0, y0, x1, y1 := rc.boardBounds()
+	if rc.Marks.Frame == true {
+		dash, space := transformCoord(frameDash, rc.XRes), transformCoord(frameSpace, rc.XRes)
+		rc.drawDashed(x0, y0, x1, y0, dash, space)
+		rc.drawDashed(x1, y0, x1, y1, dash, space)
+		rc.drawDashed(x1, y1, x0, y1, dash, space)
+		rc.drawDashed(x0, y1, x0, y0, dash, space)
+	}
+	if rc.Marks.CropMarks == true {
+		rc.drawCropMarks(x0, y0, x1, y1)
+	}
+	if rc.Marks.Fiducials == true {
+		// the set is symmetric about the vertical axis of the board, the mirrored layer has the fiducials at the same places
+		mx, my := transformCoord(rc.margin/2, rc.XRes), transformCoord(rc.margin/2, rc.YRes)
+		r := transformCoord(rc.Marks.FiducialSize/2, rc.XRes)
+		rc.drawCrosshair(x0-mx, (y0+y1)/2, r)
+		rc.drawCrosshair(x1+mx, (y0+y1)/2, r)
+		rc.drawCrosshair((x0+x1)/2, y1+my, r)
+	}
+	if rc.Marks.ScaleBar == true {
+		rc.drawScaleBar(x0, y0, x1)
+	}
+}
+
+// draws the dashed line by the pen, the dash and the space are in the plotter steps
+func (rc *Render) drawDashed(x0, y0, x1, y1, dash, space int) {
+	length := math.Hypot(float64(x1-x0), float64(y1-y0))
+	if length == 0 || dash <= 0 {
+		return
+	}
+	dx, dy := float64(x1-x0)/length, float64(y1-y0)/length
+	for s := 0.0; s < length; s += float64(dash + space) {
+		e := math.Min(s+float64(dash), length)
+		rc.drawByBrezenham(x0+int(math.Round(s*dx)), y0+int(math.Round(s*dy)),
+			x0+int(math.Round(e*dx)), y0+int(math.Round(e*dy)), rc.PointSizeI, rc.MarkColor)
+	}
+}
+
+// draws the two arms of each crop mark continuing the board edges out of the corner
+func (rc *Render) drawCropMarks(x0, y0, x1, y1 int) {
+	gapX, gapY := transformCoord(cropMarkGap, rc.XRes), transformCoord(cropMarkGap, rc.YRes)
+	lenX, lenY := transformCoord(rc.Marks.CropMarkLength, rc.XRes), transformCoord(rc.Marks.CropMarkLength, rc.YRes)
+	for _, corner := range [][4]int{{x0, y0, -1, -1}, {x1, y0, 1, -1}, {x1, y1, 1, 1}, {x0, y1, -1, 1}} {
+		x, y, sx, sy := corner[0], corner[1], corner[2], corner[3]
+		rc.drawByBrezenham(x+sx*gapX, y, x+sx*(gapX+lenX), y, rc.PointSizeI, rc.MarkColor)
+		rc.drawByBrezenham(x, y+sy*gapY, x, y+sy*(gapY+lenY), rc.PointSizeI, rc.MarkColor)
+	}
+}
+
+// draws the cross of the radius r in the circle of the radius r/2
+func (rc *Render) drawCrosshair(x, y, r int) {
+	rc.drawByBrezenham(x-r, y, x+r, y, rc.PointSizeI, rc.MarkColor)
+	rc.drawByBrezenham(x, y-r, x, y+r, rc.PointSizeI, rc.MarkColor)
+	rc.drawCircle(x, y, r/2, rc.PointSizeI, rc.MarkColor)
+}
+
+// draws the scale bar centered under the board (x0 - x1) in the middle of the bottom margin,
+// the ticks are each scaleBarTick mm, the end ticks are longer
+func (rc *Render) drawScaleBar(x0, y0, x1 int) {
+	w, _ := rc.Extents()
+	length := transformCoord(rc.Marks.ScaleBarLength, rc.XRes)
+	xs := (x0+x1)/2 - length/2
+	if xs < 0 || xs+length > w {
+		glog.Warningln("The scale bar is longer than the drawing, it is not drawn")
+		return
+	}
+	y := y0 - transformCoord(rc.margin/2, rc.YRes)
+	tick, endTick := transformCoord(rc.margin/4, rc.YRes), transformCoord(rc.margin*3/8, rc.YRes)
+	rc.drawByBrezenham(xs, y, xs+length, y, rc.PointSizeI, rc.MarkColor)
+	for d := 0.0; d < rc.Marks.ScaleBarLength; d += scaleBarTick {
+		x := xs + transformCoord(d, rc.XRes)
+		h := tick
+		if d == 0 {
+			h = endTick
+		}
+		rc.drawByBrezenham(x, y-h, x, y+h, rc.PointSizeI, rc.MarkColor)
+	}
+	rc.drawByBrezenham(xs+length, y-endTick, xs+length, y+endTick, rc.PointSizeI, rc.MarkColor)
+}
@@ -0,0 +1,100 @@
+package render
+
+import (
+	"bytes"
+	"configurator"
+	"emsim"
+	"github.com/spf13/viper"
+	"image"
+	"image/color"
+	"plotter"
+	"testing"
+)
+
+func TestReadMarks(t *testing.T) {
+	v := viper.New()
+	configurator.SetDefaults(v)
+	if _, err := readMarks(v, 10); err != nil {
+		t.Fatal(err)
+	}
+	v.Set(configurator.CfgRenderMarksCropMarks, true)
+	if _, err := readMarks(v, 5); err == nil {
+		t.Error("the crop marks longer than the margin are accepted")
+	}
+	v.Set(configurator.CfgRenderMarksCropMarks, false)
+	v.Set(configurator.CfgRenderMarksFiducials, true)
+	v.Set(configurator.CfgRenderMarksFiducialSize, 6.0)
+	if _, err := readMarks(v, 5); err == nil {
+		t.Error("the fiducials bigger than the margin are accepted")
+	}
+	v.Set(configurator.CfgRenderMarksFiducials, false)
+	v.Set(configurator.CfgRenderMarksScaleBar, true)
+	if _, err := readMarks(v, 0); err == nil {
+		t.Error("the scale bar is accepted without the margin")
+	}
+	m, err := readMarks(v, 10)
+	if err != nil || m.Enabled() == false || m.ScaleBarLength != 50 {
+		t.Error("bad scale bar", m, err)
+	}
+}
+
+func TestDrawMarks(t *testing.T) {
+	out := new(bytes.Buffer)
+	rc := new(Render)
+	rc.XRes = 0.1
+	rc.YRes = 0.1
+	rc.PointSize = 4.0
+	rc.PointSizeI = 4
+	rc.Plt = plotter.NewPlotter(out)
+	rc.Img = image.NewNRGBA(image.Rect(0, 0, 300, 300))
+	rc.MarkColor = color.RGBA{0, 0, 0, 255}
+	// the board is 0,0 - 10,10 mm, the pixels 100 - 200
+	rc.margin = 10
+	rc.MinX, rc.MinY = -10, -10
+	rc.MaxX, rc.MaxY = 20, 20
+	rc.Marks = Marks{Frame: true, CropMarks: true, CropMarkLength: 5, Fiducials: true, FiducialSize: 5,
+		ScaleBar: true, ScaleBarLength: 5}
+
+	rc.Plt.Start()
+	rc.Plt.TakePen(1)
+	rc.DrawMarks()
+	rc.Plt.Stop()
+
+	sim := emsim.NewSimulator(300, 300, []int{4})
+	if err := sim.Run(bytes.NewReader(out.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	img := sim.Image()
+	height := img.Bounds().Dy()
+	inked := [][2]int{
+		// the dash of the frame
+		{110, 100}, {200, 110},
+		// the arms of the lower left crop mark
+		{70, 100}, {100, 70},
+		// the fiducials
+		{50, 150}, {250, 150}, {150, 250},
+		// the scale bar and its end ticks
+		{150, 50}, {125, 80}, {175, 20},
+	}
+	for _, p := range inked {
+		if img.NRGBAAt(p[0], height-1-p[1]).R != 0 {
+			t.Error("the plotter has not inked", p)
+		}
+		if rc.Img.NRGBAAt(p[0], p[1]).A == 0 {
+			t.Error("the image has not inked", p)
+		}
+	}
+	blank := [][2]int{
+		// the gap of the frame dashes
+		{125, 100},
+		// the corner gap of the crop mark
+		{100, 95},
+		// the board and the middle of the scale bar above the bar
+		{150, 150}, {150, 80},
+	}
+	for _, p := range blank {
+		if img.NRGBAAt(p[0], height-1-p[1]).R == 0 {
+			t.Error("the plotter has inked", p)
+		}
+	}
+}
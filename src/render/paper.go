@@ -0,0 +1,127 @@
+/*
+################################## Paper ######################################
+The sheet the board is plotted on: the size (preset or custom), the orientation,
+the blank space around the board and the place of the board on the sheet.
+*/
+package render
+
+import (
+	"configurator"
+	"errors"
+	"github.com/spf13/viper"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// placement of the board on the sheet
+const (
+	PlaceLowerLeft = "lowerleft"
+	PlaceCenter    = "center"
+	PlaceOffset    = "offset"
+)
+
+// the paper sizes, mm, the long side first
+var paperSizes = map[string][2]float64{
+	"a4":     {297, 210},
+	"a3":     {420, 297},
+	"letter": {279.4, 215.9},
+}
+
+type Paper struct {
+	// the name of the size, "custom" if given by the canvas size
+	Size string
+	// the sheet size as it lies on the plotter, mm
+	Width, Height float64
+	// the blank space around the board, mm
+	Margin float64
+	// the board is turned by 90 degrees if it fits the sheet only this way
+	AutoRotate bool
+	// PlaceLowerLeft, PlaceCenter or PlaceOffset
+	Placement string
+	// the lower left corner of the board drawing (the margin included) on the sheet, mm, PlaceOffset only
+	XOffset, YOffset float64
+}
+
+// reads the paper settings, the sheet must fit the working area of the device
+func NewPaper(v *viper.Viper) (*Paper, error) {
+	retVal := new(Paper)
+	retVal.Size = strings.ToLower(v.GetString(configurator.CfgPaperSize))
+	if retVal.Size == "custom" {
+		retVal.Width = v.GetFloat64(configurator.CfgRenderCanvasWidth)
+		retVal.Height = v.GetFloat64(configurator.CfgRenderCanvasHeight)
+		if retVal.Width <= 0 || retVal.Height <= 0 {
+			return nil, errors.New("the canvas size must be positive")
+		}
+	} else {
+		size, ok := paperSizes[retVal.Size]
+		if ok == false {
+			return nil, errors.New("unknown " + configurator.CfgPaperSize + ": " + v.GetString(configurator.CfgPaperSize))
+		}
+		retVal.Width, retVal.Height = size[0], size[1]
+	}
+	// landscape sheet lies by its long side along X
+	switch strings.ToLower(v.GetString(configurator.CfgPaperOrientation)) {
+	case "landscape":
+		if retVal.Width < retVal.Height {
+			retVal.Width, retVal.Height = retVal.Height, retVal.Width
+		}
+	case "portrait":
+		if retVal.Width > retVal.Height {
+			retVal.Width, retVal.Height = retVal.Height, retVal.Width
+		}
+	default:
+		return nil, errors.New(configurator.CfgPaperOrientation + " must be landscape or portrait")
+	}
+	maxWidth := v.GetFloat64(configurator.CfgPlotterMaxWidth)
+	maxHeight := v.GetFloat64(configurator.CfgPlotterMaxHeight)
+	if retVal.Width > maxWidth || retVal.Height > maxHeight {
+		return nil, errors.New("the sheet " + formatMM(retVal.Width) + "x" + formatMM(retVal.Height) +
+			" mm is bigger than the plotter working area " + formatMM(maxWidth) + "x" + formatMM(maxHeight) + " mm")
+	}
+
+	retVal.Margin = v.GetFloat64(configurator.CfgPaperMargin)
+	if retVal.Margin < 0 || 2*retVal.Margin >= math.Min(retVal.Width, retVal.Height) {
+		return nil, errors.New(configurator.CfgPaperMargin + " must be from 0 to the half of the sheet")
+	}
+	retVal.AutoRotate = v.GetBool(configurator.CfgPaperAutoRotate)
+	retVal.Placement = strings.ToLower(v.GetString(configurator.CfgPaperPlacement))
+	switch retVal.Placement {
+	case PlaceLowerLeft, PlaceCenter:
+	case PlaceOffset:
+		retVal.XOffset = v.GetFloat64(configurator.CfgPaperXOffset)
+		retVal.YOffset = v.GetFloat64(configurator.CfgPaperYOffset)
+		if retVal.XOffset < 0 || retVal.YOffset < 0 || retVal.XOffset >= retVal.Width || retVal.YOffset >= retVal.Height {
+			return nil, errors.New(configurator.CfgPaperXOffset + ", " + configurator.CfgPaperYOffset + " must be on the sheet")
+		}
+	default:
+		return nil, errors.New(configurator.CfgPaperPlacement + " must be " + PlaceLowerLeft + ", " + PlaceCenter + " or " + PlaceOffset)
+	}
+	return retVal, nil
+}
+
+func formatMM(a float64) string {
+	return strconv.FormatFloat(a, 'f', -1, 64)
+}
+
+// returns true if the board of the size (mm) with the margin fits the sheet
+func (p *Paper) Fits(width, height float64) bool {
+	return width+2*p.Margin <= p.Width && height+2*p.Margin <= p.Height
+}
+
+// returns true if the board of the size (mm) fits the sheet only being turned by 90 degrees
+func (p *Paper) NeedsRotation(width, height float64) bool {
+	return p.AutoRotate == true && p.Fits(width, height) == false && p.Fits(height, width) == true
+}
+
+// returns the lower left corner (mm) of the drawing of the size (mm) on the sheet
+// the drawing bigger than the sheet is placed at the corner
+func (p *Paper) Origin(width, height float64) (float64, float64) {
+	switch p.Placement {
+	case PlaceCenter:
+		return math.Max(0, (p.Width-width)/2), math.Max(0, (p.Height-height)/2)
+	case PlaceOffset:
+		return p.XOffset, p.YOffset
+	}
+	return 0, 0
+}
@@ -0,0 +1,76 @@
+package render
+
+import (
+	"configurator"
+	"github.com/spf13/viper"
+	"testing"
+)
+
+func TestPaper(t *testing.T) {
+	v := viper.New()
+	configurator.SetDefaults(v)
+	p, err := NewPaper(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the default sheet is the canvas
+	if p.Width != 297 || p.Height != 210 || p.Margin != 10 {
+		t.Error("bad default sheet", p.Width, p.Height, p.Margin)
+	}
+
+	v.Set(configurator.CfgPaperSize, "Letter")
+	v.Set(configurator.CfgPaperOrientation, "portrait")
+	if p, err = NewPaper(v); err != nil {
+		t.Fatal(err)
+	}
+	if p.Width != 215.9 || p.Height != 279.4 {
+		t.Error("bad portrait letter", p.Width, p.Height)
+	}
+	// the board 150 x 240 mm fits with the margins, 240 x 150 mm fits only being turned
+	if p.Fits(150, 240) == false || p.Fits(240, 150) == true || p.NeedsRotation(240, 150) == false {
+		t.Error("bad fitting of the board")
+	}
+	if x, y := p.Origin(100, 100); x != 0 || y != 0 {
+		t.Error("the board is not at the lower left corner", x, y)
+	}
+
+	v.Set(configurator.CfgPaperPlacement, "center")
+	if p, err = NewPaper(v); err != nil {
+		t.Fatal(err)
+	}
+	if x, y := p.Origin(115.9, 79.4); near(x, 50) == false || near(y, 100) == false {
+		t.Error("the board is not centered", x, y)
+	}
+	v.Set(configurator.CfgPaperPlacement, "offset")
+	v.Set(configurator.CfgPaperXOffset, 20)
+	v.Set(configurator.CfgPaperYOffset, 30)
+	if p, err = NewPaper(v); err != nil {
+		t.Fatal(err)
+	}
+	if x, y := p.Origin(100, 100); x != 20 || y != 30 {
+		t.Error("the board is not at the offset", x, y)
+	}
+
+	// the errors
+	bad := map[string]interface{}{
+		configurator.CfgPaperSize:        "B5",
+		configurator.CfgPaperOrientation: "upside",
+		configurator.CfgPaperMargin:      120,
+		configurator.CfgPaperPlacement:   "right",
+		configurator.CfgPaperXOffset:     -1,
+	}
+	for key, value := range bad {
+		w := viper.New()
+		configurator.SetDefaults(w)
+		w.Set(configurator.CfgPaperPlacement, "offset")
+		w.Set(key, value)
+		if _, err := NewPaper(w); err == nil {
+			t.Error(key, "=", value, "is accepted")
+		}
+	}
+	// the portrait A3 does not fit the device
+	v.Set(configurator.CfgPaperSize, "A3")
+	if _, err := NewPaper(v); err == nil {
+		t.Error("the sheet bigger than the device is accepted")
+	}
+}
@@ -0,0 +1,141 @@
+/*
+Selects the pen for each feature by its size
+*/
+package render
+
+import (
+	. "gerberbasetypes"
+	"math"
+	"regions"
+)
+
+// makes the pen current, the point size and the fill spacing follow the pen width
+func (rc *Render) SelectPen(pen int) {
+	rc.Pen = pen
+	rc.PenWidth = rc.penSizes[pen-1]
+	rc.PointSize = rc.PenWidth / rc.XRes
+	rc.PointSizeI = int(math.Round(rc.PointSize))
+}
+
+// returns the narrowest and the widest pens, both are 1 if the features are drawn by one pen
+func (rc *Render) narrowAndWidePens() (int, int) {
+	narrow, wide := 0, 0
+	if rc.widePenThreshold <= 0 {
+		return 1, 1
+	}
+	for i, size := range rc.penSizes {
+		if size <= 0 {
+			continue
+		}
+		if narrow == 0 || size < rc.penSizes[narrow-1] {
+			narrow = i + 1
+		}
+		if wide == 0 || size > rc.penSizes[wide-1] {
+			wide = i + 1
+		}
+	}
+	if narrow == 0 || narrow == wide {
+		return 1, 1
+	}
+	return narrow, wide
+}
+
+// returns the pens in the order they are used, the wide pen draws first
+// the negative image is one composition, it is drawn by the composition pen
+func (rc *Render) Pens() []int {
+	narrow, wide := rc.narrowAndWidePens()
+	if narrow == wide || rc.Negative == true {
+		return []int{narrow}
+	}
+	return []int{wide, narrow}
+}
+
+// the pen which draws the composed dark and clear objects, the composition may contain the fine details
+func (rc *Render) CompositePen() int {
+	narrow, _ := rc.narrowAndWidePens()
+	return narrow
+}
+
+/*
+Returns the pen of each step.
+The features at least renderer.WidePenThreshold wide are drawn by the widest pen, the other ones by the narrowest pen.
+The width of a draw or a flash is the size of its aperture, the width of a region is the smaller side of its extents.
+The move is rendered by the pen of the feature following it, the moves at the end are rendered by the last pen.
+*/
+func (rc *Render) StepPens(steps []*State) []int {
+	retVal := make([]int, len(steps))
+	narrow, wide := rc.narrowAndWidePens()
+	if narrow == wide {
+		for k := range retVal {
+			retVal[k] = narrow
+		}
+		return retVal
+	}
+	penOf := func(size float64) int {
+		if size >= rc.widePenThreshold {
+			return wide
+		}
+		return narrow
+	}
+	// the region is drawn by one pen
+	regionPens := make(map[*regions.Region]int)
+	for k, step := range steps {
+		switch {
+		case step.Region != nil:
+			pen, ok := regionPens[step.Region]
+			if ok == false {
+				pen = penOf(regionSize(steps[k:], step.Region))
+				regionPens[step.Region] = pen
+			}
+			retVal[k] = pen
+		case step.Action == OpcodeD01_DRAW || step.Action == OpcodeD03_FLASH:
+			retVal[k] = penOf(rc.apertureSize(step.CurrentAp) * step.ApTransParams.Scale)
+		}
+	}
+	next := narrow
+	for k := len(retVal) - 1; k >= 0; k-- {
+		if retVal[k] == 0 {
+			retVal[k] = next
+		}
+		next = retVal[k]
+	}
+	return retVal
+}
+
+// returns the smaller side of the region extents, mm
+func regionSize(steps []*State, region *regions.Region) float64 {
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+	for _, step := range steps {
+		if step.Region != region {
+			break
+		}
+		minX = math.Min(minX, step.Coord.GetX())
+		minY = math.Min(minY, step.Coord.GetY())
+		maxX = math.Max(maxX, step.Coord.GetX())
+		maxY = math.Max(maxY, step.Coord.GetY())
+	}
+	return math.Min(maxX-minX, maxY-minY)
+}
+
+// returns the size of the aperture, mm
+// the size of the macro is the smaller side of its extents, the block apertures are treated as the fine ones
+func (rc *Render) apertureSize(apert *Aperture) float64 {
+	if apert == nil {
+		return 0
+	}
+	switch apert.Type {
+	case AptypeCircle, AptypePoly:
+		return apert.Diameter
+	case AptypeRectangle, AptypeObround:
+		return math.Min(apert.XSize, apert.YSize)
+	case AptypeMacro:
+		contours := apert.Contours(0, 0, rc)
+		if len(contours) == 0 {
+			return 0
+		}
+		box := contours.BoundingBox()
+		return math.Min((box.Max.X-box.Min.X)*rc.XRes, (box.Max.Y-box.Min.Y)*rc.YRes)
+	}
+	return 0
+}
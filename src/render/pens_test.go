@@ -0,0 +1,100 @@
+package render
+
+import (
+	. "gerberbasetypes"
+	"regions"
+	"testing"
+)
+
+// returns the step with the action at x, y (mm)
+func penTestStep(action ActType, ap *Aperture, x, y float64) *State {
+	step := traceTestStep(ap, x, y, x, y)
+	step.Action = action
+	return step
+}
+
+func TestStepPens(t *testing.T) {
+	rc := new(Render)
+	rc.XRes = 0.025
+	rc.YRes = 0.025
+	rc.penSizes = []float64{0.1, 0.5, 0.05, 0.0}
+
+	fine := &Aperture{Type: AptypeCircle, Diameter: 0.2}
+	pad := &Aperture{Type: AptypeRectangle, XSize: 2.0, YSize: 1.5}
+	slot := &Aperture{Type: AptypeObround, XSize: 3.0, YSize: 0.3}
+	pour := new(regions.Region)
+	strip := new(regions.Region)
+	steps := []*State{
+		penTestStep(OpcodeD02_MOVE, fine, 0, 0),
+		penTestStep(OpcodeD01_DRAW, fine, 1, 0),
+		penTestStep(OpcodeD03_FLASH, pad, 2, 0),
+		penTestStep(OpcodeD03_FLASH, slot, 3, 0),
+		penTestStep(OpcodeD01_DRAW, nil, 0, 0),
+		penTestStep(OpcodeD01_DRAW, nil, 10, 0),
+		penTestStep(OpcodeD01_DRAW, nil, 10, 10),
+		penTestStep(OpcodeD01_DRAW, nil, 0, 0),
+		penTestStep(OpcodeD01_DRAW, nil, 10, 0),
+		penTestStep(OpcodeD01_DRAW, nil, 10, 0.5),
+	}
+	for _, step := range steps[4:7] {
+		step.Region = pour
+	}
+	for _, step := range steps[7:] {
+		step.Region = strip
+	}
+
+	// one pen draws everything until the threshold is set
+	if pens := rc.Pens(); len(pens) != 1 || pens[0] != 1 {
+		t.Fatal("expected the pen 1, got", pens)
+	}
+	for k, pen := range rc.StepPens(steps) {
+		if pen != 1 {
+			t.Error("the step", k, "is drawn by the pen", pen)
+		}
+	}
+
+	rc.widePenThreshold = 1.0
+	if pens := rc.Pens(); len(pens) != 2 || pens[0] != 2 || pens[1] != 3 {
+		t.Fatal("expected the wide pen 2 and the narrow pen 3, got", pens)
+	}
+	if pen := rc.CompositePen(); pen != 3 {
+		t.Error("the composition is drawn by the pen", pen)
+	}
+	expected := []int{3, 3, 2, 3, 2, 2, 2, 3, 3, 3}
+	for k, pen := range rc.StepPens(steps) {
+		if pen != expected[k] {
+			t.Error("the step", k, "is drawn by the pen", pen, "expected", expected[k])
+		}
+	}
+
+	// the move goes with the feature following it, the last one is drawn by the last pen
+	moves := []*State{
+		penTestStep(OpcodeD02_MOVE, pad, 0, 0),
+		penTestStep(OpcodeD03_FLASH, pad, 2, 0),
+		penTestStep(OpcodeD02_MOVE, pad, 0, 0),
+	}
+	if pens := rc.StepPens(moves); pens[0] != 2 || pens[2] != 3 {
+		t.Error("the moves are drawn by the pens", pens)
+	}
+
+	// the scaled aperture is wider
+	steps[1].ApTransParams.Scale = 10
+	if pen := rc.StepPens(steps)[1]; pen != 2 {
+		t.Error("the scaled draw is drawn by the pen", pen)
+	}
+
+	rc.SelectPen(2)
+	if rc.Pen != 2 || rc.PenWidth != 0.5 || rc.PointSizeI != 20 {
+		t.Error("the pen 2 is selected as", rc.Pen, rc.PenWidth, rc.PointSize, rc.PointSizeI)
+	}
+	rc.SelectPen(3)
+	if rc.PointSizeI != 2 || rc.fillSpacing() != 2 {
+		t.Error("the point size of the pen 3 is", rc.PointSize, rc.PointSizeI)
+	}
+
+	// the pens of the same width are one pen
+	rc.penSizes = []float64{0.1, 0.1, 0.0, 0.0}
+	if pens := rc.Pens(); len(pens) != 1 || pens[0] != 1 {
+		t.Error("expected the pen 1, got", pens)
+	}
+}
@@ -0,0 +1,151 @@
+/*
+################################## Polarity ######################################
+clear polarity (%LPC*%) support
+
+The pen can not erase the ink, so the objects are converted to polygons and composed
+in the file order: dark objects are added to the image, clear objects are subtracted.
+The resulting polygon is filled by the strokes which never leave it.
+
+The negative image is composed the same way and subtracted from the board area.
+*/
+package render
+
+import (
+	. "gerberbasetypes"
+	"github.com/akavel/polyclip-go"
+	"math"
+	"sort"
+)
+
+// returns the index of the last step which must be composed, -1 if there are no clear objects
+// the steps after it are not affected by the clear polarity and may be rendered one by one
+func LastClearStep(steps []*State) int {
+	retVal := -1
+	for k, step := range steps {
+		if step.Action == OpcodeStop {
+			break
+		}
+		if step.ApTransParams.Polarity == PolTypeClear && step.Action != OpcodeD02_MOVE {
+			retVal = k
+		}
+	}
+	// the region must not be split
+	for retVal >= 0 && retVal+1 < len(steps) &&
+		steps[retVal].Region != nil && steps[retVal+1].Region == steps[retVal].Region {
+		retVal++
+	}
+	return retVal
+}
+
+// composes the steps according to their polarity and fills the result
+// the error carries the source of the step being composed
+func (rc *Render) RenderComposite(steps []*State) error {
+	var image polyclip.Polygon
+	var batch []polyclip.Polygon
+	batchPolarity := PolTypeDark
+	regionSteps := make([]*State, 0)
+
+	// objects of the same polarity are merged together before applying to the image
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if batchPolarity == PolTypeDark {
+			image = clip(image, unionAll(batch), polyclip.UNION)
+		} else {
+			image = clip(image, unionAll(batch), polyclip.DIFFERENCE)
+		}
+		batch = batch[:0]
+	}
+
+	for _, step := range steps {
+		if step.Action == OpcodeStop {
+			break
+		}
+		var p polyclip.Polygon
+		polarity := step.ApTransParams.Polarity
+		if step.Region != nil {
+			regionSteps = append(regionSteps, step)
+			if len(regionSteps) < step.Region.GetNumXY() {
+				continue
+			}
+			polarity = regionSteps[0].ApTransParams.Polarity
+			var err error
+			p, err = rc.regionPolygon(regionSteps)
+			if err != nil {
+				return sourceError(err, &step.Source)
+			}
+			regionSteps = regionSteps[:0]
+		} else {
+			if rc.DrawOnlyRegionsMode == true {
+				continue
+			}
+			p = step.Contours(rc)
+		}
+		if len(p) == 0 {
+			continue
+		}
+		if polarity != batchPolarity {
+			flush()
+			batchPolarity = polarity
+		}
+		batch = append(batch, p)
+	}
+	flush()
+	if rc.Negative == true {
+		image = clip(polyclip.Polygon{rc.boardContour()}, image, polyclip.DIFFERENCE)
+	}
+	rc.fill = &rc.RegionFill
+	rc.FillPolygon(image, rc.RegionColor)
+	rc.fill = nil
+	return nil
+}
+
+// returns the board area, the extents of the coordinates expanded by the negative margin
+func (rc *Render) boardContour() polyclip.Contour {
+	m := rc.NegativeMargin
+	bx0, by0, bx1, by1 := rc.boardExtents()
+	x0, y0 := (bx0-m)/rc.XRes, (by0-m)/rc.YRes
+	x1, y1 := (bx1+m)/rc.XRes, (by1+m)/rc.YRes
+	return polyclip.Contour{{X: x0, Y: y0}, {X: x1, Y: y0}, {X: x1, Y: y1}, {X: x0, Y: y1}}
+}
+
+// polygon edge
+type edge struct {
+	x0, y0, x1, y1 float64
+}
+
+// returns the sorted inner spans of the polygon on the horizontal line y
+func scanSpans(edges []edge, y float64) [][2]float64 {
+	nodes := make([]float64, 0)
+	for _, e := range edges {
+		if e.y0 <= y && y < e.y1 {
+			nodes = append(nodes, e.x0+(y-e.y0)/(e.y1-e.y0)*(e.x1-e.x0))
+		}
+	}
+	sort.Float64s(nodes)
+	retVal := make([][2]float64, 0, len(nodes)/2)
+	for i := 0; i+1 < len(nodes); i += 2 {
+		retVal = append(retVal, [2]float64{nodes[i], nodes[i+1]})
+	}
+	return retVal
+}
+
+// returns the intersection of two sorted span lists
+func intersectSpans(a, b [][2]float64) [][2]float64 {
+	retVal := make([][2]float64, 0, len(a))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		lo := math.Max(a[i][0], b[j][0])
+		hi := math.Min(a[i][1], b[j][1])
+		if lo < hi {
+			retVal = append(retVal, [2]float64{lo, hi})
+		}
+		if a[i][1] < b[j][1] {
+			i++
+		} else {
+			j++
+		}
+	}
+	return retVal
+}
@@ -0,0 +1,102 @@
+package render
+
+import (
+	"bytes"
+	"emsim"
+	. "gerberbasetypes"
+	"github.com/akavel/polyclip-go"
+	"image"
+	"io/ioutil"
+	"math"
+	"plotter"
+	"testing"
+)
+
+func TestIntersectSpans(t *testing.T) {
+	a := [][2]float64{{0, 10}, {20, 30}}
+	b := [][2]float64{{5, 25}, {28, 40}}
+	res := intersectSpans(a, b)
+	exp := [][2]float64{{5, 10}, {20, 25}, {28, 30}}
+	if len(res) != len(exp) {
+		t.Fatal("expected", exp, "got", res)
+	}
+	for i := range exp {
+		if res[i] != exp[i] {
+			t.Error("expected", exp, "got", res)
+		}
+	}
+}
+
+func TestFillPolygonKeepsClearArea(t *testing.T) {
+	rc := new(Render)
+	rc.PointSize = 4.0
+	rc.PointSizeI = 4
+	rc.Plt = plotter.NewPlotter(ioutil.Discard)
+	rc.Img = image.NewNRGBA(image.Rect(0, 0, 200, 200))
+	rc.DrawContours = false
+
+	dark := polyclip.Polygon{rectangleContour(100, 100, 160, 160)}
+	clear := polyclip.Polygon{circleContour(100, 100, 30)}
+	clear = clip(clear, polyclip.Polygon{stadiumContour(20, 40, 180, 60, 5)}, polyclip.UNION)
+	rc.FillPolygon(clip(dark, clear, polyclip.DIFFERENCE), rc.RegionColor)
+
+	if rc.LineBresCounter == 0 {
+		t.Fatal("nothing was drawn")
+	}
+	for x := 0; x < 200; x++ {
+		for y := 0; y < 200; y++ {
+			inClear := (x-100)*(x-100)+(y-100)*(y-100) < 29*29
+			outside := x < 20 || x > 180 || y < 20 || y > 180
+			if (inClear || outside) && rc.Img.NRGBAAt(x, y).A != 0 {
+				t.Fatal("the pen has inked the clear area at", x, y)
+			}
+		}
+	}
+}
+
+func TestRenderNegative(t *testing.T) {
+	out := new(bytes.Buffer)
+	rc := new(Render)
+	rc.XRes = 0.1
+	rc.YRes = 0.1
+	rc.PointSize = 4.0
+	rc.PointSizeI = 4
+	rc.Plt = plotter.NewPlotter(out)
+	rc.Img = image.NewNRGBA(image.Rect(0, 0, 300, 300))
+	// the board is 0,0 - 10,10 mm, the pixels 100 - 200
+	rc.margin = 10
+	rc.MinX, rc.MinY = -10, -10
+	rc.MaxX, rc.MaxY = 20, 20
+	rc.Negative = true
+	rc.NegativeMargin = 1
+
+	pad := &Aperture{Type: AptypeCircle, Diameter: 4}
+	steps := []*State{penTestStep(OpcodeD03_FLASH, pad, 5, 5)}
+	rc.Plt.Start()
+	rc.Plt.TakePen(1)
+	if err := rc.RenderComposite(steps); err != nil {
+		t.Fatal(err)
+	}
+	rc.Plt.Stop()
+
+	sim := emsim.NewSimulator(300, 300, []int{4})
+	if err := sim.Run(bytes.NewReader(out.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	img := sim.Image()
+	height := img.Bounds().Dy()
+	for x := 0; x < img.Bounds().Dx(); x++ {
+		for y := 0; y < height; y++ {
+			inked := img.NRGBAAt(x, height-1-y).R == 0
+			// the pad is not inked, the board expanded by the margin is
+			pad := math.Hypot(float64(x-150), float64(y-150)) - 20
+			board := math.Min(math.Min(float64(x-90), float64(210-x)), math.Min(float64(y-90), float64(210-y)))
+			if d := math.Min(pad, board); d < -1.5 && inked == true {
+				t.Fatal("the pen is out of the negative image at", x, y)
+			}
+			if pad > 6 && board > 6 && inked == false {
+				t.Fatal("the negative image is not filled at", x, y)
+			}
+		}
+	}
+}
@@ -3,6 +3,8 @@ package render
 import (
 	"configurator"
 	"errors"
+	"fmt"
+	"github.com/akavel/polyclip-go"
 	"github.com/spf13/viper"
 	glog "glog_t"
 	"image"
@@ -27,10 +29,30 @@ type Render struct {
 
 	// pen width
 	PenWidth float64
+	// the current pen, its width is PenWidth
+	Pen int
+	// the pen sizes (mm), the pen N size has index N-1
+	penSizes []float64
+	// the features at least this wide (mm) are drawn by the widest pen, 0 - all the features are drawn by the pen 1
+	widePenThreshold float64
+	// the board area without the dark objects is drawn
+	Negative bool
+	// the board area is expanded by the margin (mm)
+	NegativeMargin float64
+	// the drawing bigger than the working area is plotted on several sheets overlapped by TileOverlap (mm)
+	Tiling      bool
+	TileOverlap float64
+	// the size of the registration marks (mm)
+	TileMarkSize float64
+	// the frame, the crop marks, the fiducials and the scale bar plotted around the board
+	Marks Marks
 
 	// paper or pcb max dimensions
-	CanvasWidth  int // paper property
-	CanvasHeight int // paper property
+	Paper        *Paper
+	CanvasWidth  float64 // paper property
+	CanvasHeight float64 // paper property
+	// the lower left corner of the drawing on the sheet, plotter steps
+	OriginX, OriginY int
 	LimitsX0     int
 	LimitsY0     int
 	LimitsX1     int
@@ -38,13 +60,17 @@ type Render struct {
 
 	// magrin is a safety margin to draw all the border elements of the pcb
 	margin float64
+	// the title block stamped under the board, nil if none, it is set before Init
+	Title *TitleBlock
+	// the space added to the drawing for the title block at the right and at the bottom, mm
+	titleSpaceX, titleSpaceY float64
 
 	YNeedsFlip bool
 
 	// setPoint size in terms of real plotter pen points
 	PointSize  float64
 	PointSizeI int
-	Plt        *plotter.PlotterParams
+	Plt        plotter.Plotter
 	// pcb properties
 	MinX float64
 	MinY float64
@@ -60,6 +86,7 @@ type Render struct {
 	MovePenColor color.RGBA
 	MissedColor  color.RGBA
 	ContourColor color.RGBA
+	MarkColor    color.RGBA
 
 	// regions processor
 	ProcessingRegion bool
@@ -81,59 +108,104 @@ type Render struct {
 
 	// polygon being processed
 	PolygonPtr *Polygon
+
+	// transformation parameters (%LM, %LR, %LS) of the aperture being flashed, nil if none
+	ApTrans *ApTransParameters
+
+	// fills of the flashes, the regions and the draws
+	FlashFill  FillParams
+	RegionFill FillParams
+	DrawFill   FillParams
+	// fill of the feature being rendered, nil if none
+	fill *FillParams
 }
 
-func NewRender(plotter *plotter.PlotterParams, viper *viper.Viper, minX, minY, maxX, maxY float64) *Render {
+func NewRender(plotter plotter.Plotter, viper *viper.Viper, minX, minY, maxX, maxY float64) (*Render, error) {
 	retVal := new(Render)
-	retVal.Init(plotter, viper, minX, minY, maxX, maxY)
-	return retVal
+	if err := retVal.Init(plotter, viper, minX, minY, maxX, maxY); err != nil {
+		return nil, err
+	}
+	return retVal, nil
 }
 
-func (rc *Render) Init(plt *plotter.PlotterParams, viper *viper.Viper, minX, minY, maxX, maxY float64) {
+func (rc *Render) Init(plt plotter.Plotter, viper *viper.Viper, minX, minY, maxX, maxY float64) error {
 	// physical plotter single step size
 	rc.XRes = viper.GetFloat64(configurator.CfgPlotterXRes)
 	rc.YRes = viper.GetFloat64(configurator.CfgPlotterYRes)
 
-	arr := viper.Get(configurator.CfgPlotterPenSizes)
-	b, ok := arr.([]interface{})
-	if ok == false {
-		glog.Fatalln("penSizes configuration error")
+	penSizes, err := configurator.PenSizes(viper)
+	if err != nil {
+		return err
 	}
-	rc.PenWidth = b[0].(float64)
+	rc.penSizes = penSizes
+	rc.widePenThreshold = viper.GetFloat64(configurator.CfgRenderWidePenThreshold)
+	// the negative image is drawn by one pen
+	rc.Negative = viper.GetBool(configurator.CfgRenderNegative)
 
 	// paper or pcb max dimensions
 	rc.LimitsX0 = 0
 	rc.LimitsY0 = 0
-	rc.CanvasWidth = 297
-	rc.CanvasHeight = 210
-	rc.margin = 10.0
+	if rc.Paper, err = NewPaper(viper); err != nil {
+		return err
+	}
+	rc.CanvasWidth = rc.Paper.Width
+	rc.CanvasHeight = rc.Paper.Height
+	rc.margin = rc.Paper.Margin
 	rc.MinX = minX - rc.margin
 	rc.MinY = minY - rc.margin
 	rc.MaxX = maxX + rc.margin
 	rc.MaxY = maxY + rc.margin
+	// the title block is placed under the bottom margin, the drawing is widened if the block is wider
+	if rc.Title != nil {
+		rc.Title.PenSizes = make([]float64, 0, 2)
+		for _, pen := range rc.Pens() {
+			rc.Title.PenSizes = append(rc.Title.PenSizes, rc.penSizes[pen-1])
+		}
+		width, height := rc.Title.Size()
+		rc.titleSpaceX = math.Max(0, width-(rc.MaxX-rc.MinX))
+		rc.titleSpaceY = height
+		rc.MaxX += rc.titleSpaceX
+		rc.MinY -= rc.titleSpaceY
+	}
+	originX, originY := rc.Paper.Origin(rc.MaxX-rc.MinX, rc.MaxY-rc.MinY)
+	rc.OriginX = transformCoord(originX, rc.XRes)
+	rc.OriginY = transformCoord(originY, rc.YRes)
 
 	rc.LimitsX1 = int((rc.MaxX - rc.MinX) / float64(rc.XRes))
 	rc.LimitsY1 = int((rc.MaxY - rc.MinY) / float64(rc.YRes))
 
-	maxLimX1 := int(float64(rc.CanvasWidth) / float64(rc.XRes))
-	maxLimY1 := int(float64(rc.CanvasHeight) / float64(rc.YRes))
-
-	if rc.LimitsX1 > maxLimX1 {
-		glog.Warningln("PCB size X is bigger than plotter working area! The PCB will be truncated.")
-		rc.LimitsX1 = maxLimX1
-	}
+	maxLimX1 := int((rc.CanvasWidth - originX) / float64(rc.XRes))
+	maxLimY1 := int((rc.CanvasHeight - originY) / float64(rc.YRes))
+
+	// the tiled drawing is not truncated, the image is cut to the sheets
+	rc.Tiling = viper.GetBool(configurator.CfgRenderTilesEnable)
+	rc.TileOverlap = viper.GetFloat64(configurator.CfgRenderTilesOverlap)
+	rc.TileMarkSize = viper.GetFloat64(configurator.CfgRenderTilesMarkSize)
+	if rc.Tiling == true {
+		maxOverlap := math.Min(rc.CanvasWidth, rc.CanvasHeight) / 2
+		if rc.TileOverlap <= 0 || rc.TileOverlap >= maxOverlap {
+			return errors.New(configurator.CfgRenderTilesOverlap + " must be from 0 to " + strconv.FormatFloat(maxOverlap, 'f', -1, 64))
+		}
+		if rc.TileMarkSize <= 0 || rc.TileMarkSize > rc.TileOverlap {
+			return errors.New(configurator.CfgRenderTilesMarkSize + " must be from 0 to " + configurator.CfgRenderTilesOverlap)
+		}
+	} else {
+		if rc.LimitsX1 > maxLimX1 {
+			glog.Warningln("PCB size X is bigger than plotter working area! The PCB will be truncated.")
+			rc.LimitsX1 = maxLimX1
+		}
 
-	if rc.LimitsY1 > maxLimY1 {
-		glog.Warningln("PCB size Y is bigger than plotter working area! The PCB will be truncated.")
-		rc.LimitsY1 = maxLimY1
+		if rc.LimitsY1 > maxLimY1 {
+			glog.Warningln("PCB size Y is bigger than plotter working area! The PCB will be truncated.")
+			rc.LimitsY1 = maxLimY1
+		}
 	}
 
 	rc.Img = image.NewNRGBA(image.Rect(rc.LimitsX0, rc.LimitsY0, rc.LimitsX1, rc.LimitsY1))
 	rc.YNeedsFlip = true
 
 	// setPoint size in terms of real plotter pen points
-	rc.PointSize = rc.PenWidth / rc.XRes
-	rc.PointSizeI = int(math.Round(rc.PointSize))
+	rc.SelectPen(1)
 
 	rc.ApColor = color.RGBA{255, 0, 0, 255}
 	rc.LineColor = color.RGBA{0, 0, 255, 255}
@@ -143,6 +215,7 @@ func (rc *Render) Init(plt *plotter.PlotterParams, viper *viper.Viper, minX, min
 	rc.MovePenColor = color.RGBA{100, 100, 100, 255}
 	rc.MissedColor = color.RGBA{127, 127, 255, 255}
 	rc.ContourColor = color.RGBA{0, 255, 0, 255}
+	rc.MarkColor = color.RGBA{0, 0, 0, 255}
 
 	rc.Plt = plt
 
@@ -152,17 +225,55 @@ func (rc *Render) Init(plt *plotter.PlotterParams, viper *viper.Viper, minX, min
 	rc.DrawMoves = viper.GetBool(configurator.CfgRenderDrawMoves)
 	rc.DrawOnlyRegionsMode = viper.GetBool(configurator.CfgRenderDrawOnlyRegions)
 	rc.PrintRegionInfo = viper.GetBool(configurator.CfgPrintRegionInfo)
+	rc.NegativeMargin = viper.GetFloat64(configurator.CfgRenderNegativeMargin)
+	if rc.NegativeMargin < 0 || rc.NegativeMargin > rc.margin {
+		return errors.New(configurator.CfgRenderNegativeMargin + " must be from 0 to " + strconv.FormatFloat(rc.margin, 'f', -1, 64))
+	}
+	if rc.Marks, err = readMarks(viper, rc.margin); err != nil {
+		return err
+	}
+
+	// fill strategies
+	if rc.FlashFill, err = readFillParams(viper, configurator.CfgRenderFlashFillStrategy,
+		configurator.CfgRenderFlashFillAngle, configurator.CfgRenderFlashFillOverlap); err != nil {
+		return err
+	}
+	if rc.RegionFill, err = readFillParams(viper, configurator.CfgRenderRegionFillStrategy,
+		configurator.CfgRenderRegionFillAngle, configurator.CfgRenderRegionFillOverlap); err != nil {
+		return err
+	}
+	if rc.DrawFill, err = readFillParams(viper, configurator.CfgRenderDrawFillStrategy,
+		configurator.CfgRenderDrawFillAngle, configurator.CfgRenderDrawFillOverlap); err != nil {
+		return err
+	}
+	glog.Infoln("Fill strategies: flashes -", rc.FlashFill.Strategy, ", regions -", rc.RegionFill.Strategy,
+		", draws -", rc.DrawFill.Strategy)
+
+	return nil
+}
+
+// returns the size of the drawing area in the plotter steps, the frame is drawn around it
+func (rc *Render) Extents() (int, int) {
+	return transformCoord(rc.MaxX-rc.MinX, rc.XRes), transformCoord(rc.MaxY-rc.MinY, rc.YRes)
+}
+
+// returns the extents of the coordinates in the drawing, mm
+func (rc *Render) boardExtents() (float64, float64, float64, float64) {
+	return rc.margin, rc.margin + rc.titleSpaceY, rc.MaxX - rc.MinX - rc.margin - rc.titleSpaceX, rc.MaxY - rc.MinY - rc.margin
+}
 
-	return
+// returns the sheet in the plotter steps of the drawing: the lower left corner and the size
+func (rc *Render) Sheet() (int, int, int, int) {
+	return -rc.OriginX, -rc.OriginY, transformCoord(rc.CanvasWidth, rc.XRes), transformCoord(rc.CanvasHeight, rc.YRes)
 }
 
+// draws the border of the drawing area in the png only, the plotted frame of the board is one of the marks
 func (rc *Render) DrawFrame() {
 
 	//if (rc.MaxY - rc.margin) <= 0 {
 	//	rc.YNeedsFlip = true
 	//}
-	x2 := transformCoord(rc.MaxX-rc.MinX, rc.XRes)
-	y2 := transformCoord(rc.MaxY-rc.MinY, rc.YRes)
+	x2, y2 := rc.Extents()
 	frameColor := color.RGBA{127, 127, 127, 255}
 	rc.bresenhamWithPattern(0, 0, x2, 0, 1, frameColor, 10, 10)
 	rc.bresenhamWithPattern(x2, 0, x2, y2, 1, frameColor, 10, 10)
@@ -206,15 +317,13 @@ func (rc *Render) setPoint(x, y, pointSize int, col color.Color) {
 	}
 }
 
-// for D01 commands
-func (rc *Render) DrawByRectangleAperture(x0, y0, x1, y1, apSizeX, apSizeY int, col color.Color) {
+// for D01 commands, the horizontal and the vertical draws only, the slanted ones are filled from the step contours
+func (rc *Render) DrawByRectangleAperture(x0, y0, x1, y1, apSizeX, apSizeY int, col color.Color) error {
 
 	var w, h, xOrigin, yOrigin int
 
 	if x0 != x1 && y0 != y1 {
-		glog.Errorln("Drawing by rectangular aperture with arbitrary angle is not supported!")
-		rc.drawCircle(x0, y0, apSizeX/2, rc.PointSizeI, rc.MissedColor)
-		rc.drawCircle(x1, y1, apSizeX/2, rc.PointSizeI, rc.MissedColor)
+		return NewUnsupportedFeatureError("slanted draw by the rectangle aperture without its contours")
 	}
 	if x0 > x1 {
 		x0, x1 = x1, x0
@@ -230,10 +339,12 @@ func (rc *Render) DrawByRectangleAperture(x0, y0, x1, y1, apSizeX, apSizeY int,
 		w = apSizeX
 		// draw by pen from x0,y0 to rectangle's origin
 		rc.drawByBrezenham(x0, y0, xOrigin, yOrigin, rc.PointSizeI, col)
-		rc.DrawFilledRectangle(xOrigin, yOrigin, w, h, col)
+		if err := rc.DrawFilledRectangle(xOrigin, yOrigin, w, h, col); err != nil {
+			return err
+		}
 		// draw back by pen from rectangle's origin to x1, y1
 		rc.drawByBrezenham(xOrigin, yOrigin, x1, y1, rc.PointSizeI, col)
-		return
+		return nil
 	}
 	if y0 == y1 { // horizontal draw
 		yOrigin = y0
@@ -242,14 +353,17 @@ func (rc *Render) DrawByRectangleAperture(x0, y0, x1, y1, apSizeX, apSizeY int,
 		h = apSizeY
 		// draw by pen from x0,y0 to rectangle's origin
 		rc.drawByBrezenham(x0, y0, xOrigin, yOrigin, rc.PointSizeI, col)
-		rc.DrawFilledRectangle(xOrigin, yOrigin, w, h, col)
+		if err := rc.DrawFilledRectangle(xOrigin, yOrigin, w, h, col); err != nil {
+			return err
+		}
 		rc.drawByBrezenham(xOrigin, yOrigin, x1, y1, rc.PointSizeI, col)
-		return
+		return nil
 	}
+	return nil
 }
 
 // for D01 commands
-func (rc *Render) DrawByCircleAperture(x0, y0, x1, y1, apDia int, col color.Color) {
+func (rc *Render) DrawByCircleAperture(x0, y0, x1, y1, apDia int, col color.Color) error {
 	// save x0, y0, x1, y1
 	savedx0 := x0
 	savedy0 := y0
@@ -276,12 +390,14 @@ func (rc *Render) DrawByCircleAperture(x0, y0, x1, y1, apDia int, col color.Colo
 		xPen, yPen = rc.drawByBrezenham(savedx0, savedy0, xOrigin, yOrigin, ptsz, col)
 		w := x1 - x0
 		h := apDia
-		rc.DrawFilledRectangle(xOrigin, yOrigin, w, h, col)
+		if err := rc.DrawFilledRectangle(xOrigin, yOrigin, w, h, col); err != nil {
+			return err
+		}
 		// move pen back to original x1, y1 setPoint
 		xPen, yPen = rc.drawByBrezenham(xOrigin, yOrigin, savedx1, savedy1, ptsz, col)
 		rc.DrawDonut(savedx1, savedy1, apDia, 0, col)
 		_, _ = xPen, yPen
-		return
+		return nil
 	}
 	if x0 == x1 {
 		// y0 < y1 always here
@@ -292,12 +408,14 @@ func (rc *Render) DrawByCircleAperture(x0, y0, x1, y1, apDia int, col color.Colo
 		w := apDia
 		// draw by pen to xOrigin, y Origin
 		xPen, yPen = rc.drawByBrezenham(savedx0, savedy0, xOrigin, yOrigin, ptsz, col)
-		rc.DrawFilledRectangle(xOrigin, yOrigin, w, h, col)
+		if err := rc.DrawFilledRectangle(xOrigin, yOrigin, w, h, col); err != nil {
+			return err
+		}
 		// move pen back to original x1, y1 setPoint
 		xPen, yPen = rc.drawByBrezenham(xOrigin, yOrigin, savedx1, savedy1, ptsz, col)
 		rc.DrawDonut(savedx1, savedy1, apDia, 0, col)
 		_, _ = xPen, yPen
-		return
+		return nil
 	}
 	// non-orthogonal draw
 	dx := float64(x1 - x0)
@@ -338,14 +456,15 @@ func (rc *Render) DrawByCircleAperture(x0, y0, x1, y1, apDia int, col color.Colo
 	// and final DrawDonut
 	rc.DrawDonut(savedx1, savedy1, apDia, 0, col)
 	_, _ = xPen, yPen
+	return nil
 }
 
-// for aperture flash D03
-//const strat int = 0  // closed rectangles inserted each into other
-const strat int = 1 // zig-zag
-
 // draws a filled rectangle
-func (rc *Render) DrawFilledRectangle(origX, origY, w, h int, col color.Color) {
+// the concentric fill draws the closed rectangles inserted each into other, the hatch fills are drawn by FillPolygon
+func (rc *Render) DrawFilledRectangle(origX, origY, w, h int, col color.Color) error {
+
+	fill := rc.fillParams()
+	step := rc.fillSpacing()
 
 	xPen := origX // real pen position
 	yPen := origY // real pen position
@@ -362,6 +481,11 @@ func (rc *Render) DrawFilledRectangle(origX, origY, w, h int, col color.Color) {
 		rc.drawByBrezenham(x1, y1, x0, y1, 1, rc.ContourColor)
 		rc.drawByBrezenham(x0, y1, x0, y0, 1, rc.ContourColor)
 	}
+	if fill.Strategy == FillHatch || fill.Strategy == FillUnidirectional {
+		rc.FillPolygon(polyclip.Polygon{rectangleContour(float64(origX), float64(origY), float64(w), float64(h))}, col)
+		rc.FilledRctCounter++
+		return nil
+	}
 	x0 = x0 + (rc.PointSizeI / 2)
 	y0 = y0 + (rc.PointSizeI / 2)
 
@@ -380,38 +504,40 @@ func (rc *Render) DrawFilledRectangle(origX, origY, w, h int, col color.Color) {
 	xp := x0
 	yp := y0
 
-	x0 = x0 + rc.PointSizeI
-	y0 = y0 + rc.PointSizeI
-	x1 = x1 - rc.PointSizeI
-	y1 = y1 - rc.PointSizeI
+	x0 = x0 + step
+	y0 = y0 + step
+	x1 = x1 - step
+	y1 = y1 - step
 
 	rc.drawByBrezenham(xp, yp, x0, y0, rc.PointSizeI, col)
 
-	if strat == 0 {
-		for {
+	if fill.Strategy == FillConcentric {
+		for x0 <= x1 && y0 <= y1 {
 			xPen, yPen = rc.drawByBrezenham(x0, y0, x1, y0, rc.PointSizeI, col)
 			xPen, yPen = rc.drawByBrezenham(x1, y0, x1, y1, rc.PointSizeI, col)
 			xPen, yPen = rc.drawByBrezenham(x1, y1, x0, y1, rc.PointSizeI, col)
 			xPen, yPen = rc.drawByBrezenham(x0, y1, x0, y0, rc.PointSizeI, col)
 
-			x0 = x0 + rc.PointSizeI
-			x1 = x1 - rc.PointSizeI
-			y0 = y0 + rc.PointSizeI
-			y1 = y1 - rc.PointSizeI
+			x0 = x0 + step
+			x1 = x1 - step
+			y0 = y0 + step
+			y1 = y1 - step
 
-			if ((x1 - x0) < 0) || ((y1 - y0) < 0) {
-				break
+			if x0 <= x1 && y0 <= y1 {
+				// go to the next rectangle
+				xPen, yPen = rc.drawByBrezenham(xPen, yPen, x0, y0, rc.PointSizeI, col)
 			}
 		}
-	}
-	if strat == 1 {
+		// imitate pen moving to the origin setPoint
+		xPen, yPen = rc.drawByBrezenham(xPen, yPen, origX, origY, rc.PointSizeI, col)
+	} else {
 		if w > h {
 			var tmpY int
 			var retX int
 			for {
 				xPen, yPen = rc.drawByBrezenham(x0, y0, x1, y0, rc.PointSizeI, col)
 				tmpY = y0
-				y0 = y0 + rc.PointSizeI
+				y0 = y0 + step
 				if y0 > y1 {
 					retX = x1
 					break
@@ -419,7 +545,7 @@ func (rc *Render) DrawFilledRectangle(origX, origY, w, h int, col color.Color) {
 				xPen, yPen = rc.drawByBrezenham(x1, tmpY, x1, y0, rc.PointSizeI, col)
 				xPen, yPen = rc.drawByBrezenham(x1, y0, x0, y0, rc.PointSizeI, col)
 				tmpY = y0
-				y0 = y0 + rc.PointSizeI
+				y0 = y0 + step
 				if y0 > y1 {
 					retX = x0
 					break
@@ -434,7 +560,7 @@ func (rc *Render) DrawFilledRectangle(origX, origY, w, h int, col color.Color) {
 			for {
 				xPen, yPen = rc.drawByBrezenham(x0, y0, x0, y1, rc.PointSizeI, col)
 				tmpX = x0
-				x0 = x0 + rc.PointSizeI
+				x0 = x0 + step
 				if x0 > x1 {
 					retY = y1
 					break
@@ -442,7 +568,7 @@ func (rc *Render) DrawFilledRectangle(origX, origY, w, h int, col color.Color) {
 				xPen, yPen = rc.drawByBrezenham(tmpX, y1, x0, y1, rc.PointSizeI, col)
 				xPen, yPen = rc.drawByBrezenham(x0, y1, x0, y0, rc.PointSizeI, col)
 				tmpX = x0
-				x0 = x0 + rc.PointSizeI
+				x0 = x0 + step
 				if x0 > x1 {
 					retY = y0
 					break
@@ -454,11 +580,13 @@ func (rc *Render) DrawFilledRectangle(origX, origY, w, h int, col color.Color) {
 		}
 	}
 	if xPen != origX || yPen != origY {
-		glog.Fatalln("Error during filled rectangle drawing: pen did not returned to the origin setPoint!")
+		return NewGeometryError("pen did not return to the origin point during filled rectangle drawing")
 	}
 	rc.FilledRctCounter++
+	return nil
 }
 
+// the zig-zag and the concentric fills draw the concentric circles, the hatch fills are drawn by FillPolygon
 func (rc *Render) DrawDonut(origX, origY, dia, holeDia int, col color.Color) {
 	// performs DrawDonut (drawCircle) aperture flash
 	radius := dia / 2
@@ -469,10 +597,15 @@ func (rc *Render) DrawDonut(origX, origY, dia, holeDia int, col color.Color) {
 			rc.drawCircle(origX, origY, holeRadius, 1, rc.ContourColor)
 		}
 	}
+	if fill := rc.fillParams(); fill.Strategy == FillHatch || fill.Strategy == FillUnidirectional {
+		rc.FillPolygon(circlePolygon(float64(origX), float64(origY), float64(dia)/2, float64(holeDia)/2), col)
+		return
+	}
+	step := rc.fillSpacing()
 	radius = radius - (rc.PointSizeI / 2)
 	for {
 		rc.drawCircle(origX, origY, radius, rc.PointSizeI, col)
-		radius = radius - rc.PointSizeI
+		radius = radius - step
 		if radius < holeRadius+(rc.PointSizeI/2) {
 			break
 		}
@@ -712,9 +845,11 @@ func (rc *Render) DrawArc(x1, y1, x2, y2, i, j float64, apertureSize int, ipm IP
 
 	if qm == QuadModeSingle {
 		// we have to find the sign of the I and J
-		glog.Fatalln("G74 hook")
-
-		return nil
+		if x1 == x2 && y1 == y2 {
+			// zero length single quadrant arc, nothing to draw
+			return nil
+		}
+		i, j = singleQuadrantOffsets(x1, y1, x2, y2, i, j, ipm)
 	}
 	if rc.DrawContours == true {
 		rc.setPoint(int(x1), int(y1), 1, rc.ContourColor)
@@ -767,11 +902,13 @@ func (rc *Render) DrawArc(x1, y1, x2, y2, i, j float64, apertureSize int, ipm IP
 			plX2 := int(math.Round(x2))
 			plY1 := int(math.Round(y1))
 			plY2 := int(math.Round(y2))
+			plXC := int(math.Round(xC))
+			plYC := int(math.Round(yC))
 			plR := int(math.Round(r))
 			plPhi1 := int(math.Round(Phi1))
 			plPhi2 := int(math.Round(Phi2))
 
-			rc.Plt.Arc(plX1, plY1, plX2, plY2, plR, plPhi1, plPhi2, ipm)
+			rc.Plt.Arc(plX1, plY1, plX2, plY2, plXC, plYC, plR, plPhi1, plPhi2, ipm)
 
 			angle := Phi1
 			for {
@@ -799,11 +936,13 @@ func (rc *Render) DrawArc(x1, y1, x2, y2, i, j float64, apertureSize int, ipm IP
 			plX2 := int(math.Round(x2))
 			plY1 := int(math.Round(y1))
 			plY2 := int(math.Round(y2))
+			plXC := int(math.Round(xC))
+			plYC := int(math.Round(yC))
 			plR := int(math.Round(r))
 			plPhi1 := int(math.Round(Phi1))
 			plPhi2 := int(math.Round(Phi2))
 
-			rc.Plt.Arc(plX1, plY1, plX2, plY2, plR, plPhi1, plPhi2, ipm)
+			rc.Plt.Arc(plX1, plY1, plX2, plY2, plXC, plYC, plR, plPhi1, plPhi2, ipm)
 
 			angle := Phi1
 			for {
@@ -826,24 +965,29 @@ func (rc *Render) DrawArc(x1, y1, x2, y2, i, j float64, apertureSize int, ipm IP
 }
 
 // obround aperture flash
-func (rc *Render) DrawObRound(centerX, centerY, width, height, holeDia int, color color.Color) {
+func (rc *Render) DrawObRound(centerX, centerY, width, height, holeDia int, color color.Color) error {
 	var sideDia int
 	if width > height {
 		sideDia = height
-		rc.DrawFilledRectangle(centerX, centerY, width-sideDia, height, color)
+		if err := rc.DrawFilledRectangle(centerX, centerY, width-sideDia, height, color); err != nil {
+			return err
+		}
 		xd1 := centerX - (width / 2) + (sideDia / 2)
 		xd2 := centerX + (width / 2) - (sideDia / 2)
 		rc.DrawDonut(xd1, centerY, sideDia, holeDia, color)
 		rc.DrawDonut(xd2, centerY, sideDia, holeDia, color)
 	} else {
 		sideDia = width
-		rc.DrawFilledRectangle(centerX, centerY, width, height-sideDia, color)
+		if err := rc.DrawFilledRectangle(centerX, centerY, width, height-sideDia, color); err != nil {
+			return err
+		}
 		yd1 := centerY - (height / 2) + (sideDia / 2)
 		yd2 := centerY + (height / 2) - (sideDia / 2)
 		rc.DrawDonut(centerX, yd1, sideDia, holeDia, color)
 		rc.DrawDonut(centerX, yd2, sideDia, holeDia, color)
 	}
 	rc.ObRoundCounter++
+	return nil
 }
 
 //
@@ -885,17 +1029,32 @@ func (rc *Render) AddStepToPolygon(step *State) int {
 	return len(*rc.PolygonPtr.steps)
 }
 
-func (rc *Render) RenderPolygon() {
+func (rc *Render) RenderPolygon() error {
+	colr := rc.RegionColor
+	if (*rc.PolygonPtr.steps)[0].ApTransParams.Polarity == PolTypeClear {
+		// clear regions are composed by RenderComposite
+		glog.Errorln("Clear region must be rendered by RenderComposite.")
+		colr = rc.ClearColor
+	}
+	return rc.processContours(func(verticesX *[]float64, verticesY *[]float64) error {
+		return rc.RenderOutline(verticesX, verticesY, colr)
+	})
+}
+
+// converts each contour of the polygon being processed to vertices and calls fn
+func (rc *Render) processContours(fn func(*[]float64, *[]float64) error) error {
 	j := 0
 	for j < len(*rc.PolygonPtr.steps) {
 		*rc.PolygonPtr.polX = (*rc.PolygonPtr.polX)[:0]
 		*rc.PolygonPtr.polY = (*rc.PolygonPtr.polY)[:0]
-		if (*rc.PolygonPtr.steps)[0].Action == OpcodeD02_MOVE {
+		if (*rc.PolygonPtr.steps)[j].Action == OpcodeD02_MOVE {
 			j++
 		}
 		for j < len(*rc.PolygonPtr.steps) && (*rc.PolygonPtr.steps)[j].Action != OpcodeD02_MOVE {
 			if (*rc.PolygonPtr.steps)[j].IpMode != IPModeLinear {
-				rc.interpolate((*rc.PolygonPtr.steps)[j])
+				if err := rc.interpolate((*rc.PolygonPtr.steps)[j]); err != nil {
+					return err
+				}
 			} else {
 				xj := ((*rc.PolygonPtr.steps)[j].Coord.GetX() - rc.MinX) / rc.XRes
 				yj := ((*rc.PolygonPtr.steps)[j].Coord.GetY() - rc.MinY) / rc.YRes
@@ -904,33 +1063,75 @@ func (rc *Render) RenderPolygon() {
 			}
 			j++
 		}
-		colr := rc.RegionColor
-		if (*rc.PolygonPtr.steps)[0].ApTransParams.Polarity == PolTypeClear {
-			glog.Errorln("Clear polarity is not supported yet.")
-			colr = rc.ClearColor
+		if len(*rc.PolygonPtr.polX) > 2 {
+			if err := fn(rc.PolygonPtr.polX, rc.PolygonPtr.polY); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+/*
+in the single quadrant mode (G74) I and J are unsigned, the signs are chosen so
+that the arc is not greater than 90 degrees in the direction of the interpolation and
+the distances from the center to the start and to the end points are the closest
+*/
+func singleQuadrantOffsets(x1, y1, x2, y2, i, j float64, ipm IPmode) (float64, float64) {
+	i = math.Abs(i)
+	j = math.Abs(j)
+	bestI, bestJ := i, j
+	bestErr := math.Inf(1)
+	bestFits := false
+	for _, sign := range [4][2]float64{{1, 1}, {-1, 1}, {-1, -1}, {1, -1}} {
+		xc := x1 + sign[0]*i
+		yc := y1 + sign[1]*j
+		phi1 := math.Atan2(y1-yc, x1-xc)
+		phi2 := math.Atan2(y2-yc, x2-xc)
+		sweep := phi2 - phi1
+		if ipm == IPModeCwC {
+			sweep = -sweep
+		}
+		if sweep < 0 {
+			sweep += 2 * math.Pi
+		}
+		fits := sweep <= math.Pi/2+1e-6
+		rErr := math.Abs(math.Hypot(x2-xc, y2-yc) - math.Hypot(x1-xc, y1-yc))
+		// the candidate with the arc not greater than 90 degrees always wins
+		if (fits && !bestFits) || (fits == bestFits && rErr < bestErr) {
+			bestI, bestJ = sign[0]*i, sign[1]*j
+			bestErr = rErr
+			bestFits = fits
 		}
-		rc.RenderOutline(rc.PolygonPtr.polX, rc.PolygonPtr.polY, colr)
 	}
-	return
+	return bestI, bestJ
 }
 
 /*
 interpolate circle by straight lines
 */
-func (rc *Render) interpolate(st *State) {
+func (rc *Render) interpolate(st *State) error {
 	var xc, yc float64 // DrawArc center coordinates in mm
+	i := st.Coord.GetI()
+	j := st.Coord.GetJ()
 	if st.QMode == QuadModeSingle {
 		// we have to find the sign of the I and J
-		glog.Fatalln("G74 hook")
+		if st.PrevCoord.GetX() == st.Coord.GetX() && st.PrevCoord.GetY() == st.Coord.GetY() {
+			// zero length single quadrant arc
+			rc.addToCorners(st.Coord.GetX(), st.Coord.GetY())
+			return nil
+		}
+		i, j = singleQuadrantOffsets(st.PrevCoord.GetX(), st.PrevCoord.GetY(),
+			st.Coord.GetX(), st.Coord.GetY(), i, j, st.IpMode)
 	}
-	xc = st.PrevCoord.GetX() + st.Coord.GetI()
-	yc = st.PrevCoord.GetY() + st.Coord.GetJ()
-	r := math.Hypot(st.Coord.GetI(), st.Coord.GetJ())
+	xc = st.PrevCoord.GetX() + i
+	yc = st.PrevCoord.GetY() + j
+	r := math.Hypot(i, j)
 	rt := math.Hypot(st.Coord.GetX()-xc, st.Coord.GetY()-yc)
 	dr := rt - r
 
 	if math.Abs(dr) > rc.PointSize {
-		glog.Fatalln("(rc *Render) interpolate(): Deviation more than pointSize.", "G75 diff.=", rt-r)
+		return NewGeometryError(fmt.Sprintf("arc deviation is more than the point size, G75 diff.= %f", rt-r))
 	}
 	r = (r + rt) / 2
 
@@ -977,9 +1178,9 @@ func (rc *Render) interpolate(st *State) {
 			}
 		}
 	} else {
-		glog.Fatalln("(rc *Render) interpolate(): Bad IpMode.")
+		return NewUnsupportedFeatureError("interpolation mode " + st.IpMode.String())
 	}
-
+	return nil
 }
 
 func (rc *Render) addToCorners(ax, ay float64) (float64, bool) {
@@ -1014,74 +1215,17 @@ func transformFloatCoord(inc float64, res float64) float64 {
 // renders an outline (a.k.a. polygon).
 // edges are straight lines
 // coordinates are pixels of rc.Img but in float64
-func (rc *Render) RenderOutline(verticesX *[]float64, verticesY *[]float64, colr color.RGBA) {
+func (rc *Render) RenderOutline(verticesX *[]float64, verticesY *[]float64, colr color.RGBA) error {
 
 	if len(*verticesX) != len(*verticesY) {
-		glog.Fatalln("(rc *Render) RenderOutline() : vertices arrays lengths are different")
-	}
-	numVertices := len(*verticesX)
-	minY := (*verticesY)[0]
-	maxY := (*verticesY)[0]
-	for _, y := range *verticesY {
-		if y > maxY {
-			maxY = y
-		}
-		if y < minY {
-			minY = y
-		}
+		return NewGeometryError("outline vertices arrays lengths are different")
 	}
-
-	var nodes = 0
-	var nodeX []int
-	nodeX = make([]int, numVertices)
-	var pixelY int
-
-	// take into account real plotter pen setPoint size
-	marginX := rc.PointSize / 2
-	marginXI := int(math.Round(marginX))
-	startY := int(math.Round(minY + marginX))
-	stopY := int(math.Round(maxY - marginX))
-
-	// fill the inner points of the polygon
-	var i = 0
-
-	for pixelY = startY; pixelY < stopY; pixelY += rc.PointSizeI {
-		fPixelY := float64(pixelY)
-		nodes = 0
-		j := numVertices - 1
-		for i = 0; i < numVertices; i++ {
-			if ((*verticesY)[i] < fPixelY && (*verticesY)[j] >= fPixelY) ||
-				((*verticesY)[j] < fPixelY && (*verticesY)[i] >= fPixelY) {
-
-				nodeX[nodes] = int(math.Round((*verticesX)[i] + (fPixelY-(*verticesY)[i])/
-					((*verticesY)[j]-(*verticesY)[i])*((*verticesX)[j]-(*verticesX)[i])))
-
-				nodes++
-			}
-			j = i
-		}
-		i = 0
-		for {
-			if i < nodes-1 {
-				if nodeX[i] > nodeX[i+1] {
-					nodeX[i], nodeX[i+1] = nodeX[i+1], nodeX[i]
-					if i != 0 {
-						i--
-					}
-				} else {
-					i++
-				}
-			} else {
-				break
-			}
-		}
-		//  Fill the pixels between node pairs.
-		for i = 0; i < nodes; i += 2 {
-			rc.drawByBrezenham(nodeX[i]+marginXI, pixelY, nodeX[i+1]-marginXI, pixelY, rc.PointSizeI, colr)
-			rc.Plt.DrawLine(nodeX[i]+marginXI, pixelY, nodeX[i+1]-marginXI, pixelY)
-		}
+	outline := make(polyclip.Contour, len(*verticesX))
+	for i := range outline {
+		outline[i] = polyclip.Point{X: (*verticesX)[i], Y: (*verticesY)[i]}
 	}
-	return
+	rc.FillPolygon(polyclip.Polygon{outline}, colr)
+	return nil
 }
 
 // ################################### EOF ###############################################
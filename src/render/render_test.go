@@ -0,0 +1,34 @@
+package render
+
+import (
+	"math"
+	"testing"
+
+	. "gerberbasetypes"
+)
+
+func TestSingleQuadrantOffsets(t *testing.T) {
+	testData := []struct {
+		x1, y1, x2, y2 float64
+		i, j           float64
+		ipm            IPmode
+		expI, expJ     float64
+	}{
+		// quarter of the circle with the center at 0,0
+		{1, 0, 0, 1, 1, 0, IPModeCCwC, -1, 0},
+		{0, 1, 1, 0, 0, 1, IPModeCwC, 0, -1},
+		{-1, 0, 0, -1, 1, 0, IPModeCCwC, 1, 0},
+		{0, -1, -1, 0, 0, 1, IPModeCwC, 0, 1},
+		// the arc with the center at 10,10
+		{13, 14, 14, 13, 3, 4, IPModeCwC, -3, -4},
+		{14, 13, 13, 14, 4, 3, IPModeCCwC, -4, -3},
+		// the signs in the input must be ignored
+		{13, 14, 14, 13, -3, 4, IPModeCwC, -3, -4},
+	}
+	for _, td := range testData {
+		i, j := singleQuadrantOffsets(td.x1, td.y1, td.x2, td.y2, td.i, td.j, td.ipm)
+		if math.Abs(i-td.expI) > 1e-9 || math.Abs(j-td.expJ) > 1e-9 {
+			t.Error("expected", td.expI, td.expJ, "got", i, j)
+		}
+	}
+}
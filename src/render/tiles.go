@@ -0,0 +1,79 @@
+/*
+################################## Tiles ######################################
+The board bigger than the plotter working area is plotted on several overlapping sheets.
+The sheets are aligned by the registration marks drawn in the overlap zones,
+each mark is plotted on all the sheets it belongs to.
+*/
+package render
+
+import (
+	"math"
+)
+
+// the part of the drawing plotted on one sheet
+type Tile struct {
+	// the position of the sheet, counted from 1 from the lower left one
+	Column, Row int
+	// the window of the drawing, plotter steps
+	X, Y, Width, Height int
+}
+
+// returns the number of the sheets of the size with the overlap needed to cover the size
+func tileCount(size, sheet, overlap int) int {
+	if size <= sheet {
+		return 1
+	}
+	return 1 + int(math.Ceil(float64(size-sheet)/float64(sheet-overlap)))
+}
+
+// returns the sheets covering the drawing in the plotting order, row by row from the lower left one
+func (rc *Render) Tiles() []Tile {
+	w, h := rc.Extents()
+	sheetW, sheetH := transformCoord(rc.CanvasWidth, rc.XRes), transformCoord(rc.CanvasHeight, rc.YRes)
+	overlapX, overlapY := transformCoord(rc.TileOverlap, rc.XRes), transformCoord(rc.TileOverlap, rc.YRes)
+	columns := tileCount(w, sheetW, overlapX)
+	rows := tileCount(h, sheetH, overlapY)
+	retVal := make([]Tile, 0, columns*rows)
+	for row := 0; row < rows; row++ {
+		for column := 0; column < columns; column++ {
+			retVal = append(retVal, Tile{Column: column + 1, Row: row + 1,
+				X: column * (sheetW - overlapX), Y: row * (sheetH - overlapY), Width: sheetW, Height: sheetH})
+		}
+	}
+	return retVal
+}
+
+/*
+Returns the centers of the registration marks, plotter steps.
+Two marks are placed in the middle of the overlap zone of each pair of the adjacent sheets,
+at the quarters of the part of the zone covered by the drawing.
+*/
+func (rc *Render) RegistrationMarks(tiles []Tile) [][2]int {
+	w, h := rc.Extents()
+	overlapX, overlapY := transformCoord(rc.TileOverlap, rc.XRes), transformCoord(rc.TileOverlap, rc.YRes)
+	retVal := make([][2]int, 0)
+	for i := range tiles {
+		for j := range tiles {
+			a, b := &tiles[i], &tiles[j]
+			if a.Row == b.Row && a.Column+1 == b.Column {
+				y0, y1 := a.Y, minInt(a.Y+a.Height, h)
+				x := b.X + overlapX/2
+				retVal = append(retVal, [2]int{x, y0 + (y1-y0)/4}, [2]int{x, y1 - (y1-y0)/4})
+			}
+			if a.Column == b.Column && a.Row+1 == b.Row {
+				x0, x1 := a.X, minInt(a.X+a.Width, w)
+				y := b.Y + overlapY/2
+				retVal = append(retVal, [2]int{x0 + (x1-x0)/4, y}, [2]int{x1 - (x1-x0)/4, y})
+			}
+		}
+	}
+	return retVal
+}
+
+// draws the registration marks of the sheets: the cross in the circle
+func (rc *Render) DrawRegistrationMarks(tiles []Tile) {
+	r := transformCoord(rc.TileMarkSize/2, rc.XRes)
+	for _, m := range rc.RegistrationMarks(tiles) {
+		rc.drawCrosshair(m[0], m[1], r)
+	}
+}
@@ -0,0 +1,47 @@
+package render
+
+import (
+	"testing"
+)
+
+func TestTiles(t *testing.T) {
+	rc := new(Render)
+	rc.XRes = 0.1
+	rc.YRes = 0.1
+	rc.CanvasWidth = 100
+	rc.CanvasHeight = 50
+	rc.TileOverlap = 10
+	// the drawing fits the sheet
+	rc.MinX, rc.MinY = 0, 0
+	rc.MaxX, rc.MaxY = 100, 50
+	if tiles := rc.Tiles(); len(tiles) != 1 || len(rc.RegistrationMarks(tiles)) != 0 {
+		t.Fatal("expected one sheet without marks, got", tiles)
+	}
+
+	// 2 columns, 3 rows
+	rc.MaxX, rc.MaxY = 150, 120
+	tiles := rc.Tiles()
+	if len(tiles) != 6 {
+		t.Fatal("expected 6 sheets, got", tiles)
+	}
+	last := tiles[5]
+	if last.Column != 2 || last.Row != 3 || last.X != 900 || last.Y != 800 || last.Width != 1000 || last.Height != 500 {
+		t.Error("bad last sheet", last)
+	}
+	// the marks are in the overlap zones of both sheets
+	marks := rc.RegistrationMarks(tiles)
+	if len(marks) != 2*(3+2*2) {
+		t.Fatal("expected 14 marks, got", len(marks))
+	}
+	for _, m := range marks {
+		n := 0
+		for _, tile := range tiles {
+			if m[0] >= tile.X && m[0] <= tile.X+tile.Width && m[1] >= tile.Y && m[1] <= tile.Y+tile.Height {
+				n++
+			}
+		}
+		if n < 2 {
+			t.Error("the mark", m, "is on", n, "sheets")
+		}
+	}
+}
@@ -0,0 +1,116 @@
+/*
+################################## Title ######################################
+The title block identifies the plot: the file name, the layer, the date, the scale,
+the pens and the revision. It is plotted under the bottom margin of the board
+by the stroke font, the drawing is expanded to hold it.
+*/
+package render
+
+import (
+	"configurator"
+	"errors"
+	"github.com/spf13/viper"
+	"strings"
+	"time"
+)
+
+type TitleBlock struct {
+	// the name of the input
+	Name string
+	// the function of the file (%TF.FileFunction), empty if unknown
+	Layer string
+	Date  time.Time
+	// the scale of the board
+	Scale    float64
+	Revision string
+	// the height of the capitals, mm
+	TextHeight float64
+	// the sizes of the pens drawing the board, mm, they are set by the render
+	PenSizes []float64
+}
+
+// reads the title block settings, returns nil if the title block is off
+func NewTitleBlock(v *viper.Viper, name, layer string, date time.Time, scale float64) (*TitleBlock, error) {
+	if v.GetBool(configurator.CfgTitleEnable) == false {
+		return nil, nil
+	}
+	retVal := &TitleBlock{Name: name, Layer: layer, Date: date, Scale: scale}
+	retVal.Revision = v.GetString(configurator.CfgTitleRevision)
+	retVal.TextHeight = v.GetFloat64(configurator.CfgTitleTextHeight)
+	if retVal.TextHeight <= 0 {
+		return nil, errors.New(configurator.CfgTitleTextHeight + " must be positive")
+	}
+	return retVal, nil
+}
+
+// returns the lines of the left and the right columns
+func (t *TitleBlock) columns() ([]string, []string) {
+	left := make([]string, 0, 3)
+	if len(t.Name) > 0 {
+		left = append(left, t.Name)
+	}
+	if len(t.Layer) > 0 {
+		left = append(left, t.Layer)
+	}
+	left = append(left, t.Date.Format("2006-01-02"))
+	right := []string{"SCALE " + formatMM(t.Scale)}
+	if len(t.PenSizes) > 0 {
+		pens := make([]string, len(t.PenSizes))
+		for i, size := range t.PenSizes {
+			pens[i] = formatMM(size)
+		}
+		right = append(right, "PEN "+strings.Join(pens, "/")+" MM")
+	}
+	if len(t.Revision) > 0 {
+		right = append(right, "REV "+t.Revision)
+	}
+	return left, right
+}
+
+// returns the width of the widest line, mm
+func columnWidth(lines []string, height float64) float64 {
+	retVal := 0.0
+	for _, line := range lines {
+		if w := textWidth(line, height); w > retVal {
+			retVal = w
+		}
+	}
+	return retVal
+}
+
+// returns the size of the block, mm: the lines are spaced by the half of the text height,
+// the text is padded by the text height from the frame and from the line between the columns
+func (t *TitleBlock) Size() (float64, float64) {
+	h := t.TextHeight
+	left, right := t.columns()
+	rows := len(left)
+	if len(right) > rows {
+		rows = len(right)
+	}
+	width := columnWidth(left, h) + columnWidth(right, h) + 4*h
+	height := float64(rows)*h + float64(rows-1)*h/2 + 2*h
+	return width, height
+}
+
+// draws the block in the lower left corner of the drawing
+func (rc *Render) DrawTitle() {
+	t := rc.Title
+	h := t.TextHeight
+	width, height := t.Size()
+	w, ht := transformCoord(width, rc.XRes), transformCoord(height, rc.YRes)
+	rc.drawByBrezenham(0, 0, w, 0, rc.PointSizeI, rc.MarkColor)
+	rc.drawByBrezenham(w, 0, w, ht, rc.PointSizeI, rc.MarkColor)
+	rc.drawByBrezenham(w, ht, 0, ht, rc.PointSizeI, rc.MarkColor)
+	rc.drawByBrezenham(0, ht, 0, 0, rc.PointSizeI, rc.MarkColor)
+	left, right := t.columns()
+	divider := columnWidth(left, h) + 2*h
+	xd := transformCoord(divider, rc.XRes)
+	rc.drawByBrezenham(xd, 0, xd, ht, rc.PointSizeI, rc.MarkColor)
+	for column, lines := range [][]string{left, right} {
+		x := transformCoord(h+float64(column)*divider, rc.XRes)
+		for i, line := range lines {
+			y := transformCoord(height-2*h-float64(i)*1.5*h, rc.YRes)
+			rc.DrawText(x, y, line, h)
+		}
+	}
+}
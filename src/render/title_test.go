@@ -0,0 +1,68 @@
+package render
+
+import (
+	"configurator"
+	"github.com/spf13/viper"
+	"io/ioutil"
+	"plotter"
+	"testing"
+	"time"
+)
+
+func TestTitleBlock(t *testing.T) {
+	v := viper.New()
+	configurator.SetDefaults(v)
+	date := time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC)
+	if title, err := NewTitleBlock(v, "board.gbr", "", date, 1); title != nil || err != nil {
+		t.Fatal("the title block is on by default", title, err)
+	}
+	v.Set(configurator.CfgTitleEnable, true)
+	v.Set(configurator.CfgTitleRevision, "B")
+	title, err := NewTitleBlock(v, "board.gbr", "Copper,L1,Top", date, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	title.PenSizes = []float64{0.3, 0.5}
+	left, right := title.columns()
+	expLeft := []string{"board.gbr", "Copper,L1,Top", "2026-10-17"}
+	expRight := []string{"SCALE 2", "PEN 0.3/0.5 MM", "REV B"}
+	for i := range expLeft {
+		if left[i] != expLeft[i] || right[i] != expRight[i] {
+			t.Fatal("expected", expLeft, expRight, "got", left, right)
+		}
+	}
+	// 3 rows of 2.5 mm spaced by 1.25 mm and padded by 2.5 mm
+	if _, h := title.Size(); h != 15 {
+		t.Error("expected the height 15, got", h)
+	}
+	v.Set(configurator.CfgTitleTextHeight, 0)
+	if _, err := NewTitleBlock(v, "board.gbr", "", date, 1); err == nil {
+		t.Error("the zero text height is accepted")
+	}
+}
+
+func TestTitleSpace(t *testing.T) {
+	v := viper.New()
+	configurator.SetDefaults(v)
+	v.Set(configurator.CfgTitleEnable, true)
+	rc := new(Render)
+	var err error
+	if rc.Title, err = NewTitleBlock(v, "board.gbr", "", time.Now(), 1); err != nil {
+		t.Fatal(err)
+	}
+	// the board is narrower than the title block
+	if err := rc.Init(plotter.NewPlotter(ioutil.Discard), v, 0, 0, 5, 5); err != nil {
+		t.Fatal(err)
+	}
+	width, height := rc.Title.Size()
+	if len(rc.Title.PenSizes) != 1 {
+		t.Error("expected one pen, got", rc.Title.PenSizes)
+	}
+	x0, y0, x1, y1 := rc.boardExtents()
+	if x0 != 10 || near(y0, 10+height) == false || near(x1, 15) == false || near(y1, 15+height) == false {
+		t.Error("bad board extents", x0, y0, x1, y1)
+	}
+	if near(rc.MaxX-rc.MinX, width) == false || near(rc.MaxY-rc.MinY, 25+height) == false {
+		t.Error("the drawing does not hold the title block", rc.MaxX-rc.MinX, rc.MaxY-rc.MinY)
+	}
+}
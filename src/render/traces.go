@@ -0,0 +1,200 @@
+/*
+Draws the connected D01 segments of a round or a rectangle aperture as one trace,
+the straight and the circular segments are chained alike.
+The draws of the other apertures are rendered step by step.
+*/
+package render
+
+import (
+	. "gerberbasetypes"
+	"github.com/akavel/polyclip-go"
+	"image/color"
+	"math"
+)
+
+// returns true if the step draws a line or an arc by the round or the rectangle aperture
+func traceStep(step *State) bool {
+	return step.Region == nil &&
+		step.Action == OpcodeD01_DRAW &&
+		(step.IpMode == IPModeLinear || step.IpMode == IPModeCwC || step.IpMode == IPModeCCwC) &&
+		step.CurrentAp != nil &&
+		(step.CurrentAp.Type == AptypeCircle || step.CurrentAp.Type == AptypeRectangle) &&
+		step.ApTransParams.Polarity == PolTypeDark
+}
+
+// returns the number of the leading steps which draw one trace, 0 if the first step does not draw a trace
+func TraceLength(steps []*State) int {
+	if len(steps) == 0 || traceStep(steps[0]) == false {
+		return 0
+	}
+	n := 1
+	for n < len(steps) {
+		step := steps[n]
+		if traceStep(step) == false ||
+			step.CurrentAp != steps[0].CurrentAp ||
+			step.ApTransParams != steps[0].ApTransParams ||
+			step.PrevCoord == nil ||
+			step.PrevCoord.GetX() != steps[n-1].Coord.GetX() ||
+			step.PrevCoord.GetY() != steps[n-1].Coord.GetY() {
+			break
+		}
+		n++
+	}
+	return n
+}
+
+/*
+Renders the trace drawn by the steps (see TraceLength).
+The center line is drawn first, then the trace outlines from the inner one to the outer one,
+the outlines are the unions of the segments drawn by the smaller apertures, so the joins and the ends
+have the shape of the aperture.
+The pen goes from one outline to the next one without lifting.
+*/
+func (rc *Render) RenderTrace(steps []*State) error {
+	if rc.DrawOnlyRegionsMode == true {
+		return nil
+	}
+	col := rc.LineColor
+	ap := steps[0].CurrentAp
+	pen := float64(rc.PointSizeI)
+	if pen < 1 {
+		pen = 1
+	}
+	reach := (transformFloatCoord(ap.Diameter*steps[0].ApTransParams.Scale, rc.XRes) - pen) / 2
+	if ap.Type == AptypeRectangle {
+		if transformFloatCoord(math.Min(ap.XSize, ap.YSize)*steps[0].ApTransParams.Scale, rc.XRes) <= pen {
+			// the rectangle is narrower than the pen, it has no outlines to chain
+			for _, step := range steps {
+				if err := step.Render(rc); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		reach = (transformFloatCoord(math.Max(ap.XSize, ap.YSize)*steps[0].ApTransParams.Scale, rc.XRes) - pen) / 2
+	}
+
+	// the center line
+	path := rc.tracePath(steps)
+	x, y := int(path[0].X), int(path[0].Y)
+	for _, p := range path[1:] {
+		rc.drawByBrezenham(x, y, int(p.X), int(p.Y), rc.PointSizeI, col)
+		x, y = int(p.X), int(p.Y)
+	}
+
+	if reach <= 0 {
+		return nil
+	}
+	// the neighbour outlines overlap by a step to hide the rounding of the vertices
+	spacing := pen - 1
+	if spacing < 1 {
+		spacing = 1
+	}
+	n := int(math.Ceil(reach / spacing))
+	maxJump := 2*reach/float64(n) + 1
+	for i := 1; i <= n; i++ {
+		// the outlines are drawn by the apertures growing to the one less the pen width,
+		// the sides of the rectangle grow together, so the inner outline is small in both directions
+		outline := rc.traceOutline(steps, float64(i)/float64(n), pen)
+		drawn := make([]bool, len(outline))
+		for range outline {
+			// the nearest outline is drawn next
+			best, bestK := -1, 0
+			bestDist := math.Inf(1)
+			for c := range outline {
+				if drawn[c] == true {
+					continue
+				}
+				for k := range outline[c] {
+					d := math.Hypot(outline[c][k].X-float64(x), outline[c][k].Y-float64(y))
+					if d < bestDist {
+						best, bestK, bestDist = c, k, d
+					}
+				}
+			}
+			drawn[best] = true
+			x, y = rc.drawClosedContour(x, y, outline[best], bestK, bestDist <= maxJump, col)
+		}
+	}
+	return nil
+}
+
+// returns the center line of the trace in pixels, the arcs are replaced by their chords
+func (rc *Render) tracePath(steps []*State) []polyclip.Point {
+	var x0, y0 float64
+	if steps[0].PrevCoord != nil {
+		x0, y0 = steps[0].PrevCoord.GetX(), steps[0].PrevCoord.GetY()
+	}
+	pixel := func(x, y float64) polyclip.Point {
+		return polyclip.Point{X: float64(transformCoord(x-rc.MinX, rc.XRes)), Y: float64(transformCoord(y-rc.MinY, rc.YRes))}
+	}
+	path := []polyclip.Point{pixel(x0, y0)}
+	for _, step := range steps {
+		end := pixel(step.Coord.GetX(), step.Coord.GetY())
+		if step.IpMode != IPModeLinear {
+			xp := transformFloatCoord(x0-rc.MinX, rc.XRes)
+			yp := transformFloatCoord(y0-rc.MinY, rc.YRes)
+			xc := transformFloatCoord(step.Coord.GetX()-rc.MinX, rc.XRes)
+			yc := transformFloatCoord(step.Coord.GetY()-rc.MinY, rc.YRes)
+			if cx, cy, r, phi0, sweep, ok := step.arcCircle(rc, xp, yp, xc, yc); ok == true {
+				pts := arcPoints(cx, cy, r, phi0, sweep)
+				for _, p := range pts[1 : len(pts)-1] {
+					p = polyclip.Point{X: math.Round(p.X), Y: math.Round(p.Y)}
+					if p != path[len(path)-1] {
+						path = append(path, p)
+					}
+				}
+			}
+		}
+		if end != path[len(path)-1] {
+			path = append(path, end)
+		}
+		x0, y0 = step.Coord.GetX(), step.Coord.GetY()
+	}
+	return path
+}
+
+// returns the outline of the trace drawn by the part t of its aperture less the pen width:
+// the union of the shapes of the segments, the neighbour segments share the ends, so each merge is checked
+func (rc *Render) traceOutline(steps []*State, t, pen float64) polyclip.Polygon {
+	segments := make([]polyclip.Polygon, 0, len(steps))
+	for _, step := range steps {
+		segments = append(segments, step.traceBrush(t, pen, rc).Contours(rc))
+	}
+	return checkedUnionAll(segments)
+}
+
+// returns the copy of the step drawing by the part t of its aperture less the pen width (pixels)
+func (step *State) traceBrush(t, pen float64, rc *Render) *State {
+	ap := *step.CurrentAp
+	scale := step.ApTransParams.Scale
+	ap.Diameter = (ap.Diameter - pen*rc.XRes/scale) * t
+	ap.XSize = (ap.XSize - pen*rc.XRes/scale) * t
+	ap.YSize = (ap.YSize - pen*rc.YRes/scale) * t
+	retVal := *step
+	retVal.CurrentAp = &ap
+	return &retVal
+}
+
+// draws the contour from its vertex k, the pen is lowered at x, y if join is true
+func (rc *Render) drawClosedContour(x, y int, c polyclip.Contour, k int, join bool, col color.Color) (int, int) {
+	x0, y0 := int(math.Round(c[k].X)), int(math.Round(c[k].Y))
+	if join == true {
+		if x != x0 || y != y0 {
+			rc.drawByBrezenham(x, y, x0, y0, rc.PointSizeI, col)
+		}
+	} else {
+		rc.MovePen(x, y, x0, y0, rc.MovePenColor)
+	}
+	x, y = x0, y0
+	for j := 1; j <= len(c); j++ {
+		p := c[(k+j)%len(c)]
+		px, py := int(math.Round(p.X)), int(math.Round(p.Y))
+		if px == x && py == y {
+			continue
+		}
+		rc.drawByBrezenham(x, y, px, py, rc.PointSizeI, col)
+		x, y = px, py
+	}
+	return x, y
+}
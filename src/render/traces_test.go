@@ -0,0 +1,196 @@
+package render
+
+import (
+	"bytes"
+	"emsim"
+	. "gerberbasetypes"
+	"image"
+	"image/color"
+	"math"
+	"plotter"
+	"strings"
+	"testing"
+	. "xy"
+)
+
+// returns the D01 step drawn by the aperture from x0, y0 to x1, y1 (mm)
+func traceTestStep(ap *Aperture, x0, y0, x1, y1 float64) *State {
+	step := NewState()
+	step.Action = OpcodeD01_DRAW
+	step.IpMode = IPModeLinear
+	step.CurrentAp = ap
+	step.ApTransParams = ApTransParameters{Polarity: PolTypeDark, Scale: 1}
+	step.PrevCoord = NewXY()
+	step.PrevCoord.SetX(x0)
+	step.PrevCoord.SetY(y0)
+	step.Coord = NewXY()
+	step.Coord.SetX(x1)
+	step.Coord.SetY(y1)
+	return step
+}
+
+func TestRenderTrace(t *testing.T) {
+	ap := &Aperture{Type: AptypeCircle, Diameter: 1.0}
+	other := &Aperture{Type: AptypeCircle, Diameter: 0.5}
+	steps := []*State{
+		traceTestStep(ap, 1, 1, 4, 1),
+		traceTestStep(ap, 4, 1, 4, 4),
+		traceTestStep(ap, 4, 4, 1, 4),
+		traceTestStep(other, 1, 4, 1, 1),
+	}
+	if n := TraceLength(steps); n != 3 {
+		t.Fatal("expected the trace of 3 steps, got", n)
+	}
+	steps[1].PrevCoord.SetX(3)
+	if n := TraceLength(steps); n != 1 {
+		t.Error("the disconnected step is added to the trace")
+	}
+	steps[1].PrevCoord.SetX(4)
+
+	out := new(bytes.Buffer)
+	rc := new(Render)
+	rc.XRes = 0.025
+	rc.YRes = 0.025
+	rc.PointSize = 4.0
+	rc.PointSizeI = 4
+	rc.Plt = plotter.NewPlotter(out)
+	rc.Img = image.NewNRGBA(image.Rect(0, 0, 200, 200))
+	rc.LineColor = color.RGBA{0, 0, 255, 255}
+	rc.Plt.Start()
+	rc.Plt.TakePen(1)
+	if err := rc.RenderTrace(steps[:3]); err != nil {
+		t.Fatal(err)
+	}
+	rc.Plt.Stop()
+	// the pen is lifted only to come to the trace
+	if n := strings.Count(out.String(), "MA "); n != 1 {
+		t.Errorf("expected 1 move, got %d\n%s", n, out.String())
+	}
+	if strings.Contains(out.String(), "D C") == true {
+		t.Error("the ends are drawn by circles")
+	}
+	// the trace drawn by the device is 40 pixels wide, its center line is 40,40 - 160,40 - 160,160 - 40,160
+	sim := emsim.NewSimulator(200, 200, []int{4})
+	if err := sim.Run(out); err != nil {
+		t.Fatal(err)
+	}
+	img := sim.Image()
+	height := img.Bounds().Dy()
+	dist := func(x, y float64) float64 {
+		d := math.Inf(1)
+		for _, s := range [][4]float64{{40, 40, 160, 40}, {160, 40, 160, 160}, {160, 160, 40, 160}} {
+			px := math.Max(math.Min(x, math.Max(s[0], s[2])), math.Min(s[0], s[2]))
+			py := math.Max(math.Min(y, math.Max(s[1], s[3])), math.Min(s[1], s[3]))
+			d = math.Min(d, math.Hypot(x-px, y-py))
+		}
+		return d
+	}
+	for x := 0; x < img.Bounds().Dx(); x++ {
+		for y := 0; y < height; y++ {
+			inked := img.NRGBAAt(x, height-1-y).R == 0
+			d := dist(float64(x), float64(y))
+			if d < 19 && inked == false {
+				t.Fatal("the trace is not filled at", x, y)
+			}
+			if d > 22 && inked == true {
+				t.Fatal("the pen is out of the trace at", x, y)
+			}
+		}
+	}
+}
+
+// renders the trace by the 4 pixel pen on the 200 x 200 image, returns the plot and the image drawn by the device
+func renderTestTrace(t *testing.T, steps []*State) (string, *image.NRGBA) {
+	out := new(bytes.Buffer)
+	rc := new(Render)
+	rc.XRes = 0.025
+	rc.YRes = 0.025
+	rc.PointSize = 4.0
+	rc.PointSizeI = 4
+	rc.Plt = plotter.NewPlotter(out)
+	rc.Img = image.NewNRGBA(image.Rect(0, 0, 200, 200))
+	rc.LineColor = color.RGBA{0, 0, 255, 255}
+	rc.Plt.Start()
+	rc.Plt.TakePen(1)
+	if err := rc.RenderTrace(steps); err != nil {
+		t.Fatal(err)
+	}
+	rc.Plt.Stop()
+	plt := out.String()
+	sim := emsim.NewSimulator(200, 200, []int{4})
+	if err := sim.Run(out); err != nil {
+		t.Fatal(err)
+	}
+	return plt, sim.Image()
+}
+
+// checks the image against the shape, the point is inside if inside(x, y) is less than 0,
+// the edge tolerance is tol pixels
+func checkTestTrace(t *testing.T, img *image.NRGBA, inside func(x, y float64) float64, tol float64) {
+	height := img.Bounds().Dy()
+	for x := 0; x < img.Bounds().Dx(); x++ {
+		for y := 0; y < height; y++ {
+			inked := img.NRGBAAt(x, height-1-y).R == 0
+			d := inside(float64(x), float64(y))
+			if d < -tol && inked == false {
+				t.Fatal("the trace is not filled at", x, y)
+			}
+			if d > tol && inked == true {
+				t.Fatal("the pen is out of the trace at", x, y)
+			}
+		}
+	}
+}
+
+func TestRenderTraceRectangle(t *testing.T) {
+	ap := &Aperture{Type: AptypeRectangle, XSize: 1.0, YSize: 0.5}
+	steps := []*State{
+		traceTestStep(ap, 1, 1, 4, 1),
+		traceTestStep(ap, 4, 1, 4, 4),
+	}
+	if n := TraceLength(steps); n != 2 {
+		t.Fatal("expected the trace of 2 steps, got", n)
+	}
+	plt, img := renderTestTrace(t, steps)
+	if n := strings.Count(plt, "MA "); n != 1 {
+		t.Errorf("expected 1 move, got %d\n%s", n, plt)
+	}
+	// the rectangle 40 x 20 pixels goes from 40,40 to 160,40 and to 160,160
+	box := func(x, y, x0, y0, x1, y1 float64) float64 {
+		return math.Max(math.Max(x0-x, x-x1), math.Max(y0-y, y-y1))
+	}
+	checkTestTrace(t, img, func(x, y float64) float64 {
+		return math.Min(box(x, y, 20, 30, 180, 50), box(x, y, 140, 30, 180, 170))
+	}, 2)
+}
+
+func TestRenderTraceArc(t *testing.T) {
+	ap := &Aperture{Type: AptypeCircle, Diameter: 1.0}
+	// the arc of 270 degrees
+	arc := traceTestStep(ap, 3, 1, 4, 2)
+	arc.IpMode = IPModeCwC
+	arc.QMode = QuadModeMulti
+	arc.Coord.SetI(0)
+	arc.Coord.SetJ(1)
+	steps := []*State{
+		traceTestStep(ap, 1, 1, 3, 1),
+		arc,
+		traceTestStep(ap, 4, 2, 4, 4),
+	}
+	if n := TraceLength(steps); n != 3 {
+		t.Fatal("expected the trace of 3 steps, got", n)
+	}
+	plt, img := renderTestTrace(t, steps)
+	if n := strings.Count(plt, "MA "); n != 1 {
+		t.Errorf("expected 1 move, got %d\n%s", n, plt)
+	}
+	// the center line is 40,40 - 120,40, the arc around 120,80 and 160,80 - 160,160, the trace is 40 pixels wide
+	checkTestTrace(t, img, func(x, y float64) float64 {
+		d := math.Min(math.Hypot(x-math.Max(40, math.Min(x, 120)), y-40),
+			math.Hypot(x-160, y-math.Max(80, math.Min(y, 160))))
+		if x <= 120 || y >= 80 {
+			d = math.Min(d, math.Abs(math.Hypot(x-120, y-80)-40))
+		}
+		return d - 20
+	}, 1.5)
+}
@@ -0,0 +1,95 @@
+/*
+################################## Board transformation ######################################
+The whole board is mirrored, rotated, scaled and moved before rendering,
+as the aperture block is transformed when flashed.
+*/
+package render
+
+import (
+	"configurator"
+	"errors"
+	. "gerberbasetypes"
+	"github.com/spf13/viper"
+	. "xy"
+)
+
+type BoardTransform struct {
+	// mirroring, rotation (degrees, counterclockwise) and scale applied around the origin
+	ApTransParameters
+	// the origin is moved to, mm
+	XOrigin, YOrigin float64
+}
+
+// reads the board transformation from the configuration
+func NewBoardTransform(v *viper.Viper) (*BoardTransform, error) {
+	retVal := new(BoardTransform)
+	retVal.Polarity = PolTypeDark
+	retVal.Mirroring = mirrorFromFlags(v.GetBool(configurator.CfgPcbMirrorX), v.GetBool(configurator.CfgPcbMirrorY))
+	retVal.Rotation = v.GetFloat64(configurator.CfgPcbRotation)
+	retVal.Scale = v.GetFloat64(configurator.CfgPcbScale)
+	retVal.XOrigin = v.GetFloat64(configurator.CfgPcbXOrigin)
+	retVal.YOrigin = v.GetFloat64(configurator.CfgPcbYOrigin)
+	if retVal.Scale <= 0 {
+		return nil, errors.New(configurator.CfgPcbScale + " must be positive")
+	}
+	return retVal, nil
+}
+
+// returns the transformation turning the board of the extents counterclockwise by 90 degrees,
+// the turned board keeps the lower left corner
+func NewQuarterTurn(minX, minY, maxX, maxY float64) *BoardTransform {
+	retVal := new(BoardTransform)
+	retVal.Polarity = PolTypeDark
+	retVal.Mirroring = NoMirror
+	retVal.Rotation = 90
+	retVal.Scale = 1
+	// (x, y) is turned to (-y, x)
+	retVal.XOrigin = maxY + minX
+	retVal.YOrigin = minY - minX
+	return retVal
+}
+
+// returns true if the board is not changed
+func (bt *BoardTransform) IsIdentity() bool {
+	return bt.ApTransParameters.IsIdentity() && bt.XOrigin == 0 && bt.YOrigin == 0
+}
+
+// returns true if the board is moved, the plot keeps the origin then
+func (bt *BoardTransform) IsMoved() bool {
+	return bt.XOrigin != 0 || bt.YOrigin != 0
+}
+
+// transforms the point
+func (bt *BoardTransform) Point(x, y float64) (float64, float64) {
+	x, y = bt.Apply(x, y)
+	return x + bt.XOrigin, y + bt.YOrigin
+}
+
+/*
+Returns the transformed copy of the steps.
+The arcs change the direction when mirrored by one axis, the apertures get the transformation composed with their own one.
+The previous points shared with the steps before are shared by the copies too.
+*/
+func (bt *BoardTransform) Steps(steps []*State) []*State {
+	retVal := make([]*State, len(steps))
+	for k, step := range steps {
+		newStep := NewState()
+		newStep.CopyOfWithTransform(step, &bt.ApTransParameters, bt.XOrigin, bt.YOrigin)
+		newStep.OriginForAB = step.OriginForAB
+		if k > 0 && step.PrevCoord == steps[k-1].Coord {
+			newStep.PrevCoord = retVal[k-1].Coord
+		} else {
+			// the previous point is transformed, the step without it starts from the origin
+			newStep.PrevCoord = NewXY()
+			if step.PrevCoord != nil {
+				newStep.PrevCoord.SetX(step.PrevCoord.GetX())
+				newStep.PrevCoord.SetY(step.PrevCoord.GetY())
+			}
+			x, y := bt.Point(newStep.PrevCoord.GetX(), newStep.PrevCoord.GetY())
+			newStep.PrevCoord.SetX(x)
+			newStep.PrevCoord.SetY(y)
+		}
+		retVal[k] = newStep
+	}
+	return retVal
+}
@@ -0,0 +1,96 @@
+package render
+
+import (
+	"configurator"
+	. "gerberbasetypes"
+	"github.com/spf13/viper"
+	"math"
+	"regions"
+	"testing"
+)
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestBoardTransform(t *testing.T) {
+	v := viper.New()
+	configurator.SetDefaults(v)
+	bt, err := NewBoardTransform(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bt.IsIdentity() == false {
+		t.Error("the default transformation changes the board")
+	}
+	v.Set(configurator.CfgPcbScale, 0)
+	if _, err := NewBoardTransform(v); err == nil {
+		t.Error("the zero scale is accepted")
+	}
+
+	ap := &Aperture{Type: AptypeCircle, Diameter: 0.5}
+	arc := traceTestStep(ap, 2, 0, 0, 2)
+	arc.IpMode = IPModeCCwC
+	arc.QMode = QuadModeMulti
+	arc.Coord.SetI(-2)
+	arc.Coord.SetJ(0)
+	next := traceTestStep(ap, 0, 2, 0, 5)
+	next.PrevCoord = arc.Coord
+	region := new(regions.Region)
+	next.Region = region
+	steps := []*State{arc, next}
+
+	// the bottom layer is mirrored, the arcs change the direction
+	v.Set(configurator.CfgPcbScale, 2)
+	v.Set(configurator.CfgPcbMirrorX, true)
+	v.Set(configurator.CfgPcbXOrigin, 10)
+	if bt, err = NewBoardTransform(v); err != nil {
+		t.Fatal(err)
+	}
+	res := bt.Steps(steps)
+	if near(res[0].PrevCoord.GetX(), 6) == false || near(res[0].PrevCoord.GetY(), 0) == false ||
+		near(res[0].Coord.GetX(), 10) == false || near(res[0].Coord.GetY(), 4) == false ||
+		near(res[0].Coord.GetI(), 4) == false || near(res[0].Coord.GetJ(), 0) == false {
+		t.Error("bad mirrored arc", res[0].PrevCoord, res[0].Coord)
+	}
+	if res[0].IpMode != IPModeCwC {
+		t.Error("the mirrored arc is not clockwise")
+	}
+	if res[0].ApTransParams.Mirroring != MirrorX || res[0].ApTransParams.Scale != 2 {
+		t.Error("the aperture is not transformed", res[0].ApTransParams.String())
+	}
+	if res[1].PrevCoord != res[0].Coord || res[1].Region != region {
+		t.Error("the chain of the steps is broken")
+	}
+	if steps[0].Coord.GetX() != 0 || steps[0].IpMode != IPModeCCwC {
+		t.Error("the source steps are changed")
+	}
+
+	// the rotation keeps the direction of the arcs
+	v.Set(configurator.CfgPcbScale, 1)
+	v.Set(configurator.CfgPcbMirrorX, false)
+	v.Set(configurator.CfgPcbXOrigin, 0)
+	v.Set(configurator.CfgPcbRotation, 90)
+	if bt, err = NewBoardTransform(v); err != nil {
+		t.Fatal(err)
+	}
+	res = bt.Steps(steps)
+	x, y := res[1].Coord.GetX(), res[1].Coord.GetY()
+	if near(x, -5) == false || near(y, 0) == false || res[0].IpMode != IPModeCCwC {
+		t.Error("bad rotated step", res[1].Coord, res[0].IpMode)
+	}
+	if bt.IsMoved() == true || res[0].ApTransParams.Rotation != 90 {
+		t.Error("bad rotation", res[0].ApTransParams.String())
+	}
+}
+
+func TestQuarterTurn(t *testing.T) {
+	ap := &Aperture{Type: AptypeCircle, Diameter: 0.5}
+	steps := []*State{traceTestStep(ap, 10, 20, 50, 30)}
+	res := NewQuarterTurn(10, 20, 50, 30).Steps(steps)
+	// the board 40 x 10 mm becomes 10 x 40 mm at the same corner
+	if near(res[0].PrevCoord.GetX(), 20) == false || near(res[0].PrevCoord.GetY(), 20) == false ||
+		near(res[0].Coord.GetX(), 10) == false || near(res[0].Coord.GetY(), 60) == false {
+		t.Error("bad turned step", res[0].PrevCoord, res[0].Coord)
+	}
+}
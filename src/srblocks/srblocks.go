@@ -131,7 +131,7 @@ func ExtractLetterDelimitedFloats(ins, template string) (out map[byte]float64, e
 		if err != nil {
 			return nil, err
 		}
-		out[template[i]] = fv
+		out[ts[i]] = fv
 	}
 
 	return out, nil
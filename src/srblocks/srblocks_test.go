@@ -0,0 +1,27 @@
+package srblocks
+
+import (
+	"testing"
+)
+
+func Test_ExtractOrderedVals(t *testing.T) {
+	// the delimiters are out of the template order, D is missing
+	s := "B678.68C7897A8098"
+	ts := "BCDA"
+	r, err := ExtractLetterDelimitedFloats(s, ts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := map[byte]float64{'B': 678.68, 'C': 7897, 'A': 8098}
+	if len(r) != len(exp) {
+		t.Fatal("expected", exp, "got", r)
+	}
+	for k, v := range exp {
+		if r[k] != v {
+			t.Errorf("%c: expected %v, got %v", k, v, r[k])
+		}
+	}
+	if _, err = ExtractLetterDelimitedFloats("X2Y", "XY"); err == nil {
+		t.Error("the missing value is accepted")
+	}
+}
@@ -21,6 +21,8 @@ type Consumer interface {
 type Storage struct {
 	index   int
 	strings []string
+	// source line numbers of the strings, 0 if unknown
+	lines []int
 }
 
 func NewStorage() *Storage {
@@ -41,9 +43,23 @@ func (storage *Storage) String() string {
 
 // empty strings are discarded
 func (storage *Storage) Accept(s string) {
+	storage.AcceptLine(s, 0)
+}
+
+// accepts the string found at the source line
+func (storage *Storage) AcceptLine(s string, line int) {
 	if len(s) > 0 {
 		(*storage).strings = append((*storage).strings, s)
+		(*storage).lines = append((*storage).lines, line)
+	}
+}
+
+// returns the source line of the string returned by the last String() call
+func (storage *Storage) Line() int {
+	if (*storage).index == 0 {
+		return 0
 	}
+	return (*storage).lines[(*storage).index-1]
 }
 
 func (storage *Storage) Len() int {
@@ -57,6 +73,7 @@ func (storage *Storage) ResetPos() {
 func (storage *Storage) Empty() {
 	(*storage).index = 0
 	(*storage).strings = (*storage).strings[:0]
+	(*storage).lines = (*storage).lines[:0]
 }
 
 func (storage *Storage) PeekPos() int {
@@ -70,3 +87,9 @@ func (storage *Storage) ToArray() []string {
 	}
 	return retVal
 }
+
+func (storage *Storage) LinesToArray() []int {
+	retVal := make([]int, len(storage.lines))
+	copy(retVal, storage.lines)
+	return retVal
+}
@@ -150,3 +150,27 @@ func TestNewStorage(t *testing.T) {
 		t.Error("we need to copy deeper")
 	}
 }
+
+func TestStorage_Line(t *testing.T) {
+	storage := NewStorage()
+	storage.AcceptLine("G01*", 3)
+	storage.AcceptLine("", 4)
+	storage.Accept("X0Y0D02*")
+	storage.AcceptLine("M02*", 7)
+	if storage.Line() != 0 {
+		t.Error("no string was read, the line must be 0")
+	}
+	expected := []int{3, 0, 7}
+	for _, e := range expected {
+		if len(storage.String()) == 0 {
+			t.Fatal("the string is lost")
+		}
+		if storage.Line() != e {
+			t.Error("expected line", e, "got", storage.Line())
+		}
+	}
+	lines := storage.LinesToArray()
+	if len(lines) != storage.Len() || lines[2] != 7 {
+		t.Error("bad lines array", lines)
+	}
+}
@@ -12,6 +12,9 @@ const GerberMOMM string = "%MOMM*%"
 
 const InchesToMM float64 = 25.4
 
+// the format specification command of any zero omission, GerberFormatSpec is the leading zeros one
+const GerberFormatSpecPrefix string = "%FS"
+
 // Function checks against non-number characters in the string
 func isNumString(ins string) bool {
 	v := []byte(ins)
@@ -27,15 +30,55 @@ func isNumString(ins string) bool {
 ############################ format specification #####################
 */
 
+// zero omission mode, the 4th symbol of the %FS command
+type ZeroOmission int
+
+const (
+	OmitLeadingZeros  ZeroOmission = iota + 1 // %FSL...
+	OmitTrailingZeros                         // %FST...
+)
+
+func (zo ZeroOmission) String() string {
+	switch zo {
+	case OmitLeadingZeros:
+		return "Leading zeros omission"
+	case OmitTrailingZeros:
+		return "Trailing zeros omission"
+	default:
+	}
+	return "Unknown zero omission"
+}
+
+// coordinate notation, the 5th symbol of the %FS command, can be changed by G90/G91
+type Notation int
+
+const (
+	AbsoluteNotation    Notation = iota + 1 // %FS.A... or G90
+	IncrementalNotation                     // %FS.I... or G91
+)
+
+func (n Notation) String() string {
+	switch n {
+	case AbsoluteNotation:
+		return "Absolute notation"
+	case IncrementalNotation:
+		return "Incremental notation"
+	default:
+	}
+	return "Unknown notation"
+}
+
 // Format specification object
 type FormatSpec struct {
-	Head     string
-	MUString string
-	XI       int // digits in the integer part
-	XD       int // digits in the fractional part
-	YI       int
-	YD       int
-	MU       float64
+	Head         string
+	MUString     string
+	XI           int // digits in the integer part
+	XD           int // digits in the fractional part
+	YI           int
+	YD           int
+	MU           float64
+	ZeroOmission ZeroOmission
+	Notation     Notation
 }
 
 // false - unable to parse format string
@@ -47,6 +90,8 @@ func (fs *FormatSpec) Init(ins, mu string) bool {
 	fs.XD = 0
 	fs.YI = 0
 	fs.YD = 0
+	fs.ZeroOmission = OmitLeadingZeros
+	fs.Notation = AbsoluteNotation
 	fs.Head = strings.ToUpper(ins)
 	fs.MUString = strings.ToUpper(mu)
 
@@ -61,7 +106,23 @@ func (fs *FormatSpec) Init(ins, mu string) bool {
 		goto fExit
 	}
 
-	if (strings.HasPrefix(fs.Head, GerberFormatSpec)) && (strings.HasSuffix(fs.Head, "*%")) {
+	if (strings.HasPrefix(fs.Head, GerberFormatSpecPrefix)) && (strings.HasSuffix(fs.Head, "*%")) && len(fs.Head) > 5 {
+		switch fs.Head[3] {
+		case 'L':
+			fs.ZeroOmission = OmitLeadingZeros
+		case 'T':
+			fs.ZeroOmission = OmitTrailingZeros
+		default:
+			goto fExit
+		}
+		switch fs.Head[4] {
+		case 'A':
+			fs.Notation = AbsoluteNotation
+		case 'I':
+			fs.Notation = IncrementalNotation
+		default:
+			goto fExit
+		}
 		Xpos = strings.IndexByte(fs.Head, 'X')
 		Ypos = strings.LastIndexByte(fs.Head, 'Y')
 		suffpos = strings.LastIndexByte(fs.Head, '*')
@@ -118,6 +179,12 @@ func (fs *FormatSpec) ReadYD() int {
 func (fs *FormatSpec) ReadMU() float64 {
 	return fs.MU
 }
+func (fs *FormatSpec) ReadZeroOmission() ZeroOmission {
+	return fs.ZeroOmission
+}
+func (fs *FormatSpec) ReadNotation() Notation {
+	return fs.Notation
+}
 
 /*
 ######################### coordinates #########################################
@@ -137,7 +204,8 @@ func (ap *axisPoint) clear() {
 // n is the number of places for int part
 // m is the number of places for frac part
 // s is the scale factor 1.0 or 25.4 (mm/inches)
-func (ap *axisPoint) init(ins string, n, m int, s float64) bool {
+// zo is the zero omission mode: the omitted zeros are restored at the left or at the right side
+func (ap *axisPoint) init(ins string, n, m int, s float64, zo ZeroOmission) bool {
 	var result = false
 	var neg = false
 	var ws string
@@ -159,12 +227,21 @@ func (ap *axisPoint) init(ins string, n, m int, s float64) bool {
 		return result
 	}
 	ps := make([]byte, n+m)
-	var inso = len(ps) - len(ws)
-	for i := 0; i < inso; i++ {
-		ps[i] = '0'
-	}
-	for i := inso; i < len(ps); i++ {
-		ps[i] = (byte)(ws[i-inso])
+	if zo == OmitTrailingZeros {
+		for i := 0; i < len(ws); i++ {
+			ps[i] = (byte)(ws[i])
+		}
+		for i := len(ws); i < len(ps); i++ {
+			ps[i] = '0'
+		}
+	} else {
+		var inso = len(ps) - len(ws)
+		for i := 0; i < inso; i++ {
+			ps[i] = '0'
+		}
+		for i := inso; i < len(ps); i++ {
+			ps[i] = (byte)(ws[i-inso])
+		}
 	}
 	var ipart int
 	var fpart int
@@ -280,6 +357,7 @@ func (xy *XY) Init(sc string, fs *FormatSpec, prev *XY) bool {
 	xy.coordString = strings.ToUpper(sc)
 	xi := fs.ReadXI()
 	xd := fs.ReadXD()
+	zo := fs.ReadZeroOmission()
 	masks := []byte{'X', 'Y', 'I', 'J', 'D'}
 	mpos := []int{-1, -1, -1, -1, -1}
 	var found int = 0 // found signatures
@@ -327,30 +405,41 @@ func (xy *XY) Init(sc string, fs *FormatSpec, prev *XY) bool {
 	}
 
 	sf := fs.ReadMU()
+	// in incremental notation X and Y are the distances from the previous point,
+	// I and J are always the offsets from the start point of an arc
+	prevX := xy.x.getfval()
+	prevY := xy.y.getfval()
+	incremental := fs.ReadNotation() == IncrementalNotation
 L1:
 	for i := range m2 {
 		switch m2[i] {
 		case 'X':
 			// possibly X value detected
-			if xy.x.init(xy.coordString[p2[i]+1:p2[i+1]], xi, xd, sf) == false {
+			if xy.x.init(xy.coordString[p2[i]+1:p2[i+1]], xi, xd, sf, zo) == false {
 				result = false
 				break L1
 			}
+			if incremental {
+				xy.x.valFloat += prevX
+			}
 		case 'Y':
 			// possibly Y value detected
-			if xy.y.init(xy.coordString[p2[i]+1:p2[i+1]], xi, xd, sf) == false {
+			if xy.y.init(xy.coordString[p2[i]+1:p2[i+1]], xi, xd, sf, zo) == false {
 				result = false
 				break L1
 			}
+			if incremental {
+				xy.y.valFloat += prevY
+			}
 		case 'I':
 			// possibly I value detected
-			if xy.i.init(xy.coordString[p2[i]+1:p2[i+1]], xi, xd, sf) == false {
+			if xy.i.init(xy.coordString[p2[i]+1:p2[i+1]], xi, xd, sf, zo) == false {
 				result = false
 				break L1
 			}
 		case 'J':
 			// possibly J value detected
-			if xy.j.init(xy.coordString[p2[i]+1:p2[i+1]], xi, xd, sf) == false {
+			if xy.j.init(xy.coordString[p2[i]+1:p2[i+1]], xi, xd, sf, zo) == false {
 				result = false
 				break L1
 			}
@@ -1,7 +1,7 @@
 package xy
 
 import (
-	"fmt"
+	"math"
 	"math/rand"
 	"strconv"
 	"strings"
@@ -281,14 +281,95 @@ func TestXY_Init(t *testing.T) {
 }
 
 */
-func Test_ExtractOrderedVals(t *testing.T) {
-	s := "B678.68C7897A8098"
-	ts := "BCDA"
-	r, err := ExtractLetterDelimitedFloats(s, ts)
-	if err == nil {
-		fmt.Println(r)
-	} else {
-		fmt.Println(err)
+
+// the same values encoded with leading and trailing zeros omission
+var zeroOmissionTestData = []struct {
+	val      float64
+	leading  string
+	trailing string
+}{
+	{1.5, "1500000", "015"},
+	{-12.345, "-12345000", "-12345"},
+	{0.000123, "123", "00000123"},
+	{10.0, "10000000", "1"},
+	{0.0, "0", "0"},
+	{-0.5, "-500000", "-005"},
+	{99.999999, "99999999", "99999999"},
+}
+
+func TestXY_InitZeroOmission(t *testing.T) {
+	fsL := new(FormatSpec)
+	if fsL.Init("%FSLAX26Y26*%", mostr) == false || fsL.ReadZeroOmission() != OmitLeadingZeros {
+		t.Fatal("unable to init leading zeros omission format")
+	}
+	fsT := new(FormatSpec)
+	if fsT.Init("%FSTAX26Y26*%", mostr) == false || fsT.ReadZeroOmission() != OmitTrailingZeros {
+		t.Fatal("unable to init trailing zeros omission format")
+	}
+	for _, td := range zeroOmissionTestData {
+		xyL := new(XY)
+		if xyL.Init("X"+td.leading+"Y"+td.leading+"D", fsL, nil) == false {
+			t.Error("unable to parse " + td.leading)
+			continue
+		}
+		xyT := new(XY)
+		if xyT.Init("X"+td.trailing+"Y"+td.trailing+"I"+td.trailing+"D", fsT, nil) == false {
+			t.Error("unable to parse " + td.trailing)
+			continue
+		}
+		if math.Abs(xyL.GetX()-td.val) > 1e-9 || math.Abs(xyL.GetY()-td.val) > 1e-9 {
+			t.Error("leading zeros omission: expected", td.val, "got", xyL.GetX(), xyL.GetY())
+		}
+		if math.Abs(xyT.GetX()-td.val) > 1e-9 || math.Abs(xyT.GetY()-td.val) > 1e-9 ||
+			math.Abs(xyT.GetI()-td.val) > 1e-9 {
+			t.Error("trailing zeros omission: expected", td.val, "got", xyT.GetX(), xyT.GetY(), xyT.GetI())
+		}
 	}
+	// too many digits
+	xyT := new(XY)
+	if xyT.Init("X123456789D", fsT, nil) == true {
+		t.Error("error expected")
+	}
+	// bad zero omission symbol
+	if new(FormatSpec).Init("%FSKAX26Y26*%", mostr) == true {
+		t.Error("error expected")
+	}
+}
 
+func TestXY_InitIncremental(t *testing.T) {
+	fsI := new(FormatSpec)
+	if fsI.Init("%FSLIX26Y26*%", mostr) == false || fsI.ReadNotation() != IncrementalNotation {
+		t.Fatal("unable to init incremental notation format")
+	}
+	steps := []struct {
+		s          string
+		x, y, i, j float64
+	}{
+		{"X1000000Y2000000D", 1.0, 2.0, 0.0, 0.0},
+		{"X500000D", 1.5, 2.0, 0.0, 0.0},
+		{"Y-3000000D", 1.5, -1.0, 0.0, 0.0},
+		{"X1000000Y1000000I250000J-250000D", 2.5, 0.0, 0.25, -0.25},
+	}
+	var prev *XY
+	for _, st := range steps {
+		xy := new(XY)
+		if xy.Init(st.s, fsI, prev) == false {
+			t.Fatal("unable to parse " + st.s)
+		}
+		if math.Abs(xy.GetX()-st.x) > 1e-9 || math.Abs(xy.GetY()-st.y) > 1e-9 ||
+			math.Abs(xy.GetI()-st.i) > 1e-9 || math.Abs(xy.GetJ()-st.j) > 1e-9 {
+			t.Error(st.s+": expected", st.x, st.y, st.i, st.j, "got", xy.String())
+		}
+		prev = xy
+	}
+	// switch to the absolute notation like G90 does
+	fsA := *fsI
+	fsA.Notation = AbsoluteNotation
+	xy := new(XY)
+	if xy.Init("X1000000D", &fsA, prev) == false {
+		t.Fatal("unable to parse absolute coordinates")
+	}
+	if math.Abs(xy.GetX()-1.0) > 1e-9 || math.Abs(xy.GetY()) > 1e-9 {
+		t.Error("absolute notation: got " + xy.String())
+	}
 }